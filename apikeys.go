@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+// postAPIKeys issues the caller a long-lived API key for scripts and
+// integrations. Only its hash is stored, so the key itself is in this
+// response and nowhere else.
+func (a *apiConfig) postAPIKeys(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		fmt.Printf("apiConfig.postAPIKeys: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var r database.ApiKey
+	err = a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			ActorID: uuid.NullUUID{UUID: userID, Valid: true},
+			Action:  auditAPIKeyCreate,
+			Target:  userID.String(),
+		},
+		func(q Querier) error {
+			r, err = q.CreateAPIKey(
+				rq.Context(),
+				database.CreateAPIKeyParams{
+					UserID:  userID,
+					KeyHash: auth.HashAPIKey(key),
+				},
+			)
+			return err
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.postAPIKeys: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	type response struct {
+		Id        uuid.UUID `json:"id"`
+		Key       string    `json:"key"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	respondWithJSON(
+		rw,
+		http.StatusCreated,
+		response{Id: r.ID, Key: key, CreatedAt: r.CreatedAt.UTC()},
+	)
+}
+
+// deleteAPIKeysID revokes one of the caller's API keys. Keys belonging to
+// someone else are reported as not found.
+func (a *apiConfig) deleteAPIKeysID(rw http.ResponseWriter, rq *http.Request) {
+	keyID, err := parsePathUUID(rq, "id")
+	if err != nil {
+		fmt.Printf("apiConfig.deleteAPIKeysID: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err = a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			ActorID: uuid.NullUUID{UUID: userID, Valid: true},
+			Action:  auditAPIKeyRevoke,
+			Target:  keyID.String(),
+		},
+		func(q Querier) error {
+			n, err := q.RevokeAPIKey(
+				rq.Context(),
+				database.RevokeAPIKeyParams{ID: keyID, UserID: userID},
+			)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.deleteAPIKeysID: %v\n", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.deleteAPIKeysID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func doWithAPIKey(
+	h http.HandlerFunc,
+	method string,
+	target string,
+	key string,
+) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(method, target, nil)
+	rq.Header.Set("Authorization", "ApiKey "+key)
+	h(rec, rq)
+	return rec
+}
+
+func TestAPIKeys(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	other := signUpAndLogIn(t, a, "other@example.com")
+
+	rec := doJSON(
+		t,
+		a.middlewareJWTAuth(a.postAPIKeys),
+		http.MethodPost,
+		"/api/apikeys",
+		u.Token,
+		"",
+	)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postAPIKeys() status = %d, want 201", rec.Code)
+	}
+	var created struct {
+		Id  uuid.UUID `json:"id"`
+		Key string    `json:"key"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if created.Key == "" {
+		t.Fatalf("postAPIKeys() returned no key")
+	}
+
+	getMe := a.middlewareAuth(a.getMe)
+	rec = doWithAPIKey(getMe, http.MethodGet, "/api/me", created.Key)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getMe() with API key status = %d, want 200", rec.Code)
+	}
+	var me user
+	err = json.Unmarshal(rec.Body.Bytes(), &me)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if me.Id != u.Id {
+		t.Errorf("getMe() with API key id = %v, want %v", me.Id, u.Id)
+	}
+
+	rec = doWithAPIKey(
+		a.middlewareJWTAuth(a.postAPIKeys),
+		http.MethodPost,
+		"/api/apikeys",
+		created.Key,
+	)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf(
+			"postAPIKeys() with API key status = %d, want %d",
+			rec.Code,
+			http.StatusUnauthorized,
+		)
+	}
+
+	revoke := func(token string) int {
+		rq := httptest.NewRequest(
+			http.MethodDelete,
+			"/api/apikeys/"+created.Id.String(),
+			nil,
+		)
+		rq.Header.Set("Authorization", "Bearer "+token)
+		rq.SetPathValue("id", created.Id.String())
+		rec := httptest.NewRecorder()
+		a.middlewareJWTAuth(a.deleteAPIKeysID)(rec, rq)
+		return rec.Code
+	}
+
+	if code := revoke(other.Token); code != http.StatusNotFound {
+		t.Errorf("deleteAPIKeysID() by other user status = %d, want 404", code)
+	}
+	if code := revoke(u.Token); code != http.StatusNoContent {
+		t.Fatalf("deleteAPIKeysID() status = %d, want 204", code)
+	}
+	if code := revoke(u.Token); code != http.StatusNotFound {
+		t.Errorf("deleteAPIKeysID() again status = %d, want 404", code)
+	}
+
+	rec = doWithAPIKey(getMe, http.MethodGet, "/api/me", created.Key)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf(
+			"getMe() with revoked API key status = %d, want %d",
+			rec.Code,
+			http.StatusUnauthorized,
+		)
+	}
+
+	rec = doWithAPIKey(getMe, http.MethodGet, "/api/me", "not-a-key")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf(
+			"getMe() with unknown API key status = %d, want %d",
+			rec.Code,
+			http.StatusUnauthorized,
+		)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+const (
+	auditAdminReset   = "admin.reset"
+	auditAPIKeyCreate = "apikey.create"
+	auditAPIKeyRevoke = "apikey.revoke"
+	auditChirpDelete  = "chirp.delete"
+	auditChirpPurge   = "chirp.purge"
+	auditInviteCreate = "invite.create"
+	auditUserDelete   = "user.delete"
+	auditUserUpgrade  = "user.upgrade"
+)
+
+// withAudit runs fn and records entry in the same transaction, so an action is
+// never applied without its audit row, or logged without being applied.
+func (a *apiConfig) withAudit(
+	ctx context.Context,
+	entry database.CreateAuditEntryParams,
+	fn func(q Querier) error,
+) error {
+	tx, qtx, err := a.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("withAudit: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = fn(qtx)
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.CreateAuditEntry(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("withAudit: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("withAudit: %w", err)
+	}
+
+	return nil
+}
+
+type auditEntry struct {
+	Id        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ActorId   *uuid.UUID `json:"actor_id"`
+	Action    string     `json:"action"`
+	Target    string     `json:"target"`
+}
+
+func auditEntryFromRow(r database.AuditLog) auditEntry {
+	e := auditEntry{
+		Id:        r.ID,
+		CreatedAt: r.CreatedAt.UTC(),
+		Action:    r.Action,
+		Target:    r.Target,
+	}
+	if r.ActorID.Valid {
+		actorID := r.ActorID.UUID
+		e.ActorId = &actorID
+	}
+	return e
+}
+
+func (a *apiConfig) getAdminAudit(rw http.ResponseWriter, rq *http.Request) {
+	if a.platform != "dev" {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	pg, err := parsePage(rq.URL.Query())
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := a.qry.ListAuditEntries(
+		rq.Context(),
+		database.ListAuditEntriesParams{Limit: pg.Limit, Offset: pg.Offset},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getAdminAudit: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]auditEntry, len(rows))
+	for i, r := range rows {
+		entries[i] = auditEntryFromRow(r)
+	}
+
+	respondWithJSON(rw, http.StatusOK, entries)
+}
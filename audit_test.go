@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+func TestAuditEntryFromRow(t *testing.T) {
+	actorID := uuid.New()
+
+	tests := []struct {
+		name        string
+		actorID     uuid.NullUUID
+		wantActorID any
+	}{
+		{
+			name:        "User action",
+			actorID:     uuid.NullUUID{UUID: actorID, Valid: true},
+			wantActorID: actorID.String(),
+		},
+		{
+			name:        "Admin action without actor",
+			actorID:     uuid.NullUUID{},
+			wantActorID: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := auditEntryFromRow(database.AuditLog{
+				ID:        uuid.New(),
+				CreatedAt: time.Now(),
+				ActorID:   tt.actorID,
+				Action:    auditChirpDelete,
+				Target:    uuid.NewString(),
+			})
+
+			dat, err := json.Marshal(e)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			fields := map[string]any{}
+			err = json.Unmarshal(dat, &fields)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if fields["actor_id"] != tt.wantActorID {
+				t.Errorf("audit entry actor_id = %v, want %v", fields["actor_id"], tt.wantActorID)
+			}
+			if fields["action"] != auditChirpDelete {
+				t.Errorf("audit entry action = %v, want %v", fields["action"], auditChirpDelete)
+			}
+		})
+	}
+}
+
+// listAudit fetches a page of the audit log as an admin in dev.
+func listAudit(t *testing.T, a *apiConfig, query string) []auditEntry {
+	t.Helper()
+
+	a.platform = "dev"
+	rec := doJSON(t, a.getAdminAudit, http.MethodGet, "/admin/audit"+query, "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getAdminAudit(%q) status = %d, want %d", query, rec.Code, http.StatusOK)
+	}
+	var entries []auditEntry
+	err := json.Unmarshal(rec.Body.Bytes(), &entries)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return entries
+}
+
+// deleteChirp deletes chirpID as the user token belongs to.
+func deleteChirp(t *testing.T, a *apiConfig, token string, chirpID uuid.UUID) {
+	t.Helper()
+
+	rq := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+chirpID.String(), nil)
+	rq.SetPathValue("chirpID", chirpID.String())
+	rq.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestAuditLogRecordsAction(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"soon gone"}`)
+
+	deleteChirp(t, a, u.Token, c.Id)
+
+	entries := listAudit(t, a, "")
+	if len(entries) != 1 {
+		t.Fatalf("audit entries = %+v, want 1", entries)
+	}
+	e := entries[0]
+	if e.Action != auditChirpDelete || e.Target != c.Id.String() {
+		t.Errorf("audit entry = %+v, want %s of %v", e, auditChirpDelete, c.Id)
+	}
+	if e.ActorId == nil || *e.ActorId != u.Id {
+		t.Errorf("audit entry actor_id = %v, want %v", e.ActorId, u.Id)
+	}
+}
+
+func TestGetAdminAuditPages(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	var deleted []string
+	for _, body := range []string{"one", "two", "three"} {
+		_, c := postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+		deleteChirp(t, a, u.Token, c.Id)
+		deleted = append(deleted, c.Id.String())
+	}
+	// Newest first.
+	slices.Reverse(deleted)
+
+	targets := func(entries []auditEntry) []string {
+		got := []string{}
+		for _, e := range entries {
+			got = append(got, e.Target)
+		}
+		return got
+	}
+
+	first := targets(listAudit(t, a, "?limit=2"))
+	if want := deleted[:2]; !slices.Equal(first, want) {
+		t.Errorf("first page = %v, want %v", first, want)
+	}
+	second := targets(listAudit(t, a, "?limit=2&offset=2"))
+	if want := deleted[2:]; !slices.Equal(second, want) {
+		t.Errorf("second page = %v, want %v", second, want)
+	}
+	if total := len(first) + len(second); total != len(deleted) {
+		t.Errorf("entries across both pages = %d, want %d", total, len(deleted))
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+const maxBatchChirps = 100
+
+// postChirpsBatch creates several chirps for the caller at once, for importing
+// history. The body is an array of {"body": ...} objects. Either every chirp
+// is created or, if any is invalid, none are.
+func (a *apiConfig) postChirpsBatch(rw http.ResponseWriter, rq *http.Request) {
+	type inputChirp struct {
+		Body string `json:"body"`
+	}
+
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	inp := []inputChirp{}
+	if !a.decodeJSON(rw, rq, &inp) {
+		return
+	}
+
+	if len(inp) == 0 {
+		respondWithError(rw, http.StatusBadRequest, "no chirps to create")
+		return
+	}
+	if len(inp) > maxBatchChirps {
+		respondWithError(
+			rw,
+			http.StatusBadRequest,
+			fmt.Sprintf("at most %d chirps can be created at once", maxBatchChirps),
+		)
+		return
+	}
+
+	bodies := make([]string, len(inp))
+	for i, c := range inp {
+		body, err := validateChirpBody(
+			c.Body,
+			a.badWords,
+			a.chirpLengthLimit(),
+		)
+		if err != nil {
+			respondWithError(
+				rw,
+				http.StatusBadRequest,
+				fmt.Sprintf("chirp %d: %v", i, err),
+			)
+			return
+		}
+		bodies[i] = body
+	}
+
+	tx, qtx, err := a.beginTx(rq.Context())
+	if err != nil {
+		fmt.Printf("apiConfig.postChirpsBatch: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	chirps := make([]chirp, len(bodies))
+	for i, body := range bodies {
+		r, err := qtx.CreateChirp(
+			rq.Context(),
+			database.CreateChirpParams{Body: body, UserID: userID},
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.postChirpsBatch: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		chirps[i] = chirpFromRow(r)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Printf("apiConfig.postChirpsBatch: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.chirpsCreated.Add(int64(len(chirps)))
+	for _, c := range chirps {
+		a.chirpWebhook.chirpCreated(c)
+		a.chirpBroker.publish(c)
+	}
+
+	respondWithJSON(rw, http.StatusCreated, chirps)
+}
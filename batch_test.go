@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPostChirpsBatch(t *testing.T) {
+	a, f := newFakeConfig()
+	a.badWords = defaultBadWords
+	u := signUpAndLogIn(t, a, "user@example.com")
+	handler := a.middlewareAuth(a.postChirpsBatch)
+
+	rec := doJSON(
+		t,
+		handler,
+		http.MethodPost,
+		"/api/chirps/batch",
+		u.Token,
+		`[{"body":"first"},{"body":"a kerfuffle"},{"body":"third"}]`,
+	)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postChirpsBatch() status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	var got []chirp
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want := []string{"first", "a ****", "third"}
+	if len(got) != len(want) {
+		t.Fatalf("postChirpsBatch() returned %d chirps, want %d", len(got), len(want))
+	}
+	for i, c := range got {
+		if c.Body != want[i] || c.UserId != u.Id {
+			t.Errorf("chirp %d = %q by %v, want %q by %v", i, c.Body, c.UserId, want[i], u.Id)
+		}
+	}
+	if len(f.state.chirps) != len(want) {
+		t.Errorf("stored %d chirps, want %d", len(f.state.chirps), len(want))
+	}
+}
+
+func TestPostChirpsBatchAllOrNothing(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "One body too long",
+			body: `[{"body":"fine"},{"body":"` + strings.Repeat("a", 141) + `"}]`,
+		},
+		{
+			name: "One body empty",
+			body: `[{"body":"fine"},{"body":""}]`,
+		},
+		{
+			name: "Empty batch",
+			body: `[]`,
+		},
+		{
+			name: "Too many chirps",
+			body: "[" + strings.Repeat(`{"body":"x"},`, maxBatchChirps) + `{"body":"x"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, f := newFakeConfig()
+			u := signUpAndLogIn(t, a, "user@example.com")
+
+			rec := doJSON(
+				t,
+				a.middlewareAuth(a.postChirpsBatch),
+				http.MethodPost,
+				"/api/chirps/batch",
+				u.Token,
+				tt.body,
+			)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("postChirpsBatch() status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if len(f.state.chirps) != 0 {
+				t.Errorf("postChirpsBatch() stored %d chirps, want 0", len(f.state.chirps))
+			}
+		})
+	}
+}
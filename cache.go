@@ -0,0 +1,149 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+const (
+	defaultChirpCacheSize = 1000
+	defaultChirpCacheTTL  = time.Minute
+)
+
+// chirpCache is a fixed-size LRU cache of chirp rows for getChirpsChirpID.
+// Only the chirp's own row is cached: the quoted chirp and like count are
+// loaded on every request, so editing or deleting a chirp never leaves a
+// stale copy embedded in the chirps that quote or reply to it. Entries
+// expire after ttl so changes the handlers don't invalidate explicitly are
+// picked up eventually. A nil *chirpCache caches nothing.
+type chirpCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List
+	entries map[uuid.UUID]*list.Element
+}
+
+type chirpCacheEntry struct {
+	row     database.Chirp
+	expires time.Time
+}
+
+func newChirpCache(size int, ttl time.Duration) *chirpCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &chirpCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: map[uuid.UUID]*list.Element{},
+	}
+}
+
+// get returns the cached row for id if there is one that hasn't expired.
+func (c *chirpCache) get(id uuid.UUID) (database.Chirp, bool) {
+	if c == nil {
+		return database.Chirp{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return database.Chirp{}, false
+	}
+
+	e := el.Value.(*chirpCacheEntry)
+	if !c.now().Before(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, id)
+		return database.Chirp{}, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.row, true
+}
+
+// put caches row, evicting the least recently used entry if the cache is
+// full.
+func (c *chirpCache) put(row database.Chirp) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &chirpCacheEntry{row: row, expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[row.ID]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[row.ID] = c.order.PushFront(e)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*chirpCacheEntry).row.ID)
+	}
+}
+
+// remove drops id from the cache after the chirp has changed.
+func (c *chirpCache) remove(id uuid.UUID) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		c.order.Remove(el)
+		delete(c.entries, id)
+	}
+}
+
+// purge empties the cache, for changes that touch many chirps at once.
+func (c *chirpCache) purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+// getChirpCached looks id up in the chirp cache, falling back to the database
+// on a miss and caching what it finds.
+func (a *apiConfig) getChirpCached(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.Chirp, error) {
+	if row, ok := a.chirpCache.get(id); ok {
+		return row, nil
+	}
+
+	row, err := a.qry.GetChirp(ctx, id)
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("getChirpCached: %w", err)
+	}
+
+	a.chirpCache.put(row)
+	return row, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+func TestChirpCacheEviction(t *testing.T) {
+	c := newChirpCache(2, time.Minute)
+	first := database.Chirp{ID: uuid.New()}
+	second := database.Chirp{ID: uuid.New()}
+	third := database.Chirp{ID: uuid.New()}
+
+	c.put(first)
+	c.put(second)
+	// Touching first makes second the least recently used.
+	c.get(first.ID)
+	c.put(third)
+
+	if _, ok := c.get(second.ID); ok {
+		t.Errorf("get(second) hit, want it evicted")
+	}
+	if _, ok := c.get(first.ID); !ok {
+		t.Errorf("get(first) missed, want it kept")
+	}
+	if _, ok := c.get(third.ID); !ok {
+		t.Errorf("get(third) missed, want it kept")
+	}
+}
+
+func TestChirpCacheTTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newChirpCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	row := database.Chirp{ID: uuid.New()}
+	c.put(row)
+
+	now = now.Add(59 * time.Second)
+	if _, ok := c.get(row.ID); !ok {
+		t.Errorf("get() before ttl missed")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := c.get(row.ID); ok {
+		t.Errorf("get() after ttl hit")
+	}
+}
+
+func TestChirpCacheDisabled(t *testing.T) {
+	c := newChirpCache(0, time.Minute)
+	if c != nil {
+		t.Fatalf("newChirpCache(0) = %v, want nil", c)
+	}
+
+	row := database.Chirp{ID: uuid.New()}
+	c.put(row)
+	if _, ok := c.get(row.ID); ok {
+		t.Errorf("nil cache get() hit")
+	}
+}
+
+func getChirpByID(t *testing.T, a *apiConfig, id uuid.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(http.MethodGet, "/api/chirps/"+id.String(), nil)
+	rq.SetPathValue("chirpID", id.String())
+	a.getChirpsChirpID(rec, rq)
+	return rec
+}
+
+func TestGetChirpsChirpIDCache(t *testing.T) {
+	a, f := newFakeConfig()
+	a.chirpCache = newChirpCache(10, time.Minute)
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"hello"}`)
+
+	rec := getChirpByID(t, a, c.Id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// Change the row behind the cache's back; a cached fetch won't see it.
+	row := f.state.chirps[c.Id]
+	row.Body = "changed in the database"
+	f.state.chirps[c.Id] = row
+
+	rec = getChirpByID(t, a, c.Id)
+	got := chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Body != "hello" {
+		t.Errorf("second getChirpsChirpID() body = %q, want cached %q", got.Body, "hello")
+	}
+
+	rq := newAuthedRequest(t, http.MethodDelete, "/api/chirps/"+c.Id.String(), u.Id, a.secret)
+	rq.SetPathValue("chirpID", c.Id.String())
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	if _, ok := a.chirpCache.get(c.Id); ok {
+		t.Errorf("cache still holds the deleted chirp")
+	}
+	rec = getChirpByID(t, a, c.Id)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("getChirpsChirpID() after delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetChirpsChirpIDCacheQuoted(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.chirpCache = newChirpCache(10, time.Minute)
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, quoted := postChirp(t, a, u.Token, `{"body":"original"}`)
+	_, quoting := postChirp(t, a, u.Token, `{"body":"look","quote_of":"`+quoted.Id.String()+`"}`)
+
+	rec := getChirpByID(t, a, quoting.Id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rq := httptest.NewRequest(
+		http.MethodPut,
+		"/api/chirps/"+quoted.Id.String(),
+		strings.NewReader(`{"body":"edited"}`),
+	)
+	rq.SetPathValue("chirpID", quoted.Id.String())
+	rq.Header.Set("Authorization", "Bearer "+u.Token)
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.putChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = getChirpByID(t, a, quoting.Id)
+	got := chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Quoted == nil || got.Quoted.Body != "edited" {
+		t.Errorf("quoting chirp embeds %+v, want body %q", got.Quoted, "edited")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+// etagFor returns a strong ETag for a response body. Hashing the body rather
+// than using updated_at means changes to like counts or a quoted chirp also
+// produce a new tag.
+func etagFor(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// The header may list several tags, use weak tags, or be "*".
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchUpdatedAt reports whether an If-Match header value allows writing a
+// chirp last updated at updatedAt. Clients send back the updated_at from the
+// chirp they edited, optionally quoted like an ETag. Unlike the response
+// ETag this ignores like counts, so a new like doesn't fail an edit.
+func ifMatchUpdatedAt(header string, updatedAt time.Time) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.Trim(strings.TrimSpace(tag), `"`)
+		if tag == "*" {
+			return true
+		}
+		t, err := time.Parse(time.RFC3339Nano, tag)
+		if err == nil && t.Equal(updatedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchChirp reports whether an If-Match header value allows writing row.
+// It accepts the ETag getChirpsChirpID sent for the chirp, with or without
+// expand=author, as well as the updated_at ifMatchUpdatedAt takes. The ETag
+// covers the whole response, so a new like since the GET fails the check.
+func (a *apiConfig) ifMatchChirp(
+	ctx context.Context,
+	header string,
+	row database.Chirp,
+) (bool, error) {
+	if ifMatchUpdatedAt(header, row.UpdatedAt) {
+		return true, nil
+	}
+
+	for _, withAuthor := range []bool{false, true} {
+		dat, err := a.chirpJSON(ctx, row, withAuthor)
+		if err != nil {
+			return false, fmt.Errorf("ifMatchChirp: %w", err)
+		}
+		if etagMatches(header, etagFor(dat)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEtagMatches(t *testing.T) {
+	etag := etagFor([]byte(`{"body":"hello"}`))
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{
+			name:   "Exact",
+			header: etag,
+			want:   true,
+		},
+		{
+			name:   "Weak",
+			header: "W/" + etag,
+			want:   true,
+		},
+		{
+			name:   "In a list",
+			header: `"other", ` + etag,
+			want:   true,
+		},
+		{
+			name:   "Wildcard",
+			header: "*",
+			want:   true,
+		},
+		{
+			name:   "Different tag",
+			header: `"other"`,
+			want:   false,
+		},
+		{
+			name:   "Empty",
+			header: "",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, etag); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChirpsChirpIDETag(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"hello"}`)
+
+	rec := getChirpByID(t, a, c.Id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("getChirpsChirpID() returned no ETag")
+	}
+
+	rq := httptest.NewRequest(http.MethodGet, "/api/chirps/"+c.Id.String(), nil)
+	rq.SetPathValue("chirpID", c.Id.String())
+	rq.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	a.getChirpsChirpID(rec, rq)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("conditional getChirpsChirpID() body = %q, want empty", rec.Body.String())
+	}
+
+	// A like changes the representation, so the old tag no longer matches.
+	likeChirp(t, a, http.MethodPost, u.Id, c.Id)
+
+	rq = httptest.NewRequest(http.MethodGet, "/api/chirps/"+c.Id.String(), nil)
+	rq.SetPathValue("chirpID", c.Id.String())
+	rq.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	a.getChirpsChirpID(rec, rq)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("getChirpsChirpID() after a like status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestIfMatchUpdatedAt(t *testing.T) {
+	updatedAt := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	stamp := updatedAt.Format(time.RFC3339Nano)
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{
+			name:   "Bare timestamp",
+			header: stamp,
+			want:   true,
+		},
+		{
+			name:   "Quoted timestamp",
+			header: `"` + stamp + `"`,
+			want:   true,
+		},
+		{
+			name:   "Other time zone",
+			header: updatedAt.In(time.FixedZone("", 3600)).Format(time.RFC3339Nano),
+			want:   true,
+		},
+		{
+			name:   "Wildcard",
+			header: "*",
+			want:   true,
+		},
+		{
+			name:   "Stale",
+			header: updatedAt.Add(-time.Second).Format(time.RFC3339Nano),
+			want:   false,
+		},
+		{
+			name:   "Garbage",
+			header: "not-a-time",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ifMatchUpdatedAt(tt.header, updatedAt); got != tt.want {
+				t.Errorf("ifMatchUpdatedAt(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutChirpsChirpIDIfMatch(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"first draft"}`)
+
+	put := func(ifMatch, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rq := httptest.NewRequest(
+			http.MethodPut,
+			"/api/chirps/"+c.Id.String(),
+			strings.NewReader(body),
+		)
+		rq.SetPathValue("chirpID", c.Id.String())
+		rq.Header.Set("Authorization", "Bearer "+u.Token)
+		if ifMatch != "" {
+			rq.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		a.middlewareAuth(a.putChirpsChirpID)(rec, rq)
+		return rec
+	}
+
+	original := c.UpdatedAt.Format(time.RFC3339Nano)
+	rec := put(`"`+original+`"`, `{"body":"second draft"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putChirpsChirpID() with current If-Match status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	edited := chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &edited)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	rec = put(`"`+original+`"`, `{"body":"clobbered"}`)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("putChirpsChirpID() with stale If-Match status = %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	if got := getChirpByID(t, a, c.Id); !strings.Contains(got.Body.String(), "second draft") {
+		t.Errorf("stale edit changed the chirp: %s", got.Body.String())
+	}
+
+	rec = put(edited.UpdatedAt.Format(time.RFC3339Nano), `{"body":"third draft"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("putChirpsChirpID() with refreshed If-Match status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = put("", `{"body":"no precondition"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("putChirpsChirpID() without If-Match status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestPutChirpsChirpIDIfMatchETag(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"first draft"}`)
+
+	put := func(ifMatch, body string) int {
+		t.Helper()
+		rq := httptest.NewRequest(
+			http.MethodPut,
+			"/api/chirps/"+c.Id.String(),
+			strings.NewReader(body),
+		)
+		rq.SetPathValue("chirpID", c.Id.String())
+		rq.Header.Set("Authorization", "Bearer "+u.Token)
+		rq.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		a.middlewareAuth(a.putChirpsChirpID)(rec, rq)
+		return rec.Code
+	}
+	etag := func(target string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		rq := httptest.NewRequest(http.MethodGet, target, nil)
+		rq.SetPathValue("chirpID", c.Id.String())
+		a.getChirpsChirpID(rec, rq)
+		return rec.Header().Get("ETag")
+	}
+
+	original := etag("/api/chirps/" + c.Id.String())
+	if code := put(original, `{"body":"second draft"}`); code != http.StatusOK {
+		t.Fatalf("putChirpsChirpID() with current ETag status = %d, want %d", code, http.StatusOK)
+	}
+	if code := put(original, `{"body":"clobbered"}`); code != http.StatusPreconditionFailed {
+		t.Errorf("putChirpsChirpID() with stale ETag status = %d, want %d", code, http.StatusPreconditionFailed)
+	}
+
+	withAuthor := etag("/api/chirps/" + c.Id.String() + "?expand=author")
+	if code := put(withAuthor, `{"body":"third draft"}`); code != http.StatusOK {
+		t.Errorf("putChirpsChirpID() with expand=author ETag status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+// followTarget identifies the caller and looks up the user named in the
+// path. Users can't follow themselves. If any check fails it writes the error
+// response itself and returns false.
+func (a *apiConfig) followTarget(
+	rw http.ResponseWriter,
+	rq *http.Request,
+	caller string,
+) (uuid.UUID, uuid.UUID, bool) {
+	followeeID, err := parsePathUUID(rq, "userID")
+	if err != nil {
+		fmt.Printf("apiConfig.%s: %v\n", caller, err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	followerID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if followerID == followeeID {
+		respondWithError(rw, http.StatusBadRequest, "cannot follow yourself")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	_, err = a.qry.GetUserByID(rq.Context(), followeeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.%s: %v\n", caller, err)
+		rw.WriteHeader(http.StatusNotFound)
+		return uuid.Nil, uuid.Nil, false
+	} else if err != nil {
+		fmt.Printf("apiConfig.%s: %v\n", caller, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return followerID, followeeID, true
+}
+
+// postUsersUserIDFollow makes the caller follow a user. Following someone
+// already followed succeeds without changing anything.
+func (a *apiConfig) postUsersUserIDFollow(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	followerID, followeeID, ok := a.followTarget(
+		rw,
+		rq,
+		"postUsersUserIDFollow",
+	)
+	if !ok {
+		return
+	}
+
+	err := a.qry.FollowUser(
+		rq.Context(),
+		database.FollowUserParams{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.postUsersUserIDFollow: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUsersUserIDFollow stops the caller following a user, if they were.
+func (a *apiConfig) deleteUsersUserIDFollow(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	followerID, followeeID, ok := a.followTarget(
+		rw,
+		rq,
+		"deleteUsersUserIDFollow",
+	)
+	if !ok {
+		return
+	}
+
+	err := a.qry.UnfollowUser(
+		rq.Context(),
+		database.UnfollowUserParams{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.deleteUsersUserIDFollow: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// getFeed lists chirps by the users the caller follows, newest first.
+func (a *apiConfig) getFeed(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	pg, err := parsePage(rq.URL.Query())
+	if err != nil {
+		fmt.Printf("apiConfig.getFeed: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := a.qry.GetFeed(
+		rq.Context(),
+		database.GetFeedParams{
+			FollowerID: userID,
+			RowLimit:   pg.Limit,
+			RowOffset:  pg.Offset,
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getFeed: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	chirps, err := a.chirpsFromRows(rq.Context(), rows)
+	if err != nil {
+		fmt.Printf("apiConfig.getFeed: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, chirps)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// follow has userID follow or, with DELETE, unfollow followeeID.
+func follow(
+	t *testing.T,
+	a *apiConfig,
+	method string,
+	userID uuid.UUID,
+	followeeID uuid.UUID,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rq := newPathRequest(
+		t,
+		method,
+		"/api/users/"+followeeID.String()+"/follow",
+		"userID",
+		followeeID.String(),
+		userID,
+		a.secret,
+	)
+	handler := a.postUsersUserIDFollow
+	if method == http.MethodDelete {
+		handler = a.deleteUsersUserIDFollow
+	}
+	a.middlewareAuth(handler)(rec, rq)
+	return rec
+}
+
+func TestPostUsersUserIDFollow(t *testing.T) {
+	a, f := newFakeConfig()
+	follower := signUpAndLogIn(t, a, "follower@example.com")
+	followee := signUpAndLogIn(t, a, "followee@example.com")
+
+	rec := follow(t, a, http.MethodPost, follower.Id, followee.Id)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("follow status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if !f.state.follows[fakePair{follower.Id, followee.Id}] {
+		t.Errorf("follow not recorded")
+	}
+
+	rec = follow(t, a, http.MethodPost, follower.Id, uuid.New())
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("follow unknown user status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = follow(t, a, http.MethodDelete, follower.Id, followee.Id)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unfollow status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if f.state.follows[fakePair{follower.Id, followee.Id}] {
+		t.Errorf("follow still recorded after unfollowing")
+	}
+}
+
+func TestPostUsersUserIDFollowSelf(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	rec := follow(t, a, http.MethodPost, u.Id, u.Id)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("follow self status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if len(f.state.follows) != 0 {
+		t.Errorf("follows = %d, want 0", len(f.state.follows))
+	}
+}
+
+func TestGetFeed(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	followed := signUpAndLogIn(t, a, "followed@example.com")
+	stranger := signUpAndLogIn(t, a, "stranger@example.com")
+
+	_, want := postChirp(t, a, followed.Token, `{"body":"followed"}`)
+	postChirp(t, a, stranger.Token, `{"body":"stranger"}`)
+	postChirp(t, a, u.Token, `{"body":"own"}`)
+
+	rec := follow(t, a, http.MethodPost, u.Id, followed.Id)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("follow status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.getFeed), http.MethodGet, "/api/feed", u.Token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getFeed() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	got := []chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Id != want.Id {
+		t.Errorf("getFeed() = %+v, want only %v", got, want.Id)
+	}
+}
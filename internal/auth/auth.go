@@ -1,58 +1,195 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// DefaultCost is the bcrypt cost new password hashes are created with.
+const DefaultCost = bcrypt.DefaultCost
+
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword(
-		[]byte(password),
-		bcrypt.DefaultCost,
-	)
+	return HashPasswordWithCost(password, DefaultCost)
+}
+
+// HashPasswordWithCost hashes password with the given bcrypt cost, which must
+// be between bcrypt.MinCost and bcrypt.MaxCost.
+func HashPasswordWithCost(password string, cost int) (string, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", fmt.Errorf(
+			"HashPasswordWithCost: %w",
+			bcrypt.InvalidCostError(cost),
+		)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
-		return "", fmt.Errorf("HashPassword: %w", err)
+		return "", fmt.Errorf("HashPasswordWithCost: %w", err)
 	}
 
 	return string(hash), nil
 }
 
+const DefaultMinPasswordLength = 8
+
+// ValidatePasswordStrength requires pw to be at least minLength characters
+// long and to mix letters with digits or symbols.
+func ValidatePasswordStrength(pw string, minLength int) error {
+	if utf8.RuneCountInString(pw) < minLength {
+		return fmt.Errorf(
+			"password must be at least %d characters long",
+			minLength,
+		)
+	}
+
+	hasLetter := strings.IndexFunc(pw, unicode.IsLetter) != -1
+	hasOther := strings.IndexFunc(pw, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsSpace(r)
+	}) != -1
+	if !hasLetter || !hasOther {
+		return fmt.Errorf(
+			"password must contain a letter and a number or symbol",
+		)
+	}
+
+	return nil
+}
+
 func CheckPasswordHash(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
+// NeedsRehash reports whether hash was created with a bcrypt cost below cost
+// and should be replaced the next time the password is known. Hashes bcrypt
+// can't parse are left alone, since they can never match a password anyway.
+func NeedsRehash(hash string, cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+	return hashCost < cost
+}
+
+func ValidateEmail(email string) error {
+	if email == "" {
+		return fmt.Errorf("No email provided")
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return fmt.Errorf("ValidateEmail: %w", err)
+	}
+
+	// ParseAddress also accepts "Name <user@host>"; only a bare address is
+	// allowed here.
+	if addr.Address != email {
+		return fmt.Errorf("Invalid email address: %s", email)
+	}
+
+	return nil
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// DefaultAudience is the aud claim used when a deployment doesn't configure
+// its own.
+const DefaultAudience = "chirpy"
+
+// MakeJWT signs an access token for userID. audience is written to the aud
+// claim so the token is only accepted by deployments expecting it, even if
+// they share tokenSecret.
 func MakeJWT(
 	userID uuid.UUID,
 	tokenSecret string,
+	audience string,
 	expiresIn time.Duration,
 ) (string, error) {
+	tokenString, _, err := MakeJWTWithExpiry(
+		userID,
+		tokenSecret,
+		audience,
+		expiresIn,
+	)
+	return tokenString, err
+}
+
+// MakeJWTWithExpiry signs a token like MakeJWT and also returns its exp claim,
+// truncated to the claim's precision, so callers can report it to clients.
+func MakeJWTWithExpiry(
+	userID uuid.UUID,
+	tokenSecret string,
+	audience string,
+	expiresIn time.Duration,
+) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := jwt.NewNumericDate(now.Add(expiresIn))
 	tok := jwt.NewWithClaims(
 		jwt.SigningMethodHS256,
 		jwt.RegisteredClaims{
 			Issuer:    "chirpy",
-			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: expiresAt,
 			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{audience},
+			ID:        uuid.NewString(),
 		},
 	)
 
 	tokenString, err := tok.SignedString([]byte(tokenSecret))
 	if err != nil {
-		return "", fmt.Errorf("MakeJWT: %w", err)
+		return "", time.Time{}, fmt.Errorf("MakeJWTWithExpiry: %w", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expiresAt.UTC(), nil
+}
+
+var (
+	// ErrTokenExpired means the token was genuine but is past its exp claim,
+	// so the client should refresh it rather than log in again.
+	ErrTokenExpired = errors.New("Token expired")
+	// ErrTokenInvalid means the token is malformed, has a bad signature or
+	// doesn't carry the claims chirpy issues.
+	ErrTokenInvalid = errors.New("Token invalid")
+)
+
+// ValidateJWT returns the user the token was issued to. Tokens whose aud claim
+// doesn't include audience are rejected. Errors wrap ErrTokenExpired or
+// ErrTokenInvalid.
+func ValidateJWT(
+	tokenString,
+	tokenSecret,
+	audience string,
+) (uuid.UUID, error) {
+	userID, _, err := ValidateJWTWithID(tokenString, tokenSecret, audience)
+	return userID, err
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ValidateJWTWithID validates tokenString like ValidateJWT and additionally
+// returns the token's jti claim so callers can check it against a deny-list.
+// Tokens minted without a jti return an empty ID.
+func ValidateJWTWithID(
+	tokenString,
+	tokenSecret,
+	audience string,
+) (uuid.UUID, string, error) {
 	claims := jwt.RegisteredClaims{}
 	tok, err := jwt.ParseWithClaims(
 		tokenString,
@@ -60,65 +197,204 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		func(token *jwt.Token) (any, error) {
 			return []byte(tokenSecret), nil
 		},
+		jwt.WithAudience(audience),
 	)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("ValidateJWT: %w", err)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return uuid.Nil, "", fmt.Errorf(
+			"ValidateJWTWithID: %w: %w",
+			ErrTokenExpired,
+			err,
+		)
+	} else if err != nil {
+		return uuid.Nil, "", fmt.Errorf(
+			"ValidateJWTWithID: %w: %w",
+			ErrTokenInvalid,
+			err,
+		)
 	}
 
 	uuidString, err := tok.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("ValidateJWT: %w", err)
+		return uuid.Nil, "", fmt.Errorf(
+			"ValidateJWTWithID: %w: %w",
+			ErrTokenInvalid,
+			err,
+		)
 	}
 
 	issuer, err := tok.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("ValidateJWT: %w", err)
+		return uuid.Nil, "", fmt.Errorf(
+			"ValidateJWTWithID: %w: %w",
+			ErrTokenInvalid,
+			err,
+		)
 	}
 
 	if issuer != "chirpy" {
-		return uuid.Nil, fmt.Errorf("invalid issuer")
+		return uuid.Nil, "", fmt.Errorf(
+			"ValidateJWTWithID: %w: invalid issuer",
+			ErrTokenInvalid,
+		)
 	}
 
 	tokenUUID, err := uuid.Parse(uuidString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("ValidateJWT: %w", err)
+		return uuid.Nil, "", fmt.Errorf(
+			"ValidateJWTWithID: %w: %w",
+			ErrTokenInvalid,
+			err,
+		)
 	}
 
-	return tokenUUID, nil
+	return tokenUUID, claims.ID, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
-	tokenString := headers.Get("Authorization")
-	if tokenString == "" {
+	header := strings.TrimSpace(headers.Get("Authorization"))
+	if header == "" {
 		return "", fmt.Errorf("No token string provided")
-	} else if !strings.HasPrefix(tokenString, "Bearer") {
+	}
+
+	// RFC 6750 auth schemes are case-insensitive.
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
 		return "", fmt.Errorf("No bearer token provided")
 	}
 
-	tokenString = strings.TrimSpace(strings.TrimPrefix(tokenString, "Bearer "))
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("No token string provided")
+	}
 
-	return tokenString, nil
+	return token, nil
 }
 
+const (
+	// DefaultRefreshTokenBytes is how much randomness MakeRefreshToken uses.
+	DefaultRefreshTokenBytes = 32
+	// MinRefreshTokenBytes is the shortest length
+	// MakeRefreshTokenWithLength accepts.
+	MinRefreshTokenBytes = 16
+)
+
+// randReader is the source of refresh token bytes. Tests replace it to
+// simulate a failing RNG.
+var randReader io.Reader = rand.Reader
+
 func MakeRefreshToken() (string, error) {
-	byteToken := make([]byte, 32)
+	return MakeRefreshTokenWithLength(DefaultRefreshTokenBytes)
+}
+
+// MakeRefreshTokenWithLength returns n random bytes as unpadded base64url, so
+// the token is 4n/3 characters rounded up. Tokens issued before this were
+// hex and keep working, since they're only ever compared as strings.
+func MakeRefreshTokenWithLength(n int) (string, error) {
+	if n < MinRefreshTokenBytes {
+		return "", fmt.Errorf(
+			"MakeRefreshTokenWithLength: %d bytes is fewer than %d",
+			n,
+			MinRefreshTokenBytes,
+		)
+	}
+
+	b := make([]byte, n)
+	_, err := io.ReadFull(randReader, b)
+	if err != nil {
+		return "", fmt.Errorf("MakeRefreshTokenWithLength: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func MakeInviteCode() (string, error) {
+	byteCode := make([]byte, 16)
+
+	_, err := rand.Read(byteCode)
+	if err != nil {
+		return "", fmt.Errorf("MakeInviteCode: %w", err)
+	}
+
+	return hex.EncodeToString(byteCode), nil
+}
+
+// MakeVerificationToken returns a random token for confirming an email
+// address.
+func MakeVerificationToken() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("MakeVerificationToken: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
 
-	rand.Read(byteToken)
+// MakeAPIKey returns a random key a user can hand to a service integration in
+// place of an access token.
+func MakeAPIKey() (string, error) {
+	b := make([]byte, 32)
 
-	refreshToken := hex.EncodeToString(byteToken)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("MakeAPIKey: %w", err)
+	}
 
-	return refreshToken, nil
+	return hex.EncodeToString(b), nil
 }
 
+// HashAPIKey returns the digest API keys are stored and looked up by, so a
+// leaked database doesn't leak usable keys. The keys are random enough that
+// a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAPIKey extracts the key from an "Authorization: ApiKey <key>" header.
 func GetAPIKey(headers http.Header) (string, error) {
-	tokenString := headers.Get("Authorization")
-	if tokenString == "" {
+	header := strings.TrimSpace(headers.Get("Authorization"))
+	if header == "" {
 		return "", fmt.Errorf("No apikey provided")
-	} else if !strings.HasPrefix(tokenString, "ApiKey") {
+	}
+
+	scheme, key, _ := strings.Cut(header, " ")
+	if scheme != "ApiKey" {
+		return "", fmt.Errorf("Malformed authorization header: expected ApiKey")
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
 		return "", fmt.Errorf("No apikey provided")
 	}
 
-	tokenString = strings.TrimSpace(strings.TrimPrefix(tokenString, "ApiKey "))
+	return key, nil
+}
+
+// SignHMAC returns the hex-encoded HMAC-SHA256 of body keyed with secret.
+func SignHMAC(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHMAC checks in constant time that signature is the SignHMAC of body.
+func VerifyHMAC(body []byte, signature, secret string) error {
+	if signature == "" {
+		return fmt.Errorf("No signature provided")
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("VerifyHMAC: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("Signature mismatch")
+	}
 
-	return tokenString, nil
+	return nil
 }
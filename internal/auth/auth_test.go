@@ -1,10 +1,15 @@
 package auth
 
 import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCheckPasswordHash(t *testing.T) {
@@ -64,7 +69,7 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	validToken, _ := MakeJWT(userID, "secret", DefaultAudience, time.Hour)
 
 	tests := []struct {
 		name        string
@@ -98,7 +103,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret, DefaultAudience)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -109,3 +114,633 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeInviteCode(t *testing.T) {
+	code1, err := MakeInviteCode()
+	if err != nil {
+		t.Fatalf("MakeInviteCode() error = %v", err)
+	}
+	code2, err := MakeInviteCode()
+	if err != nil {
+		t.Fatalf("MakeInviteCode() error = %v", err)
+	}
+
+	if len(code1) != 32 {
+		t.Errorf("MakeInviteCode() len = %d, want 32", len(code1))
+	}
+	if code1 == code2 {
+		t.Errorf("MakeInviteCode() returned the same code twice: %s", code1)
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{
+			name:    "Valid email",
+			email:   "foo@bar.com",
+			wantErr: false,
+		},
+		{
+			name:    "Uppercase email",
+			email:   "Foo@Bar.com",
+			wantErr: false,
+		},
+		{
+			name:    "Empty email",
+			email:   "",
+			wantErr: true,
+		},
+		{
+			name:    "Missing @",
+			email:   "notanemail",
+			wantErr: true,
+		},
+		{
+			name:    "Missing local part",
+			email:   "@bar.com",
+			wantErr: true,
+		},
+		{
+			name:    "Display name",
+			email:   "Foo <foo@bar.com>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{
+			name:  "Already lowercase",
+			email: "foo@bar.com",
+			want:  "foo@bar.com",
+		},
+		{
+			name:  "Uppercase",
+			email: "Foo@Bar.com",
+			want:  "foo@bar.com",
+		},
+		{
+			name:  "Surrounding whitespace",
+			email: "  foo@bar.com ",
+			want:  "foo@bar.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeEmail(tt.email); got != tt.want {
+				t.Errorf("NormalizeEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJWTExpired(t *testing.T) {
+	userID := uuid.New()
+	tokenString, err := MakeJWT(userID, "secret", DefaultAudience, time.Millisecond)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	// exp is stored with one-second precision, so wait past the next tick.
+	time.Sleep(1100 * time.Millisecond)
+
+	if _, err := ValidateJWT(tokenString, "secret", DefaultAudience); err == nil {
+		t.Errorf("ValidateJWT() accepted a token after it expired")
+	}
+}
+
+func TestHashPasswordWithCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		cost    int
+		wantErr bool
+	}{
+		{
+			name: "Minimum cost",
+			cost: bcrypt.MinCost,
+		},
+		{
+			name: "Custom cost",
+			cost: bcrypt.MinCost + 1,
+		},
+		{
+			name:    "Below minimum",
+			cost:    bcrypt.MinCost - 1,
+			wantErr: true,
+		},
+		{
+			name:    "Above maximum",
+			cost:    bcrypt.MaxCost + 1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := HashPasswordWithCost("correctPassword123!", tt.cost)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HashPasswordWithCost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			cost, err := bcrypt.Cost([]byte(hash))
+			if err != nil {
+				t.Fatalf("bcrypt.Cost() error = %v", err)
+			}
+			if cost != tt.cost {
+				t.Errorf("HashPasswordWithCost() cost = %d, want %d", cost, tt.cost)
+			}
+			if CheckPasswordHash("correctPassword123!", hash) != nil {
+				t.Errorf("HashPasswordWithCost() hash doesn't match the password")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	lowCost, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	current, _ := bcrypt.GenerateFromPassword([]byte("pw"), DefaultCost)
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{
+			name: "Low cost hash",
+			hash: string(lowCost),
+			want: true,
+		},
+		{
+			name: "Current cost hash",
+			hash: string(current),
+			want: false,
+		},
+		{
+			name: "Not a bcrypt hash",
+			hash: "plaintext",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.hash, DefaultCost); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJWTErrors(t *testing.T) {
+	userID := uuid.New()
+	expired, _ := MakeJWT(userID, "secret", DefaultAudience, -time.Minute)
+	valid, _ := MakeJWT(userID, "secret", DefaultAudience, time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		wantErr error
+	}{
+		{
+			name:    "Expired token",
+			token:   expired,
+			secret:  "secret",
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "Signature mismatch",
+			token:   valid,
+			secret:  "wrong_secret",
+			wantErr: ErrTokenInvalid,
+		},
+		{
+			name:    "Malformed token",
+			token:   "not.a.jwt",
+			secret:  "secret",
+			wantErr: ErrTokenInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(tt.token, tt.secret, DefaultAudience)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateJWT() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJWTWithID(t *testing.T) {
+	userID := uuid.New()
+	token1, _ := MakeJWT(userID, "secret", DefaultAudience, time.Hour)
+	token2, _ := MakeJWT(userID, "secret", DefaultAudience, time.Hour)
+
+	gotUserID, jti1, err := ValidateJWTWithID(token1, "secret", DefaultAudience)
+	if err != nil {
+		t.Fatalf("ValidateJWTWithID() error = %v", err)
+	}
+	if gotUserID != userID {
+		t.Errorf("ValidateJWTWithID() gotUserID = %v, want %v", gotUserID, userID)
+	}
+	if jti1 == "" {
+		t.Errorf("ValidateJWTWithID() returned an empty jti")
+	}
+
+	_, jti2, err := ValidateJWTWithID(token2, "secret", DefaultAudience)
+	if err != nil {
+		t.Fatalf("ValidateJWTWithID() error = %v", err)
+	}
+	if jti1 == jti2 {
+		t.Errorf("MakeJWT() issued two tokens with the same jti %s", jti1)
+	}
+
+	_, jti, err := ValidateJWTWithID(token1, "wrong_secret", DefaultAudience)
+	if err == nil || jti != "" {
+		t.Errorf("ValidateJWTWithID() with wrong secret = %q, %v", jti, err)
+	}
+}
+
+func TestValidateJWTAudience(t *testing.T) {
+	userID := uuid.New()
+	token, _ := MakeJWT(userID, "secret", "chirpy-staging", time.Hour)
+
+	tests := []struct {
+		name     string
+		audience string
+		wantErr  error
+	}{
+		{
+			name:     "Matching audience",
+			audience: "chirpy-staging",
+			wantErr:  nil,
+		},
+		{
+			name:     "Mismatched audience",
+			audience: "chirpy-production",
+			wantErr:  ErrTokenInvalid,
+		},
+		{
+			name:     "Default audience",
+			audience: DefaultAudience,
+			wantErr:  ErrTokenInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID, err := ValidateJWT(token, "secret", tt.audience)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateJWT() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && gotUserID != userID {
+				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, userID)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		minLength int
+		wantErr   bool
+	}{
+		{
+			name:      "Acceptable password",
+			password:  "correctPassword123!",
+			minLength: DefaultMinPasswordLength,
+			wantErr:   false,
+		},
+		{
+			name:      "Letters and a symbol",
+			password:  "hunter-two",
+			minLength: DefaultMinPasswordLength,
+			wantErr:   false,
+		},
+		{
+			name:      "Empty password",
+			password:  "",
+			minLength: DefaultMinPasswordLength,
+			wantErr:   true,
+		},
+		{
+			name:      "Too short",
+			password:  "ab1!",
+			minLength: DefaultMinPasswordLength,
+			wantErr:   true,
+		},
+		{
+			name:      "Only letters",
+			password:  "passwordpassword",
+			minLength: DefaultMinPasswordLength,
+			wantErr:   true,
+		},
+		{
+			name:      "Only digits",
+			password:  "1234567890",
+			minLength: DefaultMinPasswordLength,
+			wantErr:   true,
+		},
+		{
+			name:      "Custom minimum length",
+			password:  "abc123",
+			minLength: 12,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePasswordStrength(tt.password, tt.minLength)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePasswordStrength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key1, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+	key2, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+
+	if len(key1) != 64 {
+		t.Errorf("MakeAPIKey() len = %d, want 64", len(key1))
+	}
+	if key1 == key2 {
+		t.Errorf("MakeAPIKey() returned the same key twice: %s", key1)
+	}
+	if HashAPIKey(key1) != HashAPIKey(key1) {
+		t.Errorf("HashAPIKey() isn't deterministic")
+	}
+	if HashAPIKey(key1) == HashAPIKey(key2) || HashAPIKey(key1) == key1 {
+		t.Errorf("HashAPIKey() = %s, want a distinct hash", HashAPIKey(key1))
+	}
+}
+
+func TestGetAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantKey string
+		wantErr bool
+	}{
+		{
+			name:    "Valid key",
+			header:  "ApiKey f271c81ff7084ee5b99a5091b42d486e",
+			wantKey: "f271c81ff7084ee5b99a5091b42d486e",
+			wantErr: false,
+		},
+		{
+			name:    "Extra whitespace",
+			header:  "  ApiKey    f271c81ff7084ee5b99a5091b42d486e  ",
+			wantKey: "f271c81ff7084ee5b99a5091b42d486e",
+			wantErr: false,
+		},
+		{
+			name:    "Empty header",
+			header:  "",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong scheme",
+			header:  "Bearer f271c81ff7084ee5b99a5091b42d486e",
+			wantErr: true,
+		},
+		{
+			name:    "Scheme without separator",
+			header:  "ApiKeyf271c81ff7084ee5b99a5091b42d486e",
+			wantErr: true,
+		},
+		{
+			name:    "Scheme without key",
+			header:  "ApiKey   ",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.header != "" {
+				headers.Set("Authorization", tt.header)
+			}
+
+			gotKey, err := GetAPIKey(headers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotKey != tt.wantKey {
+				t.Errorf("GetAPIKey() = %q, want %q", gotKey, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	secret := "polka-signing-secret"
+	valid := SignHMAC(body, secret)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		wantErr   bool
+	}{
+		{
+			name:      "Valid signature",
+			body:      body,
+			signature: valid,
+			wantErr:   false,
+		},
+		{
+			name:      "Tampered body",
+			body:      []byte(`{"event":"user.downgraded"}`),
+			signature: valid,
+			wantErr:   true,
+		},
+		{
+			name:      "Wrong secret",
+			body:      body,
+			signature: SignHMAC(body, "other-secret"),
+			wantErr:   true,
+		},
+		{
+			name:      "Not hex",
+			body:      body,
+			signature: "not-a-signature",
+			wantErr:   true,
+		},
+		{
+			name:      "Empty signature",
+			body:      body,
+			signature: "",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyHMAC(tt.body, tt.signature, secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyHMAC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantToken string
+		wantErr   bool
+	}{
+		{
+			name:      "Valid token",
+			header:    "Bearer abc.def.ghi",
+			wantToken: "abc.def.ghi",
+			wantErr:   false,
+		},
+		{
+			name:      "Lowercase scheme",
+			header:    "bearer abc.def.ghi",
+			wantToken: "abc.def.ghi",
+			wantErr:   false,
+		},
+		{
+			name:      "Extra whitespace",
+			header:    "  Bearer    abc.def.ghi  ",
+			wantToken: "abc.def.ghi",
+			wantErr:   false,
+		},
+		{
+			name:    "Basic scheme",
+			header:  "Basic dXNlcjpwYXNz",
+			wantErr: true,
+		},
+		{
+			name:    "Missing scheme",
+			header:  "abc.def.ghi",
+			wantErr: true,
+		},
+		{
+			name:    "Scheme without separator",
+			header:  "Bearerabc.def.ghi",
+			wantErr: true,
+		},
+		{
+			name:    "Empty token",
+			header:  "Bearer   ",
+			wantErr: true,
+		},
+		{
+			name:    "Empty header",
+			header:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.header != "" {
+				headers.Set("Authorization", tt.header)
+			}
+
+			gotToken, err := GetBearerToken(headers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetBearerToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotToken != tt.wantToken {
+				t.Errorf("GetBearerToken() = %q, want %q", gotToken, tt.wantToken)
+			}
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy unavailable")
+}
+
+func TestMakeRefreshTokenWithLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		bytes   int
+		wantLen int
+		wantErr bool
+	}{
+		{name: "Default", bytes: DefaultRefreshTokenBytes, wantLen: 43},
+		{name: "Minimum", bytes: MinRefreshTokenBytes, wantLen: 22},
+		{name: "Longer", bytes: 48, wantLen: 64},
+		{name: "Too short", bytes: MinRefreshTokenBytes - 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := MakeRefreshTokenWithLength(tt.bytes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MakeRefreshTokenWithLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(token) != tt.wantLen {
+				t.Errorf("MakeRefreshTokenWithLength() len = %d, want %d", len(token), tt.wantLen)
+			}
+			raw, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil || len(raw) != tt.bytes {
+				t.Errorf("MakeRefreshTokenWithLength() = %q, want %d bytes of base64url", token, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestMakeRefreshTokenRNGFailure(t *testing.T) {
+	orig := randReader
+	randReader = failingReader{}
+	defer func() { randReader = orig }()
+
+	token, err := MakeRefreshToken()
+	if err == nil {
+		t.Fatalf("MakeRefreshToken() = %q, want an error", token)
+	}
+	if !strings.Contains(err.Error(), "entropy unavailable") {
+		t.Errorf("MakeRefreshToken() error = %v, want the reader's error", err)
+	}
+}
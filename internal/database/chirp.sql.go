@@ -7,23 +7,32 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of, parent_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4)
+RETURNING id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+	QuoteOf  uuid.NullUUID
+	ParentID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.QuoteOf,
+		arg.ParentID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +40,10 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -47,8 +60,9 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
 FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -67,6 +81,68 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllChirpsPaged = `-- name: GetAllChirpsPaged :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE deleted_at IS NULL
+ORDER BY
+    CASE WHEN $1::text = 'updated_at' AND $2::boolean
+        THEN updated_at END DESC,
+    CASE WHEN $1::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN $2::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT $4 OFFSET $3
+`
+
+type GetAllChirpsPagedParams struct {
+	SortBy    string
+	SortDesc  bool
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetAllChirpsPaged(ctx context.Context, arg GetAllChirpsPagedParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsPaged,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -82,9 +158,9 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
 FROM chirps
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -96,14 +172,334 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getChirpAuthors = `-- name: GetChirpAuthors :many
+SELECT DISTINCT users.id, users.email, users.is_chirpy_red
+FROM users
+JOIN chirps ON chirps.user_id = users.id
+WHERE chirps.id = ANY($1::uuid[])
+`
+
+type GetChirpAuthorsRow struct {
+	ID          uuid.UUID
+	Email       string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetChirpAuthors(ctx context.Context, chirpIds []uuid.UUID) ([]GetChirpAuthorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAuthors, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAuthorsRow
+	for rows.Next() {
+		var i GetChirpAuthorsRow
+		if err := rows.Scan(&i.ID, &i.Email, &i.IsChirpyRed); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpCount = `-- name: GetChirpCount :one
+SELECT COUNT(*)
+FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+    AND (
+        $2::text IS NULL
+        OR body ILIKE '%' || $2::text || '%'
+    )
+    AND ($3::timestamp IS NULL OR created_at >= $3)
+    AND ($4::timestamp IS NULL OR created_at <= $4)
+    AND deleted_at IS NULL
+`
+
+type GetChirpCountParams struct {
+	UserID    uuid.NullUUID
+	Term      sql.NullString
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+}
+
+func (q *Queries) GetChirpCount(ctx context.Context, arg GetChirpCountParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getChirpCount,
+		arg.UserID,
+		arg.Term,
+		arg.StartTime,
+		arg.EndTime,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getChirpReplies = `-- name: GetChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE parent_id = $1::uuid AND deleted_at IS NULL
+ORDER BY created_at ASC
+LIMIT $3 OFFSET $2
+`
+
+type GetChirpRepliesParams struct {
+	ParentID  uuid.UUID
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpReplies(ctx context.Context, arg GetChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies, arg.ParentID, arg.RowOffset, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsBefore = `-- name: GetChirpsBefore :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+    AND (
+        $2::text IS NULL
+        OR body ILIKE '%' || $2::text || '%'
+    )
+    AND ($3::timestamp IS NULL OR created_at >= $3)
+    AND ($4::timestamp IS NULL OR created_at <= $4)
+    AND (
+        $5::timestamp IS NULL
+        OR $6::uuid IS NULL
+        OR (created_at, id) < ($5, $6)
+    )
+    AND deleted_at IS NULL
+ORDER BY created_at DESC, id DESC
+LIMIT $7
+`
+
+type GetChirpsBeforeParams struct {
+	UserID          uuid.NullUUID
+	Term            sql.NullString
+	StartTime       sql.NullTime
+	EndTime         sql.NullTime
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) GetChirpsBefore(ctx context.Context, arg GetChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsBefore,
+		arg.UserID,
+		arg.Term,
+		arg.StartTime,
+		arg.EndTime,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByCreatedAtRange = `-- name: GetChirpsByCreatedAtRange :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+    AND ($2::timestamp IS NULL OR created_at >= $2)
+    AND ($3::timestamp IS NULL OR created_at <= $3)
+    AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN $4::text = 'updated_at' AND $5::boolean
+        THEN updated_at END DESC,
+    CASE WHEN $4::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN $5::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT $7 OFFSET $6
+`
+
+type GetChirpsByCreatedAtRangeParams struct {
+	UserID    uuid.NullUUID
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+	SortBy    string
+	SortDesc  bool
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpsByCreatedAtRange(ctx context.Context, arg GetChirpsByCreatedAtRangeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByCreatedAtRange,
+		arg.UserID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpsByUserID = `-- name: GetChirpsByUserID :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
 FROM chirps
-WHERE user_id = $1
+WHERE user_id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -121,6 +517,151 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByUserIDPaged = `-- name: GetChirpsByUserIDPaged :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN $2::text = 'updated_at' AND $3::boolean
+        THEN updated_at END DESC,
+    CASE WHEN $2::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN $3::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT $5 OFFSET $4
+`
+
+type GetChirpsByUserIDPagedParams struct {
+	UserID    uuid.UUID
+	SortBy    string
+	SortDesc  bool
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpsByUserIDPaged(ctx context.Context, arg GetChirpsByUserIDPagedParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserIDPaged,
+		arg.UserID,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementQuoteCount = `-- name: IncrementQuoteCount :exec
+UPDATE chirps
+SET quote_count = quote_count + 1
+WHERE id = $1
+`
+
+func (q *Queries) IncrementQuoteCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, incrementQuoteCount, id)
+	return err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE body ILIKE '%' || $1::text || '%'
+    AND ($2::uuid IS NULL OR user_id = $2)
+    AND ($3::timestamp IS NULL OR created_at >= $3)
+    AND ($4::timestamp IS NULL OR created_at <= $4)
+    AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN $5::text = 'updated_at' AND $6::boolean
+        THEN updated_at END DESC,
+    CASE WHEN $5::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN $6::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT $8 OFFSET $7
+`
+
+type SearchChirpsParams struct {
+	Term      string
+	UserID    uuid.NullUUID
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+	SortBy    string
+	SortDesc  bool
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Term,
+		arg.UserID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -134,3 +675,73 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	return err
+}
+
+const softDeleteChirpsByUserID = `-- name: SoftDeleteChirpsByUserID :many
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND deleted_at IS NULL
+RETURNING id
+`
+
+func (q *Queries) SoftDeleteChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, softDeleteChirpsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+`
+
+type UpdateChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
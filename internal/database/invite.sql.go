@@ -0,0 +1,65 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: invite.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createInvite = `-- name: CreateInvite :one
+INSERT INTO invites (code, created_at)
+VALUES ($1, NOW())
+RETURNING code, created_at, used_at, used_by
+`
+
+func (q *Queries) CreateInvite(ctx context.Context, code string) (Invite, error) {
+	row := q.db.QueryRowContext(ctx, createInvite, code)
+	var i Invite
+	err := row.Scan(
+		&i.Code,
+		&i.CreatedAt,
+		&i.UsedAt,
+		&i.UsedBy,
+	)
+	return i, err
+}
+
+const setInviteUsedBy = `-- name: SetInviteUsedBy :exec
+UPDATE invites
+SET used_by = $2
+WHERE code = $1
+`
+
+type SetInviteUsedByParams struct {
+	Code   string
+	UsedBy uuid.NullUUID
+}
+
+func (q *Queries) SetInviteUsedBy(ctx context.Context, arg SetInviteUsedByParams) error {
+	_, err := q.db.ExecContext(ctx, setInviteUsedBy, arg.Code, arg.UsedBy)
+	return err
+}
+
+const useInvite = `-- name: UseInvite :one
+UPDATE invites
+SET used_at = NOW()
+WHERE code = $1 AND used_at IS NULL
+RETURNING code, created_at, used_at, used_by
+`
+
+func (q *Queries) UseInvite(ctx context.Context, code string) (Invite, error) {
+	row := q.db.QueryRowContext(ctx, useInvite, code)
+	var i Invite
+	err := row.Scan(
+		&i.Code,
+		&i.CreatedAt,
+		&i.UsedAt,
+		&i.UsedBy,
+	)
+	return i, err
+}
@@ -0,0 +1,142 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: like.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const getChirpLikeCount = `-- name: GetChirpLikeCount :one
+SELECT COUNT(*)
+FROM chirp_likes
+WHERE chirp_id = $1
+`
+
+func (q *Queries) GetChirpLikeCount(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getChirpLikeCount, chirpID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getChirpLikeCounts = `-- name: GetChirpLikeCounts :many
+SELECT chirp_id, COUNT(*)
+FROM chirp_likes
+WHERE chirp_id = ANY($1::uuid[])
+GROUP BY chirp_id
+`
+
+type GetChirpLikeCountsRow struct {
+	ChirpID uuid.UUID
+	Count   int64
+}
+
+func (q *Queries) GetChirpLikeCounts(ctx context.Context, chirpIds []uuid.UUID) ([]GetChirpLikeCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpLikeCounts, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpLikeCountsRow
+	for rows.Next() {
+		var i GetChirpLikeCountsRow
+		if err := rows.Scan(&i.ChirpID, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLikedChirps = `-- name: GetLikedChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count, chirps.parent_id, chirps.deleted_at
+FROM chirps
+JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id
+WHERE chirp_likes.user_id = $1
+    AND chirps.deleted_at IS NULL
+ORDER BY chirp_likes.created_at DESC
+LIMIT $3 OFFSET $2
+`
+
+type GetLikedChirpsParams struct {
+	UserID    uuid.UUID
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetLikedChirps(ctx context.Context, arg GetLikedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getLikedChirps, arg.UserID, arg.RowOffset, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const likeChirp = `-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING
+`
+
+type LikeChirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) LikeChirp(ctx context.Context, arg LikeChirpParams) error {
+	_, err := q.db.ExecContext(ctx, likeChirp, arg.UserID, arg.ChirpID)
+	return err
+}
+
+const unlikeChirp = `-- name: UnlikeChirp :exec
+DELETE
+FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2
+`
+
+type UnlikeChirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) UnlikeChirp(ctx context.Context, arg UnlikeChirpParams) error {
+	_, err := q.db.ExecContext(ctx, unlikeChirp, arg.UserID, arg.ChirpID)
+	return err
+}
@@ -11,12 +11,64 @@ import (
 	"github.com/google/uuid"
 )
 
-type Chirp struct {
+type ApiKey struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
 	UserID    uuid.UUID
+	KeyHash   string
+	RevokedAt sql.NullTime
+}
+
+type AuditLog struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ActorID   uuid.NullUUID
+	Action    string
+	Target    string
+}
+
+type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	QuoteOf    uuid.NullUUID
+	QuoteCount int32
+	ParentID   uuid.NullUUID
+	DeletedAt  sql.NullTime
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	Token     string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Invite struct {
+	Code      string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+	UsedBy    uuid.NullUUID
+}
+
+type ProcessedWebhook struct {
+	ID          string
+	Event       string
+	ProcessedAt time.Time
 }
 
 type RefreshToken struct {
@@ -26,13 +78,24 @@ type RefreshToken struct {
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	UserAgent string
+	IpAddress string
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	CreatedAt time.Time
+	UserID    uuid.UUID
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	EmailVerified    bool
+	FailedLoginCount int32
+	LockedUntil      sql.NullTime
 }
@@ -0,0 +1,96 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: verification.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const consumeEmailVerificationToken = `-- name: ConsumeEmailVerificationToken :one
+DELETE
+FROM email_verification_tokens
+WHERE token = $1 AND user_id = $2
+RETURNING token, created_at, user_id, expires_at
+`
+
+type ConsumeEmailVerificationTokenParams struct {
+	Token  string
+	UserID uuid.UUID
+}
+
+func (q *Queries) ConsumeEmailVerificationToken(ctx context.Context, arg ConsumeEmailVerificationTokenParams) (EmailVerificationToken, error) {
+	row := q.db.QueryRowContext(ctx, consumeEmailVerificationToken, arg.Token, arg.UserID)
+	var i EmailVerificationToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const createEmailVerificationToken = `-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token, created_at, user_id, expires_at)
+VALUES ($1, NOW(), $2, $3)
+RETURNING token, created_at, user_id, expires_at
+`
+
+type CreateEmailVerificationTokenParams struct {
+	Token     string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateEmailVerificationToken(ctx context.Context, arg CreateEmailVerificationTokenParams) (EmailVerificationToken, error) {
+	row := q.db.QueryRowContext(ctx, createEmailVerificationToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	var i EmailVerificationToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const deleteEmailVerificationTokensForUser = `-- name: DeleteEmailVerificationTokensForUser :exec
+DELETE
+FROM email_verification_tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteEmailVerificationTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteEmailVerificationTokensForUser, userID)
+	return err
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified = TRUE, updated_at = NOW()
+WHERE id = $1
+RETURNING users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.email_verified, users.failed_login_count, users.locked_until
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+	)
+	return i, err
+}
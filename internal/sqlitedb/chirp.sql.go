@@ -0,0 +1,794 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: chirp.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const createChirp = `-- name: CreateChirp :one
+
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of, parent_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), ?1, ?2, ?3, ?4)
+RETURNING id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+`
+
+type CreateChirpParams struct {
+	Body     string
+	UserID   uuid.UUID
+	QuoteOf  uuid.NullUUID
+	ParentID uuid.NullUUID
+}
+
+// The CASTs only tell sqlc the parameter types. SQLite gives uuid and
+// TIMESTAMP numeric affinity, so they're only ever applied to parameters that
+// are checked for NULL or are plain text, booleans and integers. sqlc doesn't
+// see parameters in ORDER BY, so the sort options come in through a subquery.
+func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.QuoteOf,
+		arg.ParentID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const deleteChirp = `-- name: DeleteChirp :exec
+DELETE
+FROM chirps
+WHERE id = ?1
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+	return err
+}
+
+const getAllChirps = `-- name: GetAllChirps :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE deleted_at IS NULL
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllChirpsPaged = `-- name: GetAllChirpsPaged :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count, chirps.parent_id, chirps.deleted_at
+FROM chirps, (
+    SELECT CAST(?1 AS TEXT) AS sort_column,
+        CAST(?2 AS BOOLEAN) AS descending
+) AS opts
+WHERE deleted_at IS NULL
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(?4 AS int4)
+OFFSET CAST(?3 AS int4)
+`
+
+type GetAllChirpsPagedParams struct {
+	SortBy    string
+	SortDesc  bool
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetAllChirpsPaged(ctx context.Context, arg GetAllChirpsPagedParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsPaged,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE id = ?1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getChirpAuthors = `-- name: GetChirpAuthors :many
+SELECT DISTINCT users.id, users.email, users.is_chirpy_red
+FROM users
+JOIN chirps ON chirps.user_id = users.id
+WHERE chirps.id IN (/*SLICE:chirp_ids*/?)
+`
+
+type GetChirpAuthorsRow struct {
+	ID          uuid.UUID
+	Email       string
+	IsChirpyRed bool
+}
+
+func (q *Queries) GetChirpAuthors(ctx context.Context, chirpIds []uuid.UUID) ([]GetChirpAuthorsRow, error) {
+	query := getChirpAuthors
+	var queryParams []interface{}
+	if len(chirpIds) > 0 {
+		for _, v := range chirpIds {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:chirp_ids*/?", strings.Repeat(",?", len(chirpIds))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:chirp_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAuthorsRow
+	for rows.Next() {
+		var i GetChirpAuthorsRow
+		if err := rows.Scan(&i.ID, &i.Email, &i.IsChirpyRed); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpCount = `-- name: GetChirpCount :one
+SELECT COUNT(*)
+FROM chirps
+WHERE deleted_at IS NULL
+    AND (
+        CAST(?1 AS TEXT) IS NULL
+        OR like('%' || ?1 || '%', body, '\')
+    )
+    AND (CAST(?2 AS uuid) IS NULL OR user_id = ?2)
+    AND (CAST(?3 AS TIMESTAMP) IS NULL OR created_at >= ?3)
+    AND (CAST(?4 AS TIMESTAMP) IS NULL OR created_at <= ?4)
+`
+
+type GetChirpCountParams struct {
+	Term      sql.NullString
+	UserID    uuid.NullUUID
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+}
+
+func (q *Queries) GetChirpCount(ctx context.Context, arg GetChirpCountParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getChirpCount,
+		arg.Term,
+		arg.UserID,
+		arg.StartTime,
+		arg.EndTime,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE id = ?1 AND deleted_at IS NULL
+`
+
+// There's no FOR UPDATE: transactions begin IMMEDIATE, which takes SQLite's
+// single write lock up front.
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getChirpReplies = `-- name: GetChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE parent_id = ?1 AND deleted_at IS NULL
+ORDER BY created_at ASC
+LIMIT CAST(?3 AS int4)
+OFFSET CAST(?2 AS int4)
+`
+
+type GetChirpRepliesParams struct {
+	ParentID  uuid.NullUUID
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpReplies(ctx context.Context, arg GetChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies, arg.ParentID, arg.RowOffset, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsBefore = `-- name: GetChirpsBefore :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE deleted_at IS NULL
+    AND (CAST(?1 AS uuid) IS NULL OR user_id = ?1)
+    AND (
+        CAST(?2 AS TEXT) IS NULL
+        OR like('%' || ?2 || '%', body, '\')
+    )
+    AND (CAST(?3 AS TIMESTAMP) IS NULL OR created_at >= ?3)
+    AND (CAST(?4 AS TIMESTAMP) IS NULL OR created_at <= ?4)
+    AND (
+        CAST(?5 AS TIMESTAMP) IS NULL
+        OR CAST(?6 AS uuid) IS NULL
+        OR (created_at, id) < (?5, ?6)
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT CAST(?7 AS int4)
+`
+
+type GetChirpsBeforeParams struct {
+	UserID          uuid.NullUUID
+	Term            sql.NullString
+	StartTime       sql.NullTime
+	EndTime         sql.NullTime
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) GetChirpsBefore(ctx context.Context, arg GetChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsBefore,
+		arg.UserID,
+		arg.Term,
+		arg.StartTime,
+		arg.EndTime,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByCreatedAtRange = `-- name: GetChirpsByCreatedAtRange :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count, chirps.parent_id, chirps.deleted_at
+FROM chirps, (
+    SELECT CAST(?1 AS TEXT) AS sort_column,
+        CAST(?2 AS BOOLEAN) AS descending
+) AS opts
+WHERE deleted_at IS NULL
+    AND (CAST(?3 AS uuid) IS NULL OR user_id = ?3)
+    AND (CAST(?4 AS TIMESTAMP) IS NULL OR created_at >= ?4)
+    AND (CAST(?5 AS TIMESTAMP) IS NULL OR created_at <= ?5)
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(?7 AS int4)
+OFFSET CAST(?6 AS int4)
+`
+
+type GetChirpsByCreatedAtRangeParams struct {
+	SortBy    string
+	SortDesc  bool
+	UserID    uuid.NullUUID
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpsByCreatedAtRange(ctx context.Context, arg GetChirpsByCreatedAtRangeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByCreatedAtRange,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.UserID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE id IN (/*SLICE:ids*/?) AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	query := getChirpsByIDs
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByUserID = `-- name: GetChirpsByUserID :many
+SELECT id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+FROM chirps
+WHERE user_id = ?1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByUserIDPaged = `-- name: GetChirpsByUserIDPaged :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count, chirps.parent_id, chirps.deleted_at
+FROM chirps, (
+    SELECT CAST(?1 AS TEXT) AS sort_column,
+        CAST(?2 AS BOOLEAN) AS descending
+) AS opts
+WHERE user_id = ?3 AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(?5 AS int4)
+OFFSET CAST(?4 AS int4)
+`
+
+type GetChirpsByUserIDPagedParams struct {
+	SortBy    string
+	SortDesc  bool
+	UserID    uuid.UUID
+	RowOffset int32
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpsByUserIDPaged(ctx context.Context, arg GetChirpsByUserIDPagedParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserIDPaged,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.UserID,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementQuoteCount = `-- name: IncrementQuoteCount :exec
+UPDATE chirps
+SET quote_count = quote_count + 1
+WHERE id = ?1
+`
+
+func (q *Queries) IncrementQuoteCount(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, incrementQuoteCount, id)
+	return err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.quote_of, chirps.quote_count, chirps.parent_id, chirps.deleted_at
+FROM chirps, (
+    SELECT CAST(?1 AS TEXT) AS sort_column,
+        CAST(?2 AS BOOLEAN) AS descending
+) AS opts
+WHERE like('%' || CAST(?3 AS TEXT) || '%', body, '\')
+    AND (CAST(?4 AS uuid) IS NULL OR user_id = ?4)
+    AND (CAST(?5 AS TIMESTAMP) IS NULL OR created_at >= ?5)
+    AND (CAST(?6 AS TIMESTAMP) IS NULL OR created_at <= ?6)
+    AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(?8 AS int4)
+OFFSET CAST(?7 AS int4)
+`
+
+type SearchChirpsParams struct {
+	SortBy    string
+	SortDesc  bool
+	Term      string
+	UserID    uuid.NullUUID
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+	RowOffset int32
+	RowLimit  int32
+}
+
+// SQLite's LIKE is case-insensitive for ASCII, which stands in for ILIKE.
+// like() is LIKE ... ESCAPE, which sqlc can't parse.
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.SortBy,
+		arg.SortDesc,
+		arg.Term,
+		arg.UserID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.QuoteOf,
+			&i.QuoteCount,
+			&i.ParentID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE id = ?1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	return err
+}
+
+const softDeleteChirpsByUserID = `-- name: SoftDeleteChirpsByUserID :many
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE user_id = ?1 AND deleted_at IS NULL
+RETURNING id
+`
+
+func (q *Queries) SoftDeleteChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, softDeleteChirpsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = ?2, updated_at = NOW()
+WHERE id = ?1
+RETURNING id, created_at, updated_at, body, user_id, quote_of, quote_count, parent_id, deleted_at
+`
+
+type UpdateChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.QuoteOf,
+		&i.QuoteCount,
+		&i.ParentID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
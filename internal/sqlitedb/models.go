@@ -0,0 +1,101 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+
+package sqlitedb
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ApiKey struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	KeyHash   string
+	RevokedAt sql.NullTime
+}
+
+type AuditLog struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ActorID   uuid.NullUUID
+	Action    string
+	Target    string
+}
+
+type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	QuoteOf    uuid.NullUUID
+	QuoteCount int32
+	ParentID   uuid.NullUUID
+	DeletedAt  sql.NullTime
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	Token     string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Invite struct {
+	Code      string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+	UsedBy    uuid.NullUUID
+}
+
+type ProcessedWebhook struct {
+	ID          string
+	Event       string
+	ProcessedAt time.Time
+}
+
+type RefreshToken struct {
+	Token     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	UserAgent string
+	IpAddress string
+}
+
+type RevokedAccessToken struct {
+	Jti       string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+}
+
+type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	EmailVerified    bool
+	FailedLoginCount int32
+	LockedUntil      sql.NullTime
+}
@@ -0,0 +1,29 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webhook.sql
+
+package sqlitedb
+
+import (
+	"context"
+)
+
+const markWebhookProcessed = `-- name: MarkWebhookProcessed :execrows
+INSERT INTO processed_webhooks (id, event, processed_at)
+VALUES (?1, ?2, NOW())
+ON CONFLICT (id) DO NOTHING
+`
+
+type MarkWebhookProcessedParams struct {
+	ID    string
+	Event string
+}
+
+func (q *Queries) MarkWebhookProcessed(ctx context.Context, arg MarkWebhookProcessedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markWebhookProcessed, arg.ID, arg.Event)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+func (a *apiConfig) bodyLimit() int64 {
+	if a.maxBodyBytes <= 0 {
+		return defaultMaxBodyBytes
+	}
+	return a.maxBodyBytes
+}
+
+// decodeJSON decodes the request body into dst, reading at most maxBodyBytes.
+// Fields dst doesn't have are rejected so client typos don't go unnoticed, and
+// a body declared as anything but JSON is refused with 415. If decoding fails
+// it writes the error response itself and returns false.
+func (a *apiConfig) decodeJSON(
+	rw http.ResponseWriter,
+	rq *http.Request,
+	dst any,
+) bool {
+	return a.decodeBody(rw, rq, dst, true)
+}
+
+// decodeLenientJSON is decodeJSON for payloads whose schema we don't control,
+// where unknown fields are ignored.
+func (a *apiConfig) decodeLenientJSON(
+	rw http.ResponseWriter,
+	rq *http.Request,
+	dst any,
+) bool {
+	return a.decodeBody(rw, rq, dst, false)
+}
+
+func (a *apiConfig) decodeBody(
+	rw http.ResponseWriter,
+	rq *http.Request,
+	dst any,
+	strict bool,
+) bool {
+	if !isJSONContentType(rq) {
+		respondWithError(
+			rw,
+			http.StatusUnsupportedMediaType,
+			"unsupported content type",
+		)
+		return false
+	}
+
+	rq.Body = http.MaxBytesReader(rw, rq.Body, a.bodyLimit())
+
+	dec := json.NewDecoder(rq.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(dst)
+	if err == nil {
+		return true
+	}
+	fmt.Printf("decodeJSON %s %s: %v\n", rq.Method, rq.URL.Path, err)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(
+			rw,
+			http.StatusRequestEntityTooLarge,
+			"request body too large",
+		)
+	} else if msg, ok := decodeErrorMessage(err); ok {
+		respondWithError(rw, http.StatusBadRequest, msg)
+	} else {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	return false
+}
+
+// isJSONContentType reports whether rq's body is declared as JSON. A missing
+// Content-Type is taken to be JSON, since plenty of clients don't send one.
+func isJSONContentType(rq *http.Request) bool {
+	contentType := rq.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// decodeForm parses a form-encoded request body into rq.PostForm, reading at
+// most maxBodyBytes. If parsing fails it writes the error response itself and
+// returns false.
+func (a *apiConfig) decodeForm(rw http.ResponseWriter, rq *http.Request) bool {
+	rq.Body = http.MaxBytesReader(rw, rq.Body, a.bodyLimit())
+
+	err := rq.ParseForm()
+	if err == nil {
+		return true
+	}
+	fmt.Printf("decodeForm %s %s: %v\n", rq.Method, rq.URL.Path, err)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(
+			rw,
+			http.StatusRequestEntityTooLarge,
+			"request body too large",
+		)
+	} else {
+		respondWithError(
+			rw,
+			http.StatusBadRequest,
+			"request body is not a valid form",
+		)
+	}
+
+	return false
+}
+
+// decodeErrorMessage describes err for the client if it was caused by a bad
+// request body rather than a failure on our side.
+func decodeErrorMessage(err error) (string, bool) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return "request body is empty", true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "request body is not valid JSON", true
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf(
+			"request body is not valid JSON (at byte %d)",
+			syntaxErr.Offset,
+		), true
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this one.
+		return strings.TrimPrefix(err.Error(), "json: "), true
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf(
+			"field %q must be of type %s",
+			typeErr.Field,
+			typeErr.Type,
+		), true
+	}
+
+	return "", false
+}
+
+func respondWithJSON(rw http.ResponseWriter, code int, payload any) {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("respondWithJSON: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	rw.Write(dat)
+}
+
+func respondWithError(rw http.ResponseWriter, code int, msg string) {
+	type response struct {
+		Error string `json:"error"`
+	}
+	respondWithJSON(rw, code, response{Error: msg})
+}
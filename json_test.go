@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantOK     bool
+		wantStatus int
+	}{
+		{
+			name:       "Valid body",
+			body:       `{"body":"hello"}`,
+			wantOK:     true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Malformed JSON",
+			body:       `{"body":`,
+			wantOK:     false,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Syntax error",
+			body:       `{body: hello}`,
+			wantOK:     false,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty body",
+			body:       ``,
+			wantOK:     false,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Wrong field type",
+			body:       `{"body":42}`,
+			wantOK:     false,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown field",
+			body:       `{"body":"hello","bdoy":"typo"}`,
+			wantOK:     false,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Oversized body",
+			body:       `{"body":"` + strings.Repeat("a", 64) + `"}`,
+			wantOK:     false,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &apiConfig{maxBodyBytes: 32}
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(tt.body))
+
+			dst := struct {
+				Body string `json:"body"`
+			}{}
+			ok := a.decodeJSON(rec, rq, &dst)
+
+			if ok != tt.wantOK {
+				t.Fatalf("decodeJSON() = %v, want %v", ok, tt.wantOK)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("decodeJSON() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ok && dst.Body != "hello" {
+				t.Errorf("decodeJSON() body = %q, want %q", dst.Body, "hello")
+			}
+		})
+	}
+}
+
+func TestDecodeLenientJSON(t *testing.T) {
+	a := &apiConfig{}
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(
+		http.MethodPost,
+		"/api/polka/webhooks",
+		strings.NewReader(`{"body":"hello","extra":true}`),
+	)
+
+	dst := struct {
+		Body string `json:"body"`
+	}{}
+	if !a.decodeLenientJSON(rec, rq, &dst) {
+		t.Fatalf("decodeLenientJSON() = false, want true (status %d)", rec.Code)
+	}
+	if dst.Body != "hello" {
+		t.Errorf("decodeLenientJSON() body = %q, want %q", dst.Body, "hello")
+	}
+}
+
+func TestPostChirpsContentType(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	tests := []struct {
+		contentType string
+		wantStatus  int
+	}{
+		{"", http.StatusCreated},
+		{"application/json", http.StatusCreated},
+		{"application/json; charset=utf-8", http.StatusCreated},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"not a media type", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(
+				http.MethodPost,
+				"/api/chirps",
+				strings.NewReader(`{"body":"hello"}`),
+			)
+			rq.Header.Set("Authorization", "Bearer "+u.Token)
+			if tt.contentType != "" {
+				rq.Header.Set("Content-Type", tt.contentType)
+			}
+			a.middlewareAuth(a.postChirps)(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("postChirps() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+// loadLikeCount fills in how many users have liked c.
+func (a *apiConfig) loadLikeCount(ctx context.Context, c *chirp) error {
+	count, err := a.qry.GetChirpLikeCount(ctx, c.Id)
+	if err != nil {
+		return fmt.Errorf("loadLikeCount: %w", err)
+	}
+
+	c.LikeCount = count
+	return nil
+}
+
+// loadLikeCounts is loadLikeCount for a page of chirps, counting every chirp's
+// likes in one query.
+func (a *apiConfig) loadLikeCounts(ctx context.Context, chirps []chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.Id
+	}
+	rows, err := a.qry.GetChirpLikeCounts(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("loadLikeCounts: %w", err)
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, r := range rows {
+		counts[r.ChirpID] = r.Count
+	}
+	for i := range chirps {
+		chirps[i].LikeCount = counts[chirps[i].Id]
+	}
+	return nil
+}
+
+// likeTarget identifies the caller and looks up the chirp named in the
+// path. If either fails it writes the error response itself and returns false.
+func (a *apiConfig) likeTarget(
+	rw http.ResponseWriter,
+	rq *http.Request,
+	caller string,
+) (uuid.UUID, uuid.UUID, bool) {
+	chirpID, err := parsePathUUID(rq, "chirpID")
+	if err != nil {
+		fmt.Printf("apiConfig.%s: %v\n", caller, err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	_, err = a.qry.GetChirp(rq.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.%s: %v\n", caller, err)
+		rw.WriteHeader(http.StatusNotFound)
+		return uuid.Nil, uuid.Nil, false
+	} else if err != nil {
+		fmt.Printf("apiConfig.%s: %v\n", caller, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, chirpID, true
+}
+
+// postChirpsChirpIDLikes likes a chirp on behalf of the caller. Liking a chirp
+// that is already liked succeeds without changing anything.
+func (a *apiConfig) postChirpsChirpIDLikes(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	userID, chirpID, ok := a.likeTarget(rw, rq, "postChirpsChirpIDLikes")
+	if !ok {
+		return
+	}
+
+	err := a.qry.LikeChirp(
+		rq.Context(),
+		database.LikeChirpParams{UserID: userID, ChirpID: chirpID},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.postChirpsChirpIDLikes: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// deleteChirpsChirpIDLikes removes the caller's like, if there is one.
+func (a *apiConfig) deleteChirpsChirpIDLikes(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	userID, chirpID, ok := a.likeTarget(rw, rq, "deleteChirpsChirpIDLikes")
+	if !ok {
+		return
+	}
+
+	err := a.qry.UnlikeChirp(
+		rq.Context(),
+		database.UnlikeChirpParams{UserID: userID, ChirpID: chirpID},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.deleteChirpsChirpIDLikes: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// getUsersMeLikes lists the chirps the caller has liked, most recently liked
+// first, paged with limit and offset.
+func (a *apiConfig) getUsersMeLikes(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	pg, err := parsePage(rq.URL.Query())
+	if err != nil {
+		fmt.Printf("apiConfig.getUsersMeLikes: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := a.qry.GetLikedChirps(
+		rq.Context(),
+		database.GetLikedChirpsParams{
+			UserID:    userID,
+			RowLimit:  pg.Limit,
+			RowOffset: pg.Offset,
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getUsersMeLikes: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	chirps, err := a.chirpsFromRows(rq.Context(), rows)
+	if err != nil {
+		fmt.Printf("apiConfig.getUsersMeLikes: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, chirps)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// likeChirp has userID like or, with DELETE, unlike chirpID.
+func likeChirp(
+	t *testing.T,
+	a *apiConfig,
+	method string,
+	userID uuid.UUID,
+	chirpID uuid.UUID,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rq := newPathRequest(
+		t,
+		method,
+		"/api/chirps/"+chirpID.String()+"/likes",
+		"chirpID",
+		chirpID.String(),
+		userID,
+		a.secret,
+	)
+	handler := a.postChirpsChirpIDLikes
+	if method == http.MethodDelete {
+		handler = a.deleteChirpsChirpIDLikes
+	}
+	a.middlewareAuth(handler)(rec, rq)
+	return rec
+}
+
+func TestChirpLikes(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"hello"}`)
+
+	steps := []struct {
+		name      string
+		method    string
+		wantLiked bool
+	}{
+		{
+			name:      "Like",
+			method:    http.MethodPost,
+			wantLiked: true,
+		},
+		{
+			name:      "Double like",
+			method:    http.MethodPost,
+			wantLiked: true,
+		},
+		{
+			name:      "Unlike",
+			method:    http.MethodDelete,
+			wantLiked: false,
+		},
+	}
+
+	for _, st := range steps {
+		t.Run(st.name, func(t *testing.T) {
+			rec := likeChirp(t, a, st.method, u.Id, c.Id)
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+			}
+			if got := f.state.likes[fakePair{u.Id, c.Id}]; got != st.wantLiked {
+				t.Errorf("liked = %v, want %v", got, st.wantLiked)
+			}
+		})
+	}
+}
+
+func TestChirpLikesUnknownChirp(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	rec := likeChirp(t, a, http.MethodPost, u.Id, uuid.New())
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if len(f.state.likes) != 0 {
+		t.Errorf("likes = %d, want 0", len(f.state.likes))
+	}
+}
+
+func TestGetChirpsChirpIDLikeCount(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"hello"}`)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		fan := signUpAndLogIn(t, a, email)
+		if rec := likeChirp(t, a, http.MethodPost, fan.Id, c.Id); rec.Code != http.StatusNoContent {
+			t.Fatalf("like status = %d, want %d", rec.Code, http.StatusNoContent)
+		}
+	}
+
+	rec := getChirpByID(t, a, c.Id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	got := chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.LikeCount != 3 {
+		t.Errorf("like_count = %d, want 3", got.LikeCount)
+	}
+}
+
+func TestGetUsersMeLikes(t *testing.T) {
+	configs := []struct {
+		name      string
+		newConfig func(t *testing.T) *apiConfig
+	}{
+		{
+			name: "Fake",
+			newConfig: func(*testing.T) *apiConfig {
+				a, _ := newFakeConfig()
+				return a
+			},
+		},
+		{name: "SQLite", newConfig: newSQLiteConfig},
+	}
+
+	for _, tt := range configs {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.newConfig(t)
+			u := signUpAndLogIn(t, a, "user@example.com")
+			other := signUpAndLogIn(t, a, "other@example.com")
+
+			var chirps []chirp
+			for _, body := range []string{"liked", "unliked", "other's like"} {
+				_, c := postChirp(t, a, other.Token, `{"body":"`+body+`"}`)
+				chirps = append(chirps, c)
+			}
+
+			like := func(method string, userID uuid.UUID, chirpID uuid.UUID) {
+				t.Helper()
+
+				rec := likeChirp(t, a, method, userID, chirpID)
+				if rec.Code != http.StatusNoContent {
+					t.Fatalf("%s like status = %d, want %d", method, rec.Code, http.StatusNoContent)
+				}
+			}
+			like(http.MethodPost, u.Id, chirps[0].Id)
+			like(http.MethodPost, u.Id, chirps[1].Id)
+			like(http.MethodDelete, u.Id, chirps[1].Id)
+			like(http.MethodPost, other.Id, chirps[2].Id)
+
+			rec := doJSON(
+				t,
+				a.middlewareJWTAuth(a.getUsersMeLikes),
+				http.MethodGet,
+				"/api/users/me/likes",
+				u.Token,
+				"",
+			)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("getUsersMeLikes() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if len(got) != 1 || got[0].Id != chirps[0].Id {
+				t.Errorf("getUsersMeLikes() = %+v, want only %q", got, "liked")
+			}
+		})
+	}
+}
+
+func TestGetChirpsLikeCounts(t *testing.T) {
+	configs := []struct {
+		name      string
+		newConfig func(t *testing.T) *apiConfig
+	}{
+		{
+			name: "Fake",
+			newConfig: func(*testing.T) *apiConfig {
+				a, _ := newFakeConfig()
+				return a
+			},
+		},
+		{name: "SQLite", newConfig: newSQLiteConfig},
+	}
+
+	for _, tt := range configs {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.newConfig(t)
+			u := signUpAndLogIn(t, a, "user@example.com")
+			other := signUpAndLogIn(t, a, "other@example.com")
+
+			want := map[string]int64{"two likes": 2, "one like": 1, "no likes": 0}
+			ids := map[string]uuid.UUID{}
+			for body := range want {
+				_, c := postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+				ids[body] = c.Id
+			}
+			for _, like := range []struct {
+				userID uuid.UUID
+				body   string
+			}{
+				{u.Id, "two likes"},
+				{other.Id, "two likes"},
+				{other.Id, "one like"},
+			} {
+				rec := likeChirp(t, a, http.MethodPost, like.userID, ids[like.body])
+				if rec.Code != http.StatusNoContent {
+					t.Fatalf("like status = %d, want %d", rec.Code, http.StatusNoContent)
+				}
+			}
+
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps", "", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("getChirps() returned %d chirps, want %d", len(got), len(want))
+			}
+			for _, c := range got {
+				if c.LikeCount != want[c.Body] {
+					t.Errorf("%q like_count = %d, want %d", c.Body, c.LikeCount, want[c.Body])
+				}
+			}
+		})
+	}
+}
@@ -1,21 +1,38 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"sort"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 
 	"github.com/davidw1457/chirpy/internal/auth"
 	"github.com/davidw1457/chirpy/internal/database"
@@ -24,54 +41,342 @@ import (
 func main() {
 	godotenv.Load()
 
-	dbURL := os.Getenv("DB_URL")
+	logLevel := slog.LevelInfo
+	if strings.EqualFold(os.Getenv("LOG_LEVEL"), "debug") {
+		logLevel = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(
+		os.Stdout,
+		&slog.HandlerOptions{Level: logLevel},
+	)))
+
+	dbURL := requireEnv("DB_URL")
+	secret := requireEnv("SECRET")
+	// Deployments sharing SECRET should each set their own JWT_AUDIENCE so
+	// tokens minted by one aren't accepted by another.
+	jwtAudience := cmp.Or(os.Getenv("JWT_AUDIENCE"), auth.DefaultAudience)
+	polkaKey := requireEnv("POLKA_KEY")
+	polkaSigningSecret := os.Getenv("POLKA_SIGNING_SECRET")
+	// Without ADMIN_RESET_TOKEN no request can supply a matching header, so
+	// /admin/reset stays disabled even in dev.
+	adminResetToken := os.Getenv("ADMIN_RESET_TOKEN")
+	chirpWebhookURL := os.Getenv("CHIRP_WEBHOOK_URL")
+	chirpWebhookSecret := os.Getenv("CHIRP_WEBHOOK_SECRET")
+	if chirpWebhookURL != "" && chirpWebhookSecret == "" {
+		fmt.Println("CHIRP_WEBHOOK_URL is set but CHIRP_WEBHOOK_SECRET is not")
+		os.Exit(1)
+	}
+
+	// Anything other than "dev" disables the admin endpoints, so an unset
+	// PLATFORM fails closed.
 	platform := os.Getenv("PLATFORM")
-	secret := os.Getenv("SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
+	if platform == "" {
+		platform = "production"
+	}
+	inviteOnly := os.Getenv("INVITE_ONLY") == "true"
+	var verificationMailer mailer
+	if platform == "dev" {
+		verificationMailer = logMailer{}
+	}
+	maxBodyBytes := intEnv("MAX_BODY_BYTES", defaultMaxBodyBytes)
+	bcryptCost := intEnv("BCRYPT_COST", auth.DefaultCost)
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		fmt.Printf(
+			"invalid BCRYPT_COST %d: must be between %d and %d\n",
+			bcryptCost,
+			bcrypt.MinCost,
+			bcrypt.MaxCost,
+		)
+		os.Exit(1)
+	}
+	refreshTokenBytes := intEnv(
+		"REFRESH_TOKEN_BYTES",
+		auth.DefaultRefreshTokenBytes,
+	)
+	if refreshTokenBytes < auth.MinRefreshTokenBytes {
+		fmt.Printf(
+			"invalid REFRESH_TOKEN_BYTES %d: must be at least %d\n",
+			refreshTokenBytes,
+			auth.MinRefreshTokenBytes,
+		)
+		os.Exit(1)
+	}
+	// Unknown-email logins are checked against a hash at the configured cost
+	// so they take as long as a wrong password does.
+	dummyHash := dummyPasswordHash
+	if bcryptCost != auth.DefaultCost {
+		hash, err := auth.HashPasswordWithCost(
+			"chirpy-dummy-password",
+			bcryptCost,
+		)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		dummyHash = hash
+	}
+	minPasswordLength := intEnv(
+		"MIN_PASSWORD_LENGTH",
+		auth.DefaultMinPasswordLength,
+	)
+	readOnly := os.Getenv("READ_ONLY") == "true"
+	corsOrigins := listEnv("CORS_ALLOWED_ORIGINS", []string{"*"})
+	jwtExpiry := durationEnv("JWT_EXPIRY", time.Hour)
+	refreshExpiry := durationEnv(
+		"REFRESH_TOKEN_EXPIRY",
+		defaultRefreshTokenExpiry,
+	)
+	verificationExpiry := durationEnv(
+		"EMAIL_VERIFICATION_EXPIRY",
+		defaultVerificationExpiry,
+	)
+	editWindow := durationEnv("EDIT_WINDOW", 0)
+	maxQuotes := intEnv("MAX_QUOTES", 0)
+	chirpLength := intEnv("MAX_CHIRP_LENGTH", maxChirpLength)
+	if chirpLength <= 0 {
+		fmt.Printf("invalid MAX_CHIRP_LENGTH %d: must be positive\n", chirpLength)
+		os.Exit(1)
+	}
+	shutdownTimeout := durationEnv("SHUTDOWN_TIMEOUT", 10*time.Second)
+	// DRAIN_DELAY keeps the listener open after a shutdown signal, answering
+	// 503, so a load balancer has time to notice and stop sending traffic.
+	drainDelay := durationEnv("DRAIN_DELAY", 0)
+	addr, err := listenAddr()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	badWords, err := badWordsFromEnv()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	chirpCache := newChirpCache(
+		intEnv("CHIRP_CACHE_SIZE", defaultChirpCacheSize),
+		durationEnv("CHIRP_CACHE_TTL", defaultChirpCacheTTL),
+	)
+	loginLimiter := newLoginLimiter(
+		intEnv("LOGIN_MAX_FAILURES", 5),
+		durationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+	)
+	// Unlike the per-IP limiter, the lockout follows the account, so spreading
+	// a guessing attack across addresses doesn't help. 0 disables it.
+	lockoutThreshold := intEnv("ACCOUNT_LOCKOUT_THRESHOLD", 10)
+	lockoutDuration := durationEnv("ACCOUNT_LOCKOUT_DURATION", 15*time.Minute)
+
+	// DB_DRIVER=sqlite runs without any database server; DB_URL is then the
+	// path of the database file, which is created if it doesn't exist.
+	var db *sql.DB
+	var dbQueries Querier
+	switch dbDriver := cmp.Or(os.Getenv("DB_DRIVER"), "postgres"); dbDriver {
+	case "postgres":
+		db, err = sql.Open("postgres", dbURL)
+		dbQueries = database.New(db)
+	case "sqlite":
+		db, err = openSQLite(context.Background(), dbURL)
+		dbQueries = newSQLiteQuerier(db)
+	default:
+		err = fmt.Errorf("DB_DRIVER must be postgres or sqlite, not %q", dbDriver)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	cfg := apiConfig{
+		db:                 db,
+		qry:                dbQueries,
+		platform:           platform,
+		secret:             secret,
+		jwtAudience:        jwtAudience,
+		polkaKey:           polkaKey,
+		inviteOnly:         inviteOnly,
+		jwtExpiry:          jwtExpiry,
+		refreshExpiry:      refreshExpiry,
+		verificationExpiry: verificationExpiry,
+		mailer:             verificationMailer,
+		badWords:           badWords,
+		editWindow:         editWindow,
+		maxQuotes:          int32(maxQuotes),
+		maxChirpLength:     chirpLength,
+		readOnly:           readOnly,
+		loginLimiter:       loginLimiter,
+		lockoutThreshold:   lockoutThreshold,
+		lockoutDuration:    lockoutDuration,
+		chirpCache:         chirpCache,
+		chirpWebhook:       newChirpWebhook(chirpWebhookURL, chirpWebhookSecret),
+		chirpBroker:        newChirpBroker(),
+		corsOrigins:        corsOrigins,
+		maxBodyBytes:       int64(maxBodyBytes),
+		minPasswordLength:  minPasswordLength,
+		bcryptCost:         bcryptCost,
+		refreshTokenBytes:  refreshTokenBytes,
+		dummyHash:          dummyHash,
+		polkaSigningSecret: polkaSigningSecret,
+		adminResetToken:    adminResetToken,
+	}
+	mux := cfg.routes()
 
-	db, err := sql.Open("postgres", dbURL)
+	server := http.Server{
+		Handler: cfg.middlewareRecover(cfg.middlewareRequestID(
+			cfg.middlewareLogging(cfg.middlewareDrain(
+				cfg.middlewareCORS(cfg.middlewareReadOnly(mux)),
+			)),
+		)),
+		Addr: addr,
+		// Without these a client that sends or reads slowly can hold a
+		// connection, and its goroutine, open forever. Headers get 5s, a whole
+		// request body 15s and writing the response 30s, which is plenty for
+		// JSON bodies capped at MAX_BODY_BYTES. Idle keep-alive connections
+		// are closed after 2m.
+		ReadHeaderTimeout: durationEnv("READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       durationEnv("READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      durationEnv("WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       durationEnv("IDLE_TIMEOUT", 2*time.Minute),
+	}
+	server.RegisterOnShutdown(cfg.chirpBroker.close)
+
+	ln, err := net.Listen("tcp", server.Addr)
 	if err != nil {
 		fmt.Println(err)
+		db.Close()
 		os.Exit(1)
 	}
 
-	dbQueries := database.New(db)
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("listening on %s\n", ln.Addr())
+		serverErr <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println(err)
+			db.Close()
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		fmt.Println("shutting down, waiting for in-flight requests")
+	}
+
+	cfg.draining.Store(true)
+	time.Sleep(drainDelay)
 
-	mux := http.NewServeMux()
+	// Stop listening for signals so a second Ctrl-C kills the process
+	// immediately instead of waiting out the timeout.
+	stop()
 
-	server := http.Server{
-		Handler: mux,
-		Addr:    ":8080",
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(),
+		shutdownTimeout,
+	)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		fmt.Printf("server shutdown: %v\n", err)
 	}
+	cfg.chirpWebhook.wait()
 
-	cfg := apiConfig{
-		qry:      dbQueries,
-		platform: platform,
-		secret:   secret,
-		polkaKey: polkaKey,
+	err = db.Close()
+	if err != nil {
+		fmt.Printf("closing database: %v\n", err)
+	}
+
+	fmt.Println("shutdown complete")
+}
+
+const defaultPort = "8080"
+
+// listenAddr returns the address to listen on. ADDR takes a full host:port;
+// otherwise PORT picks the port on all interfaces, defaulting to 8080.
+func listenAddr() (string, error) {
+	addr := os.Getenv("ADDR")
+	if addr == "" {
+		addr = ":" + cmp.Or(os.Getenv("PORT"), defaultPort)
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q in listen address", port)
+	}
+
+	return addr, nil
+}
+
+// requireEnv returns the value of the named environment variable, exiting
+// with a message naming it if it is unset or empty.
+func requireEnv(name string) string {
+	val := os.Getenv(name)
+	if val == "" {
+		fmt.Printf("missing required environment variable %s\n", name)
+		os.Exit(1)
+	}
+	return val
+}
+
+// listEnv reads a comma-separated list from the named environment variable,
+// falling back to def when it is unset or contains no entries.
+func listEnv(name string, def []string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	if len(list) == 0 {
+		return def
+	}
+	return list
+}
+
+// intEnv reads a non-negative integer from the named environment variable,
+// falling back to def when it is unset or invalid.
+func intEnv(name string, def int) int {
+	val := os.Getenv(name)
+	if val == "" {
+		return def
 	}
-	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix(
-		"/app",
-		http.FileServer(http.Dir(".")))))
 
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirpsChirpID)
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		fmt.Printf("invalid %s %q, using default %d\n", name, val, def)
+		return def
+	}
 
-	mux.HandleFunc("GET /api/healthz", getHealthz)
-	mux.HandleFunc("GET /api/chirps", cfg.getChirps)
-	mux.HandleFunc("GET /admin/metrics", cfg.getMetrics)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirpsChirpID)
+	return n
+}
 
-	mux.HandleFunc("POST /api/chirps", cfg.postChirps)
-	mux.HandleFunc("POST /admin/reset", cfg.postReset)
-	mux.HandleFunc("POST /api/users", cfg.postUsers)
-	mux.HandleFunc("POST /api/login", cfg.postLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.postRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.postRevoke)
-	mux.HandleFunc("POST /api/polka/webhooks", cfg.postPolkaWebhooks)
+// durationEnv reads a Go duration string such as "15m" from the named
+// environment variable, falling back to def when it is unset or invalid.
+func durationEnv(name string, def time.Duration) time.Duration {
+	val := os.Getenv(name)
+	if val == "" {
+		return def
+	}
 
-	mux.HandleFunc("PUT /api/users", cfg.putUsers)
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		fmt.Printf("invalid %s %q, using default %v\n", name, val, def)
+		return def
+	}
 
-	server.ListenAndServe()
+	return d
 }
 
 func getHealthz(rw http.ResponseWriter, rq *http.Request) {
@@ -84,12 +389,116 @@ func getHealthz(rw http.ResponseWriter, rq *http.Request) {
 	}
 }
 
+func (a *apiConfig) getReadyz(rw http.ResponseWriter, rq *http.Request) {
+	ctx, cancel := context.WithTimeout(rq.Context(), 2*time.Second)
+	defer cancel()
+
+	err := a.db.PingContext(ctx)
+	if err != nil {
+		fmt.Printf("apiConfig.getReadyz: %v\n", err)
+		respondWithError(
+			rw,
+			http.StatusServiceUnavailable,
+			"database unavailable",
+		)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+
+	_, err = rw.Write([]byte("OK"))
+	if err != nil {
+		fmt.Printf("apiConfig.getReadyz: %v\n", err)
+	}
+}
+
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	platform       string
-	qry            *database.Queries
-	secret         string
-	polkaKey       string
+	fileserverHits     atomic.Int32
+	metrics            metrics
+	platform           string
+	db                 *sql.DB
+	qry                Querier
+	secret             string
+	jwtAudience        string
+	polkaKey           string
+	inviteOnly         bool
+	jwtExpiry          time.Duration
+	refreshExpiry      time.Duration
+	verificationExpiry time.Duration
+	mailer             mailer
+	badWords           []string
+	editWindow         time.Duration
+	maxQuotes          int32
+	maxChirpLength     int
+	readOnly           bool
+	draining           atomic.Bool
+	loginLimiter       *loginLimiter
+	lockoutThreshold   int
+	lockoutDuration    time.Duration
+	chirpCache         *chirpCache
+	chirpWebhook       *chirpWebhook
+	chirpBroker        *chirpBroker
+	corsOrigins        []string
+	maxBodyBytes       int64
+	minPasswordLength  int
+	bcryptCost         int
+	refreshTokenBytes  int
+	dummyHash          string
+	polkaSigningSecret string
+	adminResetToken    string
+	now                func() time.Time
+}
+
+const defaultRefreshTokenExpiry = 60 * 24 * time.Hour
+
+// refreshTokenExpiresAt returns when a refresh token issued now should stop
+// working.
+func (a *apiConfig) refreshTokenExpiresAt() time.Time {
+	expiry := a.refreshExpiry
+	if expiry <= 0 {
+		expiry = defaultRefreshTokenExpiry
+	}
+	return a.clock().Add(expiry)
+}
+
+// chirpLengthLimit returns the longest chirp body this instance accepts.
+func (a *apiConfig) chirpLengthLimit() int {
+	return cmp.Or(a.maxChirpLength, maxChirpLength)
+}
+
+// passwordCost returns the bcrypt cost new password hashes are created with.
+func (a *apiConfig) passwordCost() int {
+	return cmp.Or(a.bcryptCost, auth.DefaultCost)
+}
+
+func (a *apiConfig) makeRefreshToken() (string, error) {
+	return auth.MakeRefreshTokenWithLength(
+		cmp.Or(a.refreshTokenBytes, auth.DefaultRefreshTokenBytes),
+	)
+}
+
+// audience returns the aud claim access tokens are minted with and must carry.
+func (a *apiConfig) audience() string {
+	return cmp.Or(a.jwtAudience, auth.DefaultAudience)
+}
+
+// clock returns the current time, using the injected now func when set so
+// tests can control time-dependent behaviour.
+func (a *apiConfig) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+// editWindowExpired reports whether a chirp created at createdAt can no longer
+// be edited. A zero editWindow means chirps can always be edited.
+func (a *apiConfig) editWindowExpired(createdAt time.Time) bool {
+	if a.editWindow <= 0 {
+		return false
+	}
+	return a.clock().After(createdAt.Add(a.editWindow))
 }
 
 func (a *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -108,26 +517,71 @@ func (a *apiConfig) getMetrics(rw http.ResponseWriter, rq *http.Request) {
   <body>
     <h1>Welcome, Chirpy Admin</h1>
     <p>Chirpy has been visited %d times!</p>
+    <ul>
+      <li>Chirps created: %d</li>
+      <li>Chirps edited: %d</li>
+      <li>Chirps deleted: %d</li>
+      <li>Users created: %d</li>
+    </ul>
   </body>
-</html>`, a.fileserverHits.Load())
+</html>`,
+		a.fileserverHits.Load(),
+		a.metrics.chirpsCreated.Load(),
+		a.metrics.chirpsEdited.Load(),
+		a.metrics.chirpsDeleted.Load(),
+		a.metrics.usersCreated.Load(),
+	)
 	_, err := rw.Write([]byte(ht))
 	if err != nil {
 		fmt.Printf("apiConfig.getMetrics: %v\n", err)
 	}
 }
 
+// resetConfirmation must be sent as {"confirm":"RESET"} for postReset to
+// wipe anything, so a stray POST to /admin/reset is harmless.
+const resetConfirmation = "RESET"
+
 func (a *apiConfig) postReset(rw http.ResponseWriter, rq *http.Request) {
-	if a.platform != "dev" {
+	if a.platform != "dev" || !a.validResetToken(rq) {
 		rw.WriteHeader(http.StatusForbidden)
 		return
 	}
+
+	type input struct {
+		Confirm string `json:"confirm"`
+	}
+
+	inp := input{}
+	if !a.decodeJSON(rw, rq, &inp) {
+		return
+	}
+	if inp.Confirm != resetConfirmation {
+		respondWithError(
+			rw,
+			http.StatusBadRequest,
+			fmt.Sprintf("confirm must be %q", resetConfirmation),
+		)
+		return
+	}
+
 	a.fileserverHits.Store(0)
-	err := a.qry.ResetUsers(rq.Context())
+	a.metrics.resetLifecycle()
+	err := a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			Action: auditAdminReset,
+			Target: "users",
+		},
+		func(q Querier) error {
+			return q.ResetUsers(rq.Context())
+		},
+	)
 	if err != nil {
 		fmt.Printf("apiConfig.postReset: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	a.chirpCache.purge()
 
 	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	rw.WriteHeader(http.StatusOK)
@@ -138,210 +592,964 @@ func (a *apiConfig) postReset(rw http.ResponseWriter, rq *http.Request) {
 	}
 }
 
-type chirp struct {
-	Id        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+// validResetToken reports whether rq carries the configured
+// X-Admin-Reset-Token. It is always false if no token is configured.
+func (a *apiConfig) validResetToken(rq *http.Request) bool {
+	if a.adminResetToken == "" {
+		return false
+	}
+	got := rq.Header.Get("X-Admin-Reset-Token")
+	return subtle.ConstantTimeCompare(
+		[]byte(got),
+		[]byte(a.adminResetToken),
+	) == 1
 }
 
-func (a *apiConfig) postChirps(rw http.ResponseWriter, rq *http.Request) {
-	type inputChirp struct {
-		Body string `json:"body"`
+func (a *apiConfig) postInvites(rw http.ResponseWriter, rq *http.Request) {
+	if a.platform != "dev" {
+		rw.WriteHeader(http.StatusForbidden)
+		return
 	}
 
-	decoder := json.NewDecoder(rq.Body)
-	chrp := inputChirp{}
-	err := decoder.Decode(&chrp)
+	code, err := auth.MakeInviteCode()
 	if err != nil {
-		fmt.Printf("postChirps: %v\n", err)
+		fmt.Printf("apiConfig.postInvites: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(rq.Header)
+	var r database.Invite
+	err = a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			Action: auditInviteCreate,
+			Target: code,
+		},
+		func(q Querier) error {
+			r, err = q.CreateInvite(rq.Context(), code)
+			return err
+		},
+	)
 	if err != nil {
-		fmt.Printf("postChirps: %v\n", err)
-		rw.WriteHeader(http.StatusUnauthorized)
+		fmt.Printf("apiConfig.postInvites: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	type response struct {
+		Code      string    `json:"code"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	respondWithJSON(
+		rw,
+		http.StatusCreated,
+		response{Code: r.Code, CreatedAt: r.CreatedAt.UTC()},
+	)
+}
+
+// getAdminUsers lists users for moderation. Only the public fields from
+// userFromRow are returned, never password hashes.
+func (a *apiConfig) getAdminUsers(rw http.ResponseWriter, rq *http.Request) {
+	if a.platform != "dev" {
+		rw.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(tokenString, a.secret)
+	pg, err := parsePage(rq.URL.Query())
 	if err != nil {
-		fmt.Printf("postChirps: %v\n", err)
-		rw.WriteHeader(http.StatusUnauthorized)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if chrp.Body == "" {
-		rw.WriteHeader(http.StatusBadRequest)
+	rows, err := a.qry.ListUsers(
+		rq.Context(),
+		database.ListUsersParams{Limit: pg.Limit, Offset: pg.Offset},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getAdminUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	chrp.Body = cleanString(chrp.Body)
+	users := make([]user, len(rows))
+	for i, r := range rows {
+		users[i] = userFromRow(r)
+	}
 
-	if len(chrp.Body) <= 140 {
-		r, err := a.qry.CreateChirp(
-			rq.Context(),
-			database.CreateChirpParams{Body: chrp.Body, UserID: userID},
-		)
-		if err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	respondWithJSON(rw, http.StatusOK, users)
+}
 
-		respBody := chirp{
-			Id:        r.ID,
-			CreatedAt: r.CreatedAt,
-			UpdatedAt: r.UpdatedAt,
-			Body:      r.Body,
-			UserId:    r.UserID,
-		}
-		dat, err := json.Marshal(respBody)
-		if err != nil {
-			fmt.Printf("postChirps: %v\n", err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		rw.Header().Set("Content-Type", "application/json")
-		rw.WriteHeader(http.StatusCreated)
-		rw.Write(dat)
-	} else {
-		type response struct {
-			Error string `json:"error"`
-		}
-		respBody := response{Error: "Chirp is too long"}
-		dat, err := json.Marshal(respBody)
-		if err != nil {
-			fmt.Printf("postChirps: %v\n", err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		rw.Header().Set("Content-Type", "application/json")
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write(dat)
-	}
+type chirp struct {
+	Id         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserId     uuid.UUID  `json:"user_id"`
+	QuoteOf    *uuid.UUID `json:"quote_of,omitempty"`
+	ParentId   *uuid.UUID `json:"parent_id,omitempty"`
+	Quoted     *chirp     `json:"quoted,omitempty"`
+	QuoteCount int32      `json:"quote_count"`
+	LikeCount  int64      `json:"like_count"`
+	// Author is only filled in when the request asks for expand=author.
+	Author *chirpAuthor `json:"author,omitempty"`
 }
 
-func cleanString(s string) string {
-	badWords := []string{"kerfuffle", "sharbert", "fornax"}
+type chirpAuthor struct {
+	Id          uuid.UUID `json:"id"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
 
-	var cleaned string
-	for _, b := range badWords {
-		for _, w := range strings.Fields(s) {
-			if strings.ToLower(w) == b {
-				cleaned = fmt.Sprintf("%s ****", cleaned)
-			} else {
-				cleaned = fmt.Sprintf("%s %s", cleaned, w)
-			}
-		}
-		s = cleaned
-		cleaned = ""
-	}
-	return s[1:]
+// chirpFromRow converts a database row to its JSON form. Timestamps are
+// normalised to UTC so clients always see a Z suffix regardless of how the
+// database session is configured.
+func chirpFromRow(r database.Chirp) chirp {
+	c := chirp{
+		Id:         r.ID,
+		CreatedAt:  r.CreatedAt.UTC(),
+		UpdatedAt:  r.UpdatedAt.UTC(),
+		Body:       r.Body,
+		UserId:     r.UserID,
+		QuoteCount: r.QuoteCount,
+	}
+	if r.QuoteOf.Valid {
+		quoteOf := r.QuoteOf.UUID
+		c.QuoteOf = &quoteOf
+	}
+	if r.ParentID.Valid {
+		parentID := r.ParentID.UUID
+		c.ParentId = &parentID
+	}
+	return c
 }
 
-func (a *apiConfig) postUsers(rw http.ResponseWriter, rq *http.Request) {
-	type input struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+// quoteLimitReached reports whether a chirp that has already been quoted count
+// times may not be quoted again. A zero maxQuotes means there is no cap.
+func (a *apiConfig) quoteLimitReached(count int32) bool {
+	return a.maxQuotes > 0 && count >= a.maxQuotes
+}
+
+// expandQuote loads the chirp quoted by c, if any, and embeds it. Only one
+// level is expanded so a chain of quotes doesn't fan out into more queries.
+func (a *apiConfig) expandQuote(ctx context.Context, c *chirp) error {
+	if c.QuoteOf == nil {
+		return nil
 	}
 
-	decoder := json.NewDecoder(rq.Body)
-	newUser := input{}
-	err := decoder.Decode(&newUser)
-	if err != nil {
-		fmt.Printf("apiConfig.postUsers: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		return
+	row, err := a.qry.GetChirp(ctx, *c.QuoteOf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("expandQuote: %w", err)
 	}
 
-	if newUser.Email == "" || newUser.Password == "" {
-		rw.WriteHeader(http.StatusBadRequest)
-		return
+	quoted := chirpFromRow(row)
+	c.Quoted = &quoted
+	return nil
+}
+
+// expandQuotes is expandQuote for a page of chirps, fetching every quoted
+// chirp in one query.
+func (a *apiConfig) expandQuotes(ctx context.Context, chirps []chirp) error {
+	ids := []uuid.UUID{}
+	for _, c := range chirps {
+		if c.QuoteOf != nil {
+			ids = append(ids, *c.QuoteOf)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
 	}
 
-	newUser.Password, err = auth.HashPassword(newUser.Password)
+	rows, err := a.qry.GetChirpsByIDs(ctx, ids)
 	if err != nil {
-		fmt.Printf("apiConfig.postUsers: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		return
+		return fmt.Errorf("expandQuotes: %w", err)
 	}
 
-	r, err := a.qry.CreateUser(
-		rq.Context(),
-		database.CreateUserParams{
-			Email:          newUser.Email,
-			HashedPassword: newUser.Password,
-		},
-	)
-	if err != nil {
-		fmt.Printf("apiConfig.postUsers: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		return
+	quoted := make(map[uuid.UUID]chirp, len(rows))
+	for _, r := range rows {
+		quoted[r.ID] = chirpFromRow(r)
+	}
+	for i := range chirps {
+		if chirps[i].QuoteOf == nil {
+			continue
+		}
+		q, ok := quoted[*chirps[i].QuoteOf]
+		if ok {
+			chirps[i].Quoted = &q
+		}
 	}
+	return nil
+}
 
-	respBody := user{
-		Id:          r.ID,
-		CreatedAt:   r.CreatedAt,
-		UpdatedAt:   r.UpdatedAt,
-		Email:       r.Email,
-		IsChirpyRed: r.IsChirpyRed,
+// chirpsFromRows converts a page of rows to their JSON form, expanding quotes
+// and loading like counts with one query each for the whole page.
+func (a *apiConfig) chirpsFromRows(
+	ctx context.Context,
+	rows []database.Chirp,
+) ([]chirp, error) {
+	chirps := make([]chirp, len(rows))
+	for i, r := range rows {
+		chirps[i] = chirpFromRow(r)
 	}
 
-	dat, err := json.Marshal(respBody)
+	err := a.expandQuotes(ctx, chirps)
 	if err != nil {
-		fmt.Printf("apiConfig.postUsers: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("chirpsFromRows: %w", err)
 	}
-	rw.Header().Set("Content-Type", "application/json")
-	rw.WriteHeader(http.StatusCreated)
-	rw.Write(dat)
+
+	err = a.loadLikeCounts(ctx, chirps)
+	if err != nil {
+		return nil, fmt.Errorf("chirpsFromRows: %w", err)
+	}
+	return chirps, nil
 }
 
-func (a *apiConfig) getChirps(rw http.ResponseWriter, rq *http.Request) {
-	authorID := rq.URL.Query().Get("author_id")
+// wantsAuthor reports whether the request asked for chirps to embed their
+// author with expand=author. expand takes a comma-separated list.
+func wantsAuthor(query url.Values) bool {
+	return slices.Contains(strings.Split(query.Get("expand"), ","), "author")
+}
 
-	var rows []database.Chirp
-	var err error
+// expandAuthors embeds each chirp's author, fetching them all in one query.
+func (a *apiConfig) expandAuthors(ctx context.Context, chirps []chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
 
-	if authorID == "" {
-		rows, err = a.qry.GetAllChirps(rq.Context())
-	} else {
-		userID, err := uuid.Parse(authorID)
-		if err != nil {
-			fmt.Printf("apiConfig.getChirps: %v\n", err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		rows, err = a.qry.GetChirpsByUserID(rq.Context(), userID)
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.Id
 	}
+	rows, err := a.qry.GetChirpAuthors(ctx, ids)
 	if err != nil {
-		fmt.Printf("apiConfig.getChirps: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	sortOrder := rq.URL.Query().Get("sort")
-	if sortOrder == "desc" {
-		sort.Slice(
-			rows,
-			func(i, j int) bool {
-				return rows[i].CreatedAt.After(rows[j].CreatedAt)
-			},
-		)
+		return fmt.Errorf("expandAuthors: %w", err)
 	}
 
-	chirps := make([]chirp, len(rows))
-	for i, r := range rows {
-		chirps[i] = chirp{
-			Id:        r.ID,
-			CreatedAt: r.CreatedAt,
-			UpdatedAt: r.UpdatedAt,
-			Body:      r.Body,
-			UserId:    r.UserID,
+	authors := make(map[uuid.UUID]*chirpAuthor, len(rows))
+	for _, r := range rows {
+		authors[r.ID] = &chirpAuthor{
+			Id:          r.ID,
+			Email:       r.Email,
+			IsChirpyRed: r.IsChirpyRed,
+		}
+	}
+	for i := range chirps {
+		chirps[i].Author = authors[chirps[i].UserId]
+	}
+	return nil
+}
+
+func (a *apiConfig) postChirps(rw http.ResponseWriter, rq *http.Request) {
+	type inputChirp struct {
+		Body     string `json:"body"`
+		QuoteOf  string `json:"quote_of"`
+		ParentID string `json:"parent_id"`
+	}
+
+	chrp := inputChirp{}
+	if !a.decodeJSON(rw, rq, &chrp) {
+		return
+	}
+
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := validateChirpBody(
+		chrp.Body,
+		a.badWords,
+		a.chirpLengthLimit(),
+	)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	quoteOf := uuid.NullUUID{}
+	if chrp.QuoteOf != "" {
+		quoteOf.UUID, err = uuid.Parse(chrp.QuoteOf)
+		if err != nil {
+			fmt.Printf("postChirps: %v\n", err)
+			respondWithError(rw, http.StatusBadRequest, "invalid quote_of")
+			return
+		}
+		quoteOf.Valid = true
+	}
+
+	parentID := uuid.NullUUID{}
+	if chrp.ParentID != "" {
+		parentID.UUID, err = uuid.Parse(chrp.ParentID)
+		if err != nil {
+			fmt.Printf("postChirps: %v\n", err)
+			respondWithError(rw, http.StatusBadRequest, "invalid parent_id")
+			return
+		}
+		parentID.Valid = true
+	}
+
+	tx, qtx, err := a.beginTx(rq.Context())
+	if err != nil {
+		fmt.Printf("postChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if quoteOf.Valid {
+		// Lock the quoted chirp so concurrent quotes can't both slip
+		// under the cap.
+		quoted, err := qtx.GetChirpForUpdate(rq.Context(), quoteOf.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("postChirps: %v\n", err)
+			respondWithError(rw, http.StatusNotFound, "quoted chirp not found")
+			return
+		} else if err != nil {
+			fmt.Printf("postChirps: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if a.quoteLimitReached(quoted.QuoteCount) {
+			respondWithError(
+				rw,
+				http.StatusTooManyRequests,
+				"chirp has been quoted too many times",
+			)
+			return
+		}
+
+		err = qtx.IncrementQuoteCount(rq.Context(), quoteOf.UUID)
+		if err != nil {
+			fmt.Printf("postChirps: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if parentID.Valid {
+		_, err = qtx.GetChirp(rq.Context(), parentID.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("postChirps: %v\n", err)
+			respondWithError(rw, http.StatusNotFound, "parent chirp not found")
+			return
+		} else if err != nil {
+			fmt.Printf("postChirps: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	r, err := qtx.CreateChirp(
+		rq.Context(),
+		database.CreateChirpParams{
+			Body:     body,
+			UserID:   userID,
+			QuoteOf:  quoteOf,
+			ParentID: parentID,
+		},
+	)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Printf("postChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.chirpsCreated.Add(1)
+	if quoteOf.Valid {
+		// Its quote_count just changed.
+		a.chirpCache.remove(quoteOf.UUID)
+	}
+
+	respBody := chirpFromRow(r)
+	err = a.expandQuote(rq.Context(), &respBody)
+	if err != nil {
+		fmt.Printf("postChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.chirpWebhook.chirpCreated(respBody)
+	a.chirpBroker.publish(respBody)
+
+	dat, err := json.Marshal(respBody)
+	if err != nil {
+		fmt.Printf("postChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Location", "/api/chirps/"+r.ID.String())
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(dat)
+}
+
+// maxChirpLength is the longest chirp body, in characters, unless MAX_CHIRP_LENGTH
+// says otherwise.
+const maxChirpLength = 140
+
+var (
+	errChirpEmpty   = errors.New("Chirp is empty")
+	errChirpTooLong = errors.New("Chirp is too long")
+)
+
+// validateChirpBody censors body and checks that the result is a postable
+// chirp no longer than maxLength, returning the cleaned body.
+func validateChirpBody(
+	body string,
+	badWords []string,
+	maxLength int,
+) (string, error) {
+	if body == "" {
+		return "", errChirpEmpty
+	}
+
+	body = cleanString(body, badWords)
+	if utf8.RuneCountInString(body) > maxLength {
+		return "", fmt.Errorf(
+			"%w: the limit is %d characters",
+			errChirpTooLong,
+			maxLength,
+		)
+	}
+
+	return body, nil
+}
+
+var defaultBadWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// parseWordList splits a comma- or newline-separated list of words,
+// lowercasing them to match how censorWord compares.
+func parseWordList(s string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// badWordsFromEnv loads the censored words from the file named by
+// BAD_WORDS_FILE, or else from the comma-separated BAD_WORDS. Without either
+// it returns defaultBadWords.
+func badWordsFromEnv() ([]string, error) {
+	list := os.Getenv("BAD_WORDS")
+	if path := os.Getenv("BAD_WORDS_FILE"); path != "" {
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("badWordsFromEnv: %w", err)
+		}
+		list = string(dat)
+	}
+
+	words := parseWordList(list)
+	if len(words) == 0 {
+		return defaultBadWords, nil
+	}
+	return words, nil
+}
+
+func cleanString(s string, badWords []string) string {
+	var cleaned strings.Builder
+	for len(s) > 0 {
+		wordStart := strings.IndexFunc(s, func(r rune) bool {
+			return !unicode.IsSpace(r)
+		})
+		if wordStart == -1 {
+			cleaned.WriteString(s)
+			break
+		}
+		cleaned.WriteString(s[:wordStart])
+		s = s[wordStart:]
+
+		wordEnd := strings.IndexFunc(s, unicode.IsSpace)
+		if wordEnd == -1 {
+			wordEnd = len(s)
+		}
+		cleaned.WriteString(censorWord(s[:wordEnd], badWords))
+		s = s[wordEnd:]
+	}
+
+	return cleaned.String()
+}
+
+// censorWord replaces w with asterisks if, ignoring case and any leading or
+// trailing punctuation, it is one of badWords. The punctuation is kept so
+// "Sharbert!" becomes "****!".
+func censorWord(w string, badWords []string) string {
+	isWordRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	start := strings.IndexFunc(w, isWordRune)
+	if start == -1 {
+		return w
+	}
+	end := strings.LastIndexFunc(w, isWordRune)
+	_, size := utf8.DecodeRuneInString(w[end:])
+	end += size
+
+	core := strings.ToLower(w[start:end])
+	for _, b := range badWords {
+		if core == b {
+			return w[:start] + "****" + w[end:]
+		}
+	}
+	return w
+}
+
+func (a *apiConfig) postUsers(rw http.ResponseWriter, rq *http.Request) {
+	type input struct {
+		Password   string `json:"password"`
+		Email      string `json:"email"`
+		InviteCode string `json:"invite_code"`
+	}
+
+	newUser := input{}
+	if !a.decodeJSON(rw, rq, &newUser) {
+		return
+	}
+
+	if newUser.Email == "" || newUser.Password == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	newUser.Email = auth.NormalizeEmail(newUser.Email)
+	if err := auth.ValidateEmail(newUser.Email); err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, "invalid email address")
+		return
+	}
+
+	if a.inviteOnly && newUser.InviteCode == "" {
+		respondWithError(rw, http.StatusForbidden, "invite code required")
+		return
+	}
+
+	err := auth.ValidatePasswordStrength(
+		newUser.Password,
+		a.minPasswordLength,
+	)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hashedPassword, err := auth.HashPasswordWithCost(
+		newUser.Password,
+		a.passwordCost(),
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tx, qtx, err := a.beginTx(rq.Context())
+	if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// The invite is claimed before anything else so a bad code fails before
+	// the user is created. Who used it is filled in once the user exists.
+	if a.inviteOnly {
+		_, err = qtx.UseInvite(rq.Context(), newUser.InviteCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("apiConfig.postUsers: %v\n", err)
+			respondWithError(rw, http.StatusForbidden, "invalid invite code")
+			return
+		} else if err != nil {
+			fmt.Printf("apiConfig.postUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	r, err := qtx.CreateUser(
+		rq.Context(),
+		database.CreateUserParams{
+			Email:          newUser.Email,
+			HashedPassword: hashedPassword,
+		},
+	)
+	if isUniqueViolation(err) {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		respondWithError(rw, http.StatusConflict, "email already registered")
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if a.inviteOnly {
+		err = qtx.SetInviteUsedBy(
+			rq.Context(),
+			database.SetInviteUsedByParams{
+				Code:   newUser.InviteCode,
+				UsedBy: uuid.NullUUID{UUID: r.ID, Valid: true},
+			},
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.postUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	verificationToken, err := a.issueVerificationToken(rq.Context(), qtx, r)
+	if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respBody := userFromRow(r)
+
+	// ?login=true also logs the new user in, saving a round trip. The refresh
+	// token is created in the same transaction as the user.
+	if rq.URL.Query().Get("login") == "true" {
+		tokenString, expiresAt, err := auth.MakeJWTWithExpiry(
+			r.ID,
+			a.secret,
+			a.audience(),
+			a.jwtExpiry,
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.postUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		refreshToken, err := a.makeRefreshToken()
+		if err != nil {
+			fmt.Printf("apiConfig.postUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, err = qtx.CreateRefreshToken(
+			rq.Context(),
+			database.CreateRefreshTokenParams{
+				Token:     refreshToken,
+				UserID:    r.ID,
+				ExpiresAt: a.refreshTokenExpiresAt(),
+				UserAgent: sessionUserAgent(rq),
+				IpAddress: sessionIP(rq),
+			},
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.postUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		respBody.Token = tokenString
+		respBody.RefreshToken = refreshToken
+		respBody.ExpiresAt = &expiresAt
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.usersCreated.Add(1)
+
+	// The account exists whether or not the mail goes out, so a delivery
+	// failure is only logged.
+	err = a.mailVerificationToken(rq.Context(), r, verificationToken)
+	if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+	}
+
+	dat, err := json.Marshal(respBody)
+	if err != nil {
+		fmt.Printf("apiConfig.postUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Location", "/api/users/"+r.ID.String())
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(dat)
+}
+
+// uniqueViolation is the Postgres error code raised when an insert or update
+// would break a UNIQUE constraint.
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == uniqueViolation
+	}
+
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) &&
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+const maxSearchLength = 140
+
+// chirpSortColumns whitelists the sort_by values getChirps accepts. The value
+// is passed to the query as a parameter and matched against fixed columns, so
+// it never reaches the SQL text.
+var chirpSortColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// escapeLike escapes the LIKE wildcards in term so it matches literally.
+func escapeLike(term string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`%`, `\%`,
+		`_`, `\_`,
+	).Replace(term)
+}
+
+// parseCreatedRange reads the optional RFC 3339 start and end query
+// parameters getChirps filters created_at by. Both bounds are inclusive and
+// either may be left out for an open-ended range.
+func parseCreatedRange(query url.Values) (sql.NullTime, sql.NullTime, error) {
+	bounds := [2]sql.NullTime{}
+	for i, name := range []string{"start", "end"} {
+		val := query.Get(name)
+		if val == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return sql.NullTime{}, sql.NullTime{}, fmt.Errorf(
+				"invalid %s: %q",
+				name,
+				val,
+			)
+		}
+		bounds[i] = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	start, end := bounds[0], bounds[1]
+	if start.Valid && end.Valid && start.Time.After(end.Time) {
+		return sql.NullTime{}, sql.NullTime{}, errors.New(
+			"start is after end",
+		)
+	}
+
+	return start, end, nil
+}
+
+func (a *apiConfig) getChirps(rw http.ResponseWriter, rq *http.Request) {
+	if rq.URL.Query().Has("ids") {
+		a.getChirpsByIDs(rw, rq)
+		return
+	}
+
+	authorID := rq.URL.Query().Get("author_id")
+	search := rq.URL.Query().Get("search")
+	sortDesc := rq.URL.Query().Get("sort") == "desc"
+	sortBy := cmp.Or(rq.URL.Query().Get("sort_by"), "created_at")
+
+	pg, err := parsePage(rq.URL.Query())
+	if err != nil {
+		fmt.Printf("apiConfig.getChirps: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !chirpSortColumns[sortBy] {
+		respondWithError(
+			rw,
+			http.StatusBadRequest,
+			fmt.Sprintf("invalid sort_by: %q", sortBy),
+		)
+		return
+	}
+
+	// Listings that pass before are paged by keyset, newest first: a full
+	// page comes with an X-Next-Cursor to send back as before, which unlike
+	// offset doesn't skip or repeat chirps when others are posted or deleted
+	// in between. An empty before starts from the newest chirp.
+	keyset := rq.URL.Query().Has("before")
+	cursor := chirpCursor{}
+	hasCursor := rq.URL.Query().Get("before") != ""
+	if keyset {
+		if rq.URL.Query().Has("offset") || sortBy != "created_at" {
+			respondWithError(
+				rw,
+				http.StatusBadRequest,
+				"before can't be combined with offset or sort_by",
+			)
+			return
+		}
+	}
+	if hasCursor {
+		cursor, err = parseCursor(rq.URL.Query().Get("before"))
+		if err != nil {
+			fmt.Printf("apiConfig.getChirps: %v\n", err)
+			respondWithError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	start, end, err := parseCreatedRange(rq.URL.Query())
+	if err != nil {
+		fmt.Printf("apiConfig.getChirps: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(search) > maxSearchLength {
+		respondWithError(rw, http.StatusBadRequest, "search term is too long")
+		return
+	}
+
+	author := uuid.NullUUID{}
+	if authorID != "" {
+		author.UUID, err = uuid.Parse(authorID)
+		if err != nil {
+			fmt.Printf("apiConfig.getChirps: %v\n", err)
+			respondWithError(rw, http.StatusBadRequest, "invalid author_id")
+			return
+		}
+		author.Valid = true
+
+		// An unknown author would otherwise look like one with no chirps.
+		_, err = a.qry.GetUserByID(rq.Context(), author.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("apiConfig.getChirps: %v\n", err)
+			respondWithError(rw, http.StatusNotFound, "author not found")
+			return
+		} else if err != nil {
+			fmt.Printf("apiConfig.getChirps: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var rows []database.Chirp
+
+	switch {
+	case keyset:
+		rows, err = a.qry.GetChirpsBefore(
+			rq.Context(),
+			database.GetChirpsBeforeParams{
+				UserID: author,
+				Term: sql.NullString{
+					String: escapeLike(search),
+					Valid:  search != "",
+				},
+				StartTime: start,
+				EndTime:   end,
+				BeforeCreatedAt: sql.NullTime{
+					Time:  cursor.CreatedAt,
+					Valid: hasCursor,
+				},
+				BeforeID: uuid.NullUUID{UUID: cursor.ID, Valid: hasCursor},
+				RowLimit: pg.Limit,
+			},
+		)
+	case search != "":
+		rows, err = a.qry.SearchChirps(
+			rq.Context(),
+			database.SearchChirpsParams{
+				Term:      escapeLike(search),
+				UserID:    author,
+				StartTime: start,
+				EndTime:   end,
+				SortBy:    sortBy,
+				SortDesc:  sortDesc,
+				RowLimit:  pg.Limit,
+				RowOffset: pg.Offset,
+			},
+		)
+	case start.Valid || end.Valid:
+		rows, err = a.qry.GetChirpsByCreatedAtRange(
+			rq.Context(),
+			database.GetChirpsByCreatedAtRangeParams{
+				UserID:    author,
+				StartTime: start,
+				EndTime:   end,
+				SortBy:    sortBy,
+				SortDesc:  sortDesc,
+				RowLimit:  pg.Limit,
+				RowOffset: pg.Offset,
+			},
+		)
+	case author.Valid:
+		rows, err = a.qry.GetChirpsByUserIDPaged(
+			rq.Context(),
+			database.GetChirpsByUserIDPagedParams{
+				UserID:    author.UUID,
+				SortBy:    sortBy,
+				SortDesc:  sortDesc,
+				RowLimit:  pg.Limit,
+				RowOffset: pg.Offset,
+			},
+		)
+	default:
+		rows, err = a.qry.GetAllChirpsPaged(
+			rq.Context(),
+			database.GetAllChirpsPagedParams{
+				SortBy:    sortBy,
+				SortDesc:  sortDesc,
+				RowLimit:  pg.Limit,
+				RowOffset: pg.Offset,
+			},
+		)
+	}
+	if err != nil {
+		fmt.Printf("apiConfig.getChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	total, err := a.qry.GetChirpCount(
+		rq.Context(),
+		database.GetChirpCountParams{
+			UserID: author,
+			Term: sql.NullString{
+				String: escapeLike(search),
+				Valid:  search != "",
+			},
+			StartTime: start,
+			EndTime:   end,
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	chirps, err := a.chirpsFromRows(rq.Context(), rows)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if wantsAuthor(rq.URL.Query()) {
+		err = a.expandAuthors(rq.Context(), chirps)
+		if err != nil {
+			fmt.Printf("apiConfig.getChirps: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 	}
 	dat, err := json.Marshal(chirps)
@@ -352,22 +1560,115 @@ func (a *apiConfig) getChirps(rw http.ResponseWriter, rq *http.Request) {
 	}
 
 	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if keyset && pg.Limit > 0 && len(rows) == int(pg.Limit) {
+		last := rows[len(rows)-1]
+		next := chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		rw.Header().Set("X-Next-Cursor", next.String())
+	}
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(dat)
 }
 
+// getChirpsByIDs serves getChirps with ids, a comma-separated list of up to
+// maxPageLimit chirp IDs. The chirps come back in the order asked for, and
+// ones that don't exist or were deleted are left out. The other list
+// parameters don't apply, except expand.
+func (a *apiConfig) getChirpsByIDs(rw http.ResponseWriter, rq *http.Request) {
+	ids := []uuid.UUID{}
+	for val := range strings.SplitSeq(rq.URL.Query().Get("ids"), ",") {
+		id, err := uuid.Parse(strings.TrimSpace(val))
+		if err != nil {
+			fmt.Printf("apiConfig.getChirpsByIDs: %v\n", err)
+			respondWithError(
+				rw,
+				http.StatusBadRequest,
+				fmt.Sprintf("invalid id: %q", val),
+			)
+			return
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxPageLimit {
+		respondWithError(
+			rw,
+			http.StatusBadRequest,
+			fmt.Sprintf("at most %d ids", maxPageLimit),
+		)
+		return
+	}
+
+	rows, err := a.qry.GetChirpsByIDs(rq.Context(), ids)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsByIDs: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slices.SortFunc(rows, func(x, y database.Chirp) int {
+		return slices.Index(ids, x.ID) - slices.Index(ids, y.ID)
+	})
+
+	chirps, err := a.chirpsFromRows(rq.Context(), rows)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsByIDs: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if wantsAuthor(rq.URL.Query()) {
+		err = a.expandAuthors(rq.Context(), chirps)
+		if err != nil {
+			fmt.Printf("apiConfig.getChirpsByIDs: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	respondWithJSON(rw, http.StatusOK, chirps)
+}
+
+// getChirpsCount reports how many chirps there are, optionally only those by
+// author_id.
+func (a *apiConfig) getChirpsCount(rw http.ResponseWriter, rq *http.Request) {
+	author := uuid.NullUUID{}
+	if authorID := rq.URL.Query().Get("author_id"); authorID != "" {
+		id, err := uuid.Parse(authorID)
+		if err != nil {
+			fmt.Printf("apiConfig.getChirpsCount: %v\n", err)
+			respondWithError(rw, http.StatusBadRequest, "invalid author_id")
+			return
+		}
+		author = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	count, err := a.qry.GetChirpCount(
+		rq.Context(),
+		database.GetChirpCountParams{UserID: author},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsCount: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	type response struct {
+		Count int64 `json:"count"`
+	}
+	respondWithJSON(rw, http.StatusOK, response{Count: count})
+}
+
 func (a *apiConfig) getChirpsChirpID(
 	rw http.ResponseWriter,
 	rq *http.Request,
 ) {
-	id, err := uuid.Parse(rq.PathValue("chirpID"))
+	id, err := parsePathUUID(rq, "chirpID")
 	if err != nil {
 		fmt.Printf("apiConfig.getChirpsChirpID: %v\n", err)
-		rw.WriteHeader(http.StatusBadRequest)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	row, err := a.qry.GetChirp(rq.Context(), id)
+	row, err := a.getChirpCached(rq.Context(), id)
 	if errors.Is(err, sql.ErrNoRows) {
 		fmt.Printf("apiConfig.getChirpsChirpID: %v\n", err)
 		rw.WriteHeader(http.StatusNotFound)
@@ -378,34 +1679,320 @@ func (a *apiConfig) getChirpsChirpID(
 		return
 	}
 
-	chrp := chirp{
-		Id:        row.ID,
-		CreatedAt: row.CreatedAt,
-		UpdatedAt: row.UpdatedAt,
-		Body:      row.Body,
-		UserId:    row.UserID,
-	}
-
-	dat, err := json.Marshal(chrp)
+	dat, err := a.chirpJSON(rq.Context(), row, wantsAuthor(rq.URL.Query()))
 	if err != nil {
 		fmt.Printf("apiConfig.getChirpsChirpID: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	etag := etagFor(dat)
+	rw.Header().Set("ETag", etag)
+	if etagMatches(rq.Header.Get("If-None-Match"), etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	rw.Header().Set("Content-Type", "application/json")
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(dat)
 }
 
+// chirpJSON renders row the way getChirpsChirpID sends it, so its ETag can be
+// recomputed when checking If-Match.
+func (a *apiConfig) chirpJSON(
+	ctx context.Context,
+	row database.Chirp,
+	withAuthor bool,
+) ([]byte, error) {
+	chrp := chirpFromRow(row)
+	err := a.expandQuote(ctx, &chrp)
+	if err != nil {
+		return nil, fmt.Errorf("chirpJSON: %w", err)
+	}
+
+	err = a.loadLikeCount(ctx, &chrp)
+	if err != nil {
+		return nil, fmt.Errorf("chirpJSON: %w", err)
+	}
+
+	if withAuthor {
+		expanded := []chirp{chrp}
+		err = a.expandAuthors(ctx, expanded)
+		if err != nil {
+			return nil, fmt.Errorf("chirpJSON: %w", err)
+		}
+		chrp = expanded[0]
+	}
+
+	dat, err := json.Marshal(chrp)
+	if err != nil {
+		return nil, fmt.Errorf("chirpJSON: %w", err)
+	}
+	return dat, nil
+}
+
+// getChirpsChirpIDReplies lists the direct replies to a chirp, oldest first.
+func (a *apiConfig) getChirpsChirpIDReplies(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	id, err := parsePathUUID(rq, "chirpID")
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsChirpIDReplies: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pg, err := parsePage(rq.URL.Query())
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsChirpIDReplies: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = a.qry.GetChirp(rq.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.getChirpsChirpIDReplies: %v\n", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.getChirpsChirpIDReplies: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := a.qry.GetChirpReplies(
+		rq.Context(),
+		database.GetChirpRepliesParams{
+			ParentID:  id,
+			RowLimit:  pg.Limit,
+			RowOffset: pg.Offset,
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsChirpIDReplies: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	chirps, err := a.chirpsFromRows(rq.Context(), rows)
+	if err != nil {
+		fmt.Printf("apiConfig.getChirpsChirpIDReplies: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, chirps)
+}
+
+func (a *apiConfig) putChirpsChirpID(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	chirpID, err := parsePathUUID(rq, "chirpID")
+	if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	type input struct {
+		Body string `json:"body"`
+	}
+
+	inp := input{}
+	if !a.decodeJSON(rw, rq, &inp) {
+		return
+	}
+
+	// The row stays locked from the If-Match check until the update commits
+	// so two editors can't both pass the check.
+	tx, qtx, err := a.beginTx(rq.Context())
+	if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	row, err := qtx.GetChirpForUpdate(rq.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if row.UserID != userID {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if a.editWindowExpired(row.CreatedAt) {
+		respondWithError(rw, http.StatusForbidden, "edit window expired")
+		return
+	}
+
+	ifMatch := rq.Header.Get("If-Match")
+	if ifMatch != "" {
+		ok, err := a.ifMatchChirp(rq.Context(), ifMatch, row)
+		if err != nil {
+			fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			respondWithError(
+				rw,
+				http.StatusPreconditionFailed,
+				"chirp has been modified",
+			)
+			return
+		}
+	}
+
+	inp.Body, err = validateChirpBody(
+		inp.Body,
+		a.badWords,
+		a.chirpLengthLimit(),
+	)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	row, err = qtx.UpdateChirp(
+		rq.Context(),
+		database.UpdateChirpParams{ID: chirpID, Body: inp.Body},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.chirpsEdited.Add(1)
+	a.chirpCache.remove(chirpID)
+
+	chrp := chirpFromRow(row)
+	err = a.expandQuote(rq.Context(), &chrp)
+	if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = a.loadLikeCount(rq.Context(), &chrp)
+	if err != nil {
+		fmt.Printf("apiConfig.putChirpsChirpID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, chrp)
+}
+
 type user struct {
 	Id           uuid.UUID `json:"id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	// ExpiresAt is when Token stops being accepted.
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	IsChirpyRed   bool       `json:"is_chirpy_red"`
+	EmailVerified bool       `json:"email_verified"`
+}
+
+// userFromRow returns the public fields of r with timestamps in UTC. Tokens
+// are only ever filled in by the login flow.
+func userFromRow(r database.User) user {
+	return user{
+		Id:            r.ID,
+		CreatedAt:     r.CreatedAt.UTC(),
+		UpdatedAt:     r.UpdatedAt.UTC(),
+		Email:         r.Email,
+		IsChirpyRed:   r.IsChirpyRed,
+		EmailVerified: r.EmailVerified,
+	}
+}
+
+// getMe returns the user the access token was issued to. A token for a user
+// that has since been deleted is treated as invalid.
+func (a *apiConfig) getMe(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	row, err := a.qry.GetUserByID(rq.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.getMe: %v\n", err)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.getMe: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, userFromRow(row))
+}
+
+func (a *apiConfig) getUsersUserID(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	userID, err := parsePathUUID(rq, "userID")
+	if err != nil {
+		fmt.Printf("apiConfig.getUsersUserID: %v\n", err)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	row, err := a.qry.GetUserByID(rq.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.getUsersUserID: %v\n", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.getUsersUserID: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(rw, http.StatusOK, userFromRow(row))
+}
+
+// dummyPasswordHash is a valid bcrypt hash, at auth.DefaultCost, of a password
+// nobody uses. postLogin checks against it when the email is unknown so that
+// path costs as much as a wrong password; otherwise how quickly a login fails
+// would tell an attacker whether the account exists. main replaces it with a
+// fresh hash when BCRYPT_COST isn't the default.
+const dummyPasswordHash = "$2a$10$hRjVIOV4.jwtg90duJBb7.5FRWcSp8AonLNSv8P3l6JPvZFm1mtnC"
+
+func respondLoginFailed(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.WriteHeader(http.StatusUnauthorized)
+	rw.Write([]byte("Incorrect email or password"))
 }
 
 func (a *apiConfig) postLogin(rw http.ResponseWriter, rq *http.Request) {
@@ -414,51 +2001,153 @@ func (a *apiConfig) postLogin(rw http.ResponseWriter, rq *http.Request) {
 		Email    string `json:"email"`
 	}
 
-	decoder := json.NewDecoder(rq.Body)
+	limitKey := clientIP(rq)
+	ok, retryAfter := a.loginLimiter.allow(limitKey)
+	if !ok {
+		rw.Header().Set(
+			"Retry-After",
+			strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+		)
+		respondWithError(
+			rw,
+			http.StatusTooManyRequests,
+			"too many failed login attempts",
+		)
+		return
+	}
+
+	// Browsers posting a plain HTML form send it form-encoded; everyone else
+	// sends JSON. A missing Content-Type is treated as JSON.
 	inp := input{}
-	err := decoder.Decode(&inp)
+	contentType := cmp.Or(rq.Header.Get("Content-Type"), "application/json")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	switch mediaType {
+	case "application/json":
+		if !a.decodeJSON(rw, rq, &inp) {
+			return
+		}
+	case "application/x-www-form-urlencoded":
+		if !a.decodeForm(rw, rq) {
+			return
+		}
+		inp.Email = rq.PostForm.Get("email")
+		inp.Password = rq.PostForm.Get("password")
+	default:
+		respondWithError(
+			rw,
+			http.StatusUnsupportedMediaType,
+			"unsupported content type",
+		)
+		return
+	}
+
+	// The user lookup and the new refresh token share a transaction so a
+	// failure partway through never leaves a token nobody was given.
+	tx, qtx, err := a.beginTx(rq.Context())
 	if err != nil {
 		fmt.Printf("apiConfig.postLogin: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	row, err := a.qry.GetUserByEmail(rq.Context(), inp.Email)
-	if err != nil {
+	row, err := qtx.GetUserByEmail(
+		rq.Context(),
+		auth.NormalizeEmail(inp.Email),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// An unknown email gets the same answer as a wrong password, in the
+		// same time, so the response doesn't reveal which accounts exist.
+		auth.CheckPasswordHash(
+			inp.Password,
+			cmp.Or(a.dummyHash, dummyPasswordHash),
+		)
+		a.loginLimiter.fail(limitKey)
+		respondLoginFailed(rw)
+		return
+	} else if err != nil {
 		fmt.Printf("apiConfig.postLogin: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	// A locked account is refused even with the right password, otherwise
+	// the lockout would still let an attacker confirm a guess.
+	if row.LockedUntil.Valid && a.clock().Before(row.LockedUntil.Time) {
+		retryAfter := row.LockedUntil.Time.Sub(a.clock())
+		rw.Header().Set(
+			"Retry-After",
+			strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+		)
+		respondWithError(rw, http.StatusLocked, "account is locked")
+		return
+	}
+
 	if err := auth.CheckPasswordHash(
 		inp.Password,
 		row.HashedPassword,
 	); err != nil {
-		rw.Header().Set("Content-Type", "text/plain")
-		rw.WriteHeader(http.StatusUnauthorized)
-		rw.Write([]byte("Incorrect email or password"))
+		a.loginLimiter.fail(limitKey)
+		err = a.recordFailedLogin(rq.Context(), tx, qtx, row.ID)
+		if err != nil {
+			fmt.Printf("apiConfig.postLogin: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		respondLoginFailed(rw)
 		return
 	}
 
-	tokenString, err := auth.MakeJWT(row.ID, a.secret, time.Hour)
+	a.loginLimiter.reset(limitKey)
+
+	if row.FailedLoginCount != 0 || row.LockedUntil.Valid {
+		err = qtx.ResetFailedLogins(rq.Context(), row.ID)
+		if err != nil {
+			fmt.Printf("apiConfig.postLogin: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if auth.NeedsRehash(row.HashedPassword, a.passwordCost()) {
+		row, err = a.rehashPassword(rq.Context(), qtx, row, inp.Password)
+		if err != nil {
+			fmt.Printf("apiConfig.postLogin: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tokenString, expiresAt, err := auth.MakeJWTWithExpiry(
+		row.ID,
+		a.secret,
+		a.audience(),
+		a.jwtExpiry,
+	)
 	if err != nil {
 		fmt.Printf("apiConfig.postLogin: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
+	refreshToken, err := a.makeRefreshToken()
 	if err != nil {
 		fmt.Printf("apiConfig.postLogin: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	_, err = a.qry.CreateRefreshToken(
+	_, err = qtx.CreateRefreshToken(
 		rq.Context(),
 		database.CreateRefreshTokenParams{
-			Token:  refreshToken,
-			UserID: row.ID,
+			Token:     refreshToken,
+			UserID:    row.ID,
+			ExpiresAt: a.refreshTokenExpiresAt(),
+			UserAgent: sessionUserAgent(rq),
+			IpAddress: sessionIP(rq),
 		},
 	)
 	if err != nil {
@@ -467,15 +2156,10 @@ func (a *apiConfig) postLogin(rw http.ResponseWriter, rq *http.Request) {
 		return
 	}
 
-	loggedInUser := user{
-		Id:           row.ID,
-		CreatedAt:    row.CreatedAt,
-		UpdatedAt:    row.UpdatedAt,
-		Email:        row.Email,
-		IsChirpyRed:  row.IsChirpyRed,
-		Token:        tokenString,
-		RefreshToken: refreshToken,
-	}
+	loggedInUser := userFromRow(row)
+	loggedInUser.Token = tokenString
+	loggedInUser.RefreshToken = refreshToken
+	loggedInUser.ExpiresAt = &expiresAt
 
 	dat, err := json.Marshal(loggedInUser)
 	if err != nil {
@@ -484,11 +2168,78 @@ func (a *apiConfig) postLogin(rw http.ResponseWriter, rq *http.Request) {
 		return
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		fmt.Printf("apiConfig.postLogin: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.metrics.logins.Add(1)
+
 	rw.Header().Set("Content-Type", "application/json")
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(dat)
 }
 
+// recordFailedLogin counts a wrong password against the account and locks it
+// for lockoutDuration once lockoutThreshold failures in a row are reached. It
+// commits tx itself since the login is about to fail.
+func (a *apiConfig) recordFailedLogin(
+	ctx context.Context,
+	tx txn,
+	q Querier,
+	userID uuid.UUID,
+) error {
+	if a.lockoutThreshold <= 0 {
+		return nil
+	}
+
+	_, err := q.RecordFailedLogin(
+		ctx,
+		database.RecordFailedLoginParams{
+			MaxFailures: int32(a.lockoutThreshold),
+			LockUntil:   a.clock().Add(a.lockoutDuration).UTC(),
+			ID:          userID,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("recordFailedLogin: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("recordFailedLogin: %w", err)
+	}
+	return nil
+}
+
+// rehashPassword replaces u's stored hash with one made at the current cost.
+// It is only called after password has been checked against the old hash.
+func (a *apiConfig) rehashPassword(
+	ctx context.Context,
+	q Querier,
+	u database.User,
+	password string,
+) (database.User, error) {
+	hash, err := auth.HashPasswordWithCost(password, a.passwordCost())
+	if err != nil {
+		return database.User{}, fmt.Errorf("rehashPassword: %w", err)
+	}
+
+	u, err = q.UpdateUser(
+		ctx,
+		database.UpdateUserParams{
+			HashedPassword: sql.NullString{String: hash, Valid: true},
+			ID:             u.ID,
+		},
+	)
+	if err != nil {
+		return database.User{}, fmt.Errorf("rehashPassword: %w", err)
+	}
+
+	return u, nil
+}
+
 func (a *apiConfig) postRefresh(rw http.ResponseWriter, rq *http.Request) {
 	refreshToken, err := auth.GetBearerToken(rq.Header)
 	if err != nil {
@@ -497,9 +2248,28 @@ func (a *apiConfig) postRefresh(rw http.ResponseWriter, rq *http.Request) {
 		return
 	}
 
-	refreshTokenRow, err := a.qry.GetRefreshToken(rq.Context(), refreshToken)
+	tx, qtx, err := a.beginTx(rq.Context())
+	if err != nil {
+		fmt.Printf("apiConfig.postRefresh: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Each refresh token can be used once; consuming it revokes it so the
+	// client has to switch to the replacement issued below.
+	refreshTokenRow, err := qtx.ConsumeRefreshToken(rq.Context(), refreshToken)
 	if errors.Is(err, sql.ErrNoRows) {
 		fmt.Printf("apiConfig.postRefresh: %v\n", err)
+		tx.Rollback()
+
+		err = a.revokeOnReplay(rq.Context(), refreshToken)
+		if err != nil {
+			fmt.Printf("apiConfig.postRefresh: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		rw.WriteHeader(http.StatusUnauthorized)
 		return
 	} else if err != nil {
@@ -508,10 +2278,36 @@ func (a *apiConfig) postRefresh(rw http.ResponseWriter, rq *http.Request) {
 		return
 	}
 
-	tokenString, err := auth.MakeJWT(
+	newRefreshToken, err := a.makeRefreshToken()
+	if err != nil {
+		fmt.Printf("apiConfig.postRefresh: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = qtx.CreateRefreshToken(
+		rq.Context(),
+		database.CreateRefreshTokenParams{
+			Token:  newRefreshToken,
+			UserID: refreshTokenRow.UserID,
+			// The replacement keeps the original deadline so rotating
+			// can't extend a session forever.
+			ExpiresAt: refreshTokenRow.ExpiresAt,
+			UserAgent: sessionUserAgent(rq),
+			IpAddress: sessionIP(rq),
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.postRefresh: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tokenString, expiresAt, err := auth.MakeJWTWithExpiry(
 		refreshTokenRow.UserID,
 		a.secret,
-		time.Hour,
+		a.audience(),
+		a.jwtExpiry,
 	)
 	if err != nil {
 		fmt.Printf("apiConfig.postRefresh: %v\n", err)
@@ -520,9 +2316,15 @@ func (a *apiConfig) postRefresh(rw http.ResponseWriter, rq *http.Request) {
 	}
 
 	type response struct {
-		Token string `json:"token"`
+		Token        string    `json:"token"`
+		RefreshToken string    `json:"refresh_token"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+	tokenResp := response{
+		Token:        tokenString,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    expiresAt,
 	}
-	tokenResp := response{Token: tokenString}
 
 	dat, err := json.Marshal(tokenResp)
 	if err != nil {
@@ -531,11 +2333,42 @@ func (a *apiConfig) postRefresh(rw http.ResponseWriter, rq *http.Request) {
 		return
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		fmt.Printf("apiConfig.postRefresh: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	rw.Header().Set("Content-Type", "application/json")
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(dat)
 }
 
+// revokeOnReplay is called when a refresh token couldn't be consumed. If the
+// token exists but was already revoked, it has been used after rotation, which
+// means it may have been stolen, so every session for its user is revoked.
+func (a *apiConfig) revokeOnReplay(ctx context.Context, token string) error {
+	row, err := a.qry.GetRefreshTokenByToken(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("revokeOnReplay: %w", err)
+	}
+
+	if !row.RevokedAt.Valid {
+		// Expired rather than replayed.
+		return nil
+	}
+
+	err = a.qry.RevokeAllRefreshTokensForUser(ctx, row.UserID)
+	if err != nil {
+		return fmt.Errorf("revokeOnReplay: %w", err)
+	}
+
+	return nil
+}
+
 func (a *apiConfig) postRevoke(rw http.ResponseWriter, rq *http.Request) {
 	refreshToken, err := auth.GetBearerToken(rq.Header)
 	if err != nil {
@@ -552,17 +2385,92 @@ func (a *apiConfig) postRevoke(rw http.ResponseWriter, rq *http.Request) {
 	rw.WriteHeader(http.StatusNoContent)
 }
 
-func (a *apiConfig) putUsers(rw http.ResponseWriter, rq *http.Request) {
+func (a *apiConfig) postRevokeAll(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := a.qry.RevokeAllRefreshTokensForUser(rq.Context(), userID)
+	if err != nil {
+		fmt.Printf("apiConfig.postRevokeAll: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// isAccessTokenRevoked reports whether the access token with the given jti
+// has been put on the deny-list. Tokens issued before jtis were added have no
+// ID and can't be revoked individually.
+func (a *apiConfig) isAccessTokenRevoked(
+	ctx context.Context,
+	jti string,
+) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+
+	revoked, err := a.qry.IsAccessTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, fmt.Errorf("isAccessTokenRevoked: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// respondInvalidToken rejects a request whose access token failed validation.
+// The WWW-Authenticate header tells clients whether refreshing the token will
+// help or whether they have to log in again.
+func respondInvalidToken(rw http.ResponseWriter, err error) {
+	desc := "access token is invalid"
+	if errors.Is(err, auth.ErrTokenExpired) {
+		desc = "access token expired"
+	}
+	rw.Header().Set(
+		"WWW-Authenticate",
+		`Bearer error="invalid_token", error_description="`+desc+`"`,
+	)
+	rw.WriteHeader(http.StatusUnauthorized)
+}
+
+func (a *apiConfig) postRevokeAccess(rw http.ResponseWriter, rq *http.Request) {
 	tokenString, err := auth.GetBearerToken(rq.Header)
 	if err != nil {
-		fmt.Printf("apiConfig.putUsers: %v\n", err)
+		fmt.Printf("apiConfig.postRevokeAccess: %v\n", err)
 		rw.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(tokenString, a.secret)
+	userID, jti, err := auth.ValidateJWTWithID(
+		tokenString,
+		a.secret,
+		a.audience(),
+	)
+	if err != nil || jti == "" {
+		fmt.Printf("apiConfig.postRevokeAccess: %v\n", err)
+		respondInvalidToken(rw, err)
+		return
+	}
+
+	err = a.qry.RevokeAccessToken(
+		rq.Context(),
+		database.RevokeAccessTokenParams{Jti: jti, UserID: userID},
+	)
 	if err != nil {
-		fmt.Printf("apiConfig.putUsers: %v\n", err)
+		fmt.Printf("apiConfig.postRevokeAccess: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) putUsers(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
 		rw.WriteHeader(http.StatusUnauthorized)
 		return
 	}
@@ -572,44 +2480,128 @@ func (a *apiConfig) putUsers(rw http.ResponseWriter, rq *http.Request) {
 		Email    string
 	}
 
-	decoder := json.NewDecoder(rq.Body)
 	inp := input{}
-	err = decoder.Decode(&inp)
+	if !a.decodeJSON(rw, rq, &inp) {
+		return
+	}
+
+	if inp.Email == "" && inp.Password == "" {
+		respondWithError(rw, http.StatusBadRequest, "nothing to update")
+		return
+	}
+
+	// Fields left out of the request keep their current values.
+	params := database.UpdateUserParams{ID: userID}
+
+	if inp.Email != "" {
+		inp.Email = auth.NormalizeEmail(inp.Email)
+		if err := auth.ValidateEmail(inp.Email); err != nil {
+			fmt.Printf("apiConfig.putUsers: %v\n", err)
+			respondWithError(
+				rw,
+				http.StatusBadRequest,
+				"invalid email address",
+			)
+			return
+		}
+		params.Email = sql.NullString{String: inp.Email, Valid: true}
+	}
+
+	if inp.Password != "" {
+		err := auth.ValidatePasswordStrength(
+			inp.Password,
+			a.minPasswordLength,
+		)
+		if err != nil {
+			respondWithError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		hashedPassword, err := auth.HashPasswordWithCost(
+			inp.Password,
+			a.passwordCost(),
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.putUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		params.HashedPassword = sql.NullString{
+			String: hashedPassword,
+			Valid:  true,
+		}
+	}
+
+	tx, qtx, err := a.beginTx(rq.Context())
 	if err != nil {
 		fmt.Printf("apiConfig.putUsers: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	inp.Password, err = auth.HashPassword(inp.Password)
-	if err != nil {
+	oldRow, err := qtx.GetUserByID(rq.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.putUsers: %v\n", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		fmt.Printf("apiConfig.putUsers: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	userRow, err := a.qry.UpdateUser(
-		rq.Context(),
-		database.UpdateUserParams{
-			Email:          inp.Email,
-			HashedPassword: inp.Password,
-			ID:             userID,
-		},
-	)
+	userRow, err := qtx.UpdateUser(rq.Context(), params)
+	if isUniqueViolation(err) {
+		fmt.Printf("apiConfig.putUsers: %v\n", err)
+		respondWithError(rw, http.StatusConflict, "email already registered")
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.putUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The new address replaces the old one straight away, including for
+	// login, but is unverified until the user redeems the token sent here.
+	// Tokens sent to the old address are dropped so they can't verify it.
+	verificationToken := ""
+	if userRow.Email != oldRow.Email {
+		err = qtx.DeleteEmailVerificationTokensForUser(rq.Context(), userID)
+		if err != nil {
+			fmt.Printf("apiConfig.putUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		verificationToken, err = a.issueVerificationToken(
+			rq.Context(),
+			qtx,
+			userRow,
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.putUsers: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		fmt.Printf("apiConfig.putUsers: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	respBody := user{
-		Id:          userRow.ID,
-		CreatedAt:   userRow.CreatedAt,
-		UpdatedAt:   userRow.UpdatedAt,
-		Email:       userRow.Email,
-		IsChirpyRed: userRow.IsChirpyRed,
+	if verificationToken != "" {
+		err = a.mailVerificationToken(rq.Context(), userRow, verificationToken)
+		if err != nil {
+			fmt.Printf("apiConfig.putUsers: %v\n", err)
+		}
 	}
 
+	respBody := userFromRow(userRow)
+
 	dat, err := json.Marshal(respBody)
 	if err != nil {
 		fmt.Printf("apiConfig.putUsers: %v\n", err)
@@ -622,14 +2614,93 @@ func (a *apiConfig) putUsers(rw http.ResponseWriter, rq *http.Request) {
 	rw.Write(dat)
 }
 
+// deleteUsers deletes the caller's account. Their chirps, likes, follows and
+// tokens go with it through ON DELETE CASCADE.
+func (a *apiConfig) deleteUsers(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			ActorID: uuid.NullUUID{UUID: userID, Valid: true},
+			Action:  auditUserDelete,
+			Target:  userID.String(),
+		},
+		func(q Querier) error {
+			n, err := q.DeleteUser(rq.Context(), userID)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("apiConfig.deleteUsers: %v\n", err)
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("apiConfig.deleteUsers: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// The user's chirps went with them.
+	a.chirpCache.purge()
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// deleteChirps soft-deletes every chirp the caller has posted, like
+// deleteChirpsChirpID does one at a time, and reports how many there were in
+// X-Deleted-Count.
+func (a *apiConfig) deleteChirps(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var ids []uuid.UUID
+	err := a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			ActorID: uuid.NullUUID{UUID: userID, Valid: true},
+			Action:  auditChirpPurge,
+			Target:  userID.String(),
+		},
+		func(q Querier) error {
+			var err error
+			ids, err = q.SoftDeleteChirpsByUserID(rq.Context(), userID)
+			return err
+		},
+	)
+	if err != nil {
+		fmt.Printf("apiConfig.deleteChirps: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for _, id := range ids {
+		a.chirpCache.remove(id)
+	}
+
+	rw.Header().Set("X-Deleted-Count", strconv.Itoa(len(ids)))
+	rw.WriteHeader(http.StatusNoContent)
+}
+
 func (a *apiConfig) deleteChirpsChirpID(
 	rw http.ResponseWriter,
 	rq *http.Request,
 ) {
-	chirpID, err := uuid.Parse(rq.PathValue("chirpID"))
+	chirpID, err := parsePathUUID(rq, "chirpID")
 	if err != nil {
 		fmt.Printf("apiConfig.deleteChirpsChirpID: %v\n", err)
-		rw.WriteHeader(http.StatusBadRequest)
+		respondWithError(rw, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -644,16 +2715,8 @@ func (a *apiConfig) deleteChirpsChirpID(
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(rq.Header)
-	if err != nil {
-		fmt.Printf("apiConfig.deleteChirpsChirpID: %v\n", err)
-		rw.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(tokenString, a.secret)
-	if err != nil {
-		fmt.Printf("apiConfig.deleteChirpsChirpID: %v\n", err)
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
 		rw.WriteHeader(http.StatusUnauthorized)
 		return
 	}
@@ -663,40 +2726,80 @@ func (a *apiConfig) deleteChirpsChirpID(
 		return
 	}
 
-	err = a.qry.DeleteChirp(rq.Context(), chirpID)
+	err = a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			ActorID: uuid.NullUUID{UUID: userID, Valid: true},
+			Action:  auditChirpDelete,
+			Target:  chirpID.String(),
+		},
+		func(q Querier) error {
+			// The row is kept so replies and quotes still have something to
+			// point at; every read query skips soft-deleted chirps.
+			return q.SoftDeleteChirp(rq.Context(), chirpID)
+		},
+	)
 	if err != nil {
 		fmt.Printf("apiConfig.deleteChirpsChirpID: %v\n", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	a.metrics.chirpsDeleted.Add(1)
+	a.chirpCache.remove(chirpID)
 
 	rw.WriteHeader(http.StatusNoContent)
 }
 
+var errWebhookProcessed = errors.New("Webhook already processed")
+
 func (a *apiConfig) postPolkaWebhooks(
 	rw http.ResponseWriter,
 	rq *http.Request,
 ) {
 	apiKey, err := auth.GetAPIKey(rq.Header)
-	if err != nil || apiKey != a.polkaKey {
+	if err != nil || subtle.ConstantTimeCompare(
+		[]byte(apiKey),
+		[]byte(a.polkaKey),
+	) != 1 {
 		fmt.Printf("apiConfig.postPolkaWebhooks: %v\n", err)
 		rw.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
+	if a.polkaSigningSecret != "" {
+		body, err := io.ReadAll(
+			http.MaxBytesReader(rw, rq.Body, a.bodyLimit()),
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.postPolkaWebhooks: %v\n", err)
+			rw.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		err = auth.VerifyHMAC(
+			body,
+			rq.Header.Get("X-Polka-Signature"),
+			a.polkaSigningSecret,
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.postPolkaWebhooks: %v\n", err)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rq.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
 	type input struct {
+		ID    string `json:"id"`
 		Event string `json:"event"`
 		Data  struct {
 			UserID string `json:"user_id"`
 		} `json:"data"`
 	}
 
-	decoder := json.NewDecoder(rq.Body)
 	inp := input{}
-	err = decoder.Decode(&inp)
-	if err != nil {
-		fmt.Printf("apiConfig.postPolkaWebhooks: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+	if !a.decodeLenientJSON(rw, rq, &inp) {
 		return
 	}
 
@@ -712,10 +2815,41 @@ func (a *apiConfig) postPolkaWebhooks(
 		return
 	}
 
-	_, err = a.qry.UpdateToChirpyRed(rq.Context(), userID)
-	if errors.Is(err, sql.ErrNoRows) {
+	err = a.withAudit(
+		rq.Context(),
+		database.CreateAuditEntryParams{
+			Action: auditUserUpgrade,
+			Target: userID.String(),
+		},
+		func(q Querier) error {
+			// Polka retries deliveries it thinks failed, so an event ID we have
+			// already recorded is acknowledged without being applied again.
+			if inp.ID != "" {
+				n, err := q.MarkWebhookProcessed(
+					rq.Context(),
+					database.MarkWebhookProcessedParams{
+						ID:    inp.ID,
+						Event: inp.Event,
+					},
+				)
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					return errWebhookProcessed
+				}
+			}
+
+			_, err := q.UpdateToChirpyRed(rq.Context(), userID)
+			return err
+		},
+	)
+	if errors.Is(err, errWebhookProcessed) {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	} else if errors.Is(err, sql.ErrNoRows) {
 		fmt.Printf("apiConfig.postPolkaWebhooks: %v\n", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		rw.WriteHeader(http.StatusNotFound)
 		return
 	} else if err != nil {
 		fmt.Printf("apiConfig.postPolkaWebhooks: %v\n", err)
@@ -0,0 +1,3234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+var chirpColumns = []string{
+	"id", "created_at", "updated_at", "body", "user_id", "quote_of", "quote_count",
+	"parent_id", "deleted_at",
+}
+
+var userColumns = []string{
+	"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red",
+	"email_verified", "failed_login_count", "locked_until",
+}
+
+// newAuthedRequest builds a request carrying a fresh access token for userID.
+func newAuthedRequest(
+	t *testing.T,
+	method string,
+	target string,
+	userID uuid.UUID,
+	secret string,
+) *http.Request {
+	t.Helper()
+
+	token, err := auth.MakeJWT(userID, secret, auth.DefaultAudience, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	rq := httptest.NewRequest(method, target, nil)
+	rq.Header.Set("Authorization", "Bearer "+token)
+	return rq
+}
+
+// newPathRequest is newAuthedRequest for a route with a wildcard, setting the
+// path value name to value as the mux would.
+func newPathRequest(
+	t *testing.T,
+	method string,
+	target string,
+	name string,
+	value string,
+	userID uuid.UUID,
+	secret string,
+) *http.Request {
+	t.Helper()
+
+	rq := newAuthedRequest(t, method, target, userID, secret)
+	rq.SetPathValue(name, value)
+	return rq
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Unique violation",
+			err:  &pq.Error{Code: "23505"},
+			want: true,
+		},
+		{
+			name: "Wrapped unique violation",
+			err:  fmt.Errorf("CreateUser: %w", &pq.Error{Code: "23505"}),
+			want: true,
+		},
+		{
+			name: "Other postgres error",
+			err:  &pq.Error{Code: "23503"},
+			want: false,
+		},
+		{
+			name: "Non-postgres error",
+			err:  errors.New("connection refused"),
+			want: false,
+		},
+		{
+			name: "Nil error",
+			err:  nil,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("isUniqueViolation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRespondWithError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondWithError(rec, http.StatusConflict, "email already registered")
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("respondWithError() status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("respondWithError() Content-Type = %q, want application/json", ct)
+	}
+
+	body := struct {
+		Error string `json:"error"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("respondWithError() body is not JSON: %v", err)
+	}
+	if body.Error != "email already registered" {
+		t.Errorf("respondWithError() error = %q, want %q", body.Error, "email already registered")
+	}
+}
+
+func TestDurationEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{
+			name:  "Unset",
+			value: "",
+			want:  time.Hour,
+		},
+		{
+			name:  "Valid duration",
+			value: "15m",
+			want:  15 * time.Minute,
+		},
+		{
+			name:  "Unparseable",
+			value: "forever",
+			want:  time.Hour,
+		},
+		{
+			name:  "Negative",
+			value: "-5m",
+			want:  time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DURATION", tt.value)
+			if got := durationEnv("TEST_DURATION", time.Hour); got != tt.want {
+				t.Errorf("durationEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditWindowExpired(t *testing.T) {
+	createdAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		editWindow time.Duration
+		now        time.Time
+		want       bool
+	}{
+		{
+			name:       "Within window",
+			editWindow: 15 * time.Minute,
+			now:        createdAt.Add(10 * time.Minute),
+			want:       false,
+		},
+		{
+			name:       "At window boundary",
+			editWindow: 15 * time.Minute,
+			now:        createdAt.Add(15 * time.Minute),
+			want:       false,
+		},
+		{
+			name:       "After window",
+			editWindow: 15 * time.Minute,
+			now:        createdAt.Add(16 * time.Minute),
+			want:       true,
+		},
+		{
+			name:       "Window disabled",
+			editWindow: 0,
+			now:        createdAt.Add(24 * time.Hour),
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &apiConfig{
+				editWindow: tt.editWindow,
+				now:        func() time.Time { return tt.now },
+			}
+			if got := a.editWindowExpired(createdAt); got != tt.want {
+				t.Errorf("editWindowExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChirpFromRowQuote(t *testing.T) {
+	quotedID := uuid.New()
+
+	tests := []struct {
+		name        string
+		quoteOf     uuid.NullUUID
+		wantQuoteOf *uuid.UUID
+		wantJSONKey bool
+	}{
+		{
+			name:        "Plain chirp",
+			quoteOf:     uuid.NullUUID{},
+			wantQuoteOf: nil,
+			wantJSONKey: false,
+		},
+		{
+			name:        "Quote",
+			quoteOf:     uuid.NullUUID{UUID: quotedID, Valid: true},
+			wantQuoteOf: &quotedID,
+			wantJSONKey: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := chirpFromRow(database.Chirp{
+				ID:      uuid.New(),
+				Body:    "hello",
+				UserID:  uuid.New(),
+				QuoteOf: tt.quoteOf,
+			})
+
+			if (c.QuoteOf == nil) != (tt.wantQuoteOf == nil) ||
+				(c.QuoteOf != nil && *c.QuoteOf != *tt.wantQuoteOf) {
+				t.Errorf("chirpFromRow() QuoteOf = %v, want %v", c.QuoteOf, tt.wantQuoteOf)
+			}
+
+			dat, err := json.Marshal(c)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			fields := map[string]any{}
+			err = json.Unmarshal(dat, &fields)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if _, ok := fields["quote_of"]; ok != tt.wantJSONKey {
+				t.Errorf("chirp JSON has quote_of = %v, want %v", ok, tt.wantJSONKey)
+			}
+		})
+	}
+}
+
+func TestExpandQuotes(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, original := postChirp(t, a, u.Token, `{"body":"original"}`)
+	code, quote := postChirp(t, a, u.Token, `{"body":"quoting","quote_of":"`+original.Id.String()+`"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("postChirp() quote status = %d, want %d", code, http.StatusCreated)
+	}
+	postChirp(t, a, u.Token, `{"body":"plain"}`)
+
+	list := func() map[string]chirp {
+		t.Helper()
+
+		rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps", "", "")
+		var chirps []chirp
+		err := json.Unmarshal(rec.Body.Bytes(), &chirps)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		byBody := map[string]chirp{}
+		for _, c := range chirps {
+			byBody[c.Body] = c
+		}
+		return byBody
+	}
+
+	chirps := list()
+	if q := chirps["quoting"].Quoted; q == nil || q.Id != original.Id || q.Body != "original" {
+		t.Errorf("quoting chirp quoted = %+v, want the original", q)
+	}
+	if q := chirps["plain"].Quoted; q != nil {
+		t.Errorf("plain chirp quoted = %+v, want none", q)
+	}
+
+	rec := getChirpByID(t, a, quote.Id)
+	got := chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Quoted == nil || got.Quoted.Id != original.Id {
+		t.Errorf("getChirpsChirpID() quoted = %+v, want the original", got.Quoted)
+	}
+
+	rq := newAuthedRequest(t, http.MethodDelete, "/api/chirps/"+original.Id.String(), u.Id, a.secret)
+	rq.SetPathValue("chirpID", original.Id.String())
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if q := list()["quoting"].Quoted; q != nil {
+		t.Errorf("quoting chirp quoted = %+v after the original was deleted, want none", q)
+	}
+}
+
+func TestIsAccessTokenRevokedWithoutJTI(t *testing.T) {
+	a := &apiConfig{}
+	revoked, err := a.isAccessTokenRevoked(context.Background(), "")
+	if err != nil || revoked {
+		t.Errorf("isAccessTokenRevoked(\"\") = %v, %v, want false, nil", revoked, err)
+	}
+}
+
+func TestPostRevokeAccess(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	getMe := a.middlewareAuth(a.getMe)
+
+	rec := doJSON(t, getMe, http.MethodGet, "/api/me", u.Token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getMe() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = doJSON(t, a.postRevokeAccess, http.MethodPost, "/api/revoke-access", u.Token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("postRevokeAccess() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec = doJSON(t, getMe, http.MethodGet, "/api/me", u.Token, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("getMe() with a revoked token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestQuoteLimitReached(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxQuotes int32
+		count     int32
+		want      bool
+	}{
+		{
+			name:      "Below cap",
+			maxQuotes: 3,
+			count:     2,
+			want:      false,
+		},
+		{
+			name:      "At cap",
+			maxQuotes: 3,
+			count:     3,
+			want:      true,
+		},
+		{
+			name:      "Over cap",
+			maxQuotes: 3,
+			count:     4,
+			want:      true,
+		},
+		{
+			name:      "No cap",
+			maxQuotes: 0,
+			count:     1000,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &apiConfig{maxQuotes: tt.maxQuotes}
+			if got := a.quoteLimitReached(tt.count); got != tt.want {
+				t.Errorf("quoteLimitReached() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{
+			name:  "Unset",
+			value: "",
+			want:  10,
+		},
+		{
+			name:  "Valid",
+			value: "25",
+			want:  25,
+		},
+		{
+			name:  "Zero",
+			value: "0",
+			want:  0,
+		},
+		{
+			name:  "Unparseable",
+			value: "lots",
+			want:  10,
+		},
+		{
+			name:  "Negative",
+			value: "-1",
+			want:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_INT", tt.value)
+			if got := intEnv("TEST_INT", 10); got != tt.want {
+				t.Errorf("intEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanString(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "No bad words",
+			s:    "I had something interesting for breakfast",
+			want: "I had something interesting for breakfast",
+		},
+		{
+			name: "Bad word",
+			s:    "I hear Mastodon is better than Chirpy. sharbert I need to migrate",
+			want: "I hear Mastodon is better than Chirpy. **** I need to migrate",
+		},
+		{
+			name: "Capitalized bad words",
+			s:    "Kerfuffle and FORNAX",
+			want: "**** and ****",
+		},
+		{
+			name: "Trailing punctuation",
+			s:    "Sharbert!",
+			want: "****!",
+		},
+		{
+			name: "Surrounding punctuation",
+			s:    "what a (kerfuffle), really",
+			want: "what a (****), really",
+		},
+		{
+			name: "Bad word inside a longer word",
+			s:    "sharberts are not fornaxes",
+			want: "sharberts are not fornaxes",
+		},
+		{
+			name: "Original spacing is preserved",
+			s:    " leading  double\tkerfuffle ",
+			want: " leading  double\t**** ",
+		},
+		{
+			name: "Empty string",
+			s:    "",
+			want: "",
+		},
+		{
+			name: "Only punctuation",
+			s:    "?!",
+			want: "?!",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanString(tt.s, defaultBadWords); got != tt.want {
+				t.Errorf("cleanString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChirpBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "Valid body",
+			body:    "fixed my typo",
+			want:    "fixed my typo",
+			wantErr: nil,
+		},
+		{
+			name:    "Body is cleaned",
+			body:    "what a kerfuffle",
+			want:    "what a ****",
+			wantErr: nil,
+		},
+		{
+			name:    "Exactly 140 characters",
+			body:    strings.Repeat("a", 140),
+			want:    strings.Repeat("a", 140),
+			wantErr: nil,
+		},
+		{
+			name:    "140 multi-byte characters",
+			body:    strings.Repeat("é", 140),
+			want:    strings.Repeat("é", 140),
+			wantErr: nil,
+		},
+		{
+			name:    "Oversized body",
+			body:    strings.Repeat("a", 141),
+			want:    "",
+			wantErr: errChirpTooLong,
+		},
+		{
+			name:    "Empty body",
+			body:    "",
+			want:    "",
+			wantErr: errChirpEmpty,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateChirpBody(tt.body, defaultBadWords, maxChirpLength)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateChirpBody() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("validateChirpBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutChirpsChirpID(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.editWindow = time.Minute
+	u := signUpAndLogIn(t, a, "user@example.com")
+	other := signUpAndLogIn(t, a, "other@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"first draft"}`)
+
+	put := func(token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rq := httptest.NewRequest(
+			http.MethodPut,
+			"/api/chirps/"+c.Id.String(),
+			strings.NewReader(body),
+		)
+		rq.SetPathValue("chirpID", c.Id.String())
+		rq.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		a.middlewareAuth(a.putChirpsChirpID)(rec, rq)
+		return rec
+	}
+
+	rec := put(u.Token, `{"body":"second draft"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	got := chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Id != c.Id || got.Body != "second draft" {
+		t.Errorf("putChirpsChirpID() = %+v, want chirp %v with the new body", got, c.Id)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		now        time.Time
+		wantStatus int
+	}{
+		{
+			name:       "Not the author",
+			token:      other.Token,
+			body:       `{"body":"hijacked"}`,
+			now:        time.Now(),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Too long",
+			token:      u.Token,
+			body:       `{"body":"` + strings.Repeat("a", maxChirpLength+1) + `"}`,
+			now:        time.Now(),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Edit window closed",
+			token:      u.Token,
+			body:       `{"body":"too late"}`,
+			now:        time.Now().Add(2 * time.Minute),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.now = func() time.Time { return tt.now }
+
+			rec := put(tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("putChirpsChirpID() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := getChirpByID(t, a, c.Id); !strings.Contains(got.Body.String(), "second draft") {
+				t.Errorf("rejected edit changed the chirp: %s", got.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostChirpsCustomLengthLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		length     int
+		wantStatus int
+	}{
+		{
+			name:       "Default limit",
+			length:     maxChirpLength + 1,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Long-form within limit",
+			limit:      280,
+			length:     280,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Long-form over limit",
+			limit:      280,
+			length:     281,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Short limit",
+			limit:      10,
+			length:     11,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newFakeConfig()
+			a.maxChirpLength = tt.limit
+			u := signUpAndLogIn(t, a, "user@example.com")
+
+			body := `{"body":"` + strings.Repeat("a", tt.length) + `"}`
+			rec := doJSON(t, a.middlewareAuth(a.postChirps), http.MethodPost, "/api/chirps", u.Token, body)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("postChirps() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusBadRequest {
+				return
+			}
+			wantLimit := strconv.Itoa(a.chirpLengthLimit())
+			if !strings.Contains(rec.Body.String(), wantLimit) {
+				t.Errorf("postChirps() error = %s, want it to mention %s", rec.Body.String(), wantLimit)
+			}
+		})
+	}
+}
+
+func TestUserFromRowHidesSecrets(t *testing.T) {
+	u := userFromRow(database.User{
+		ID:             uuid.New(),
+		Email:          "foo@bar.com",
+		HashedPassword: "$2a$10$secrethash",
+		IsChirpyRed:    true,
+	})
+
+	dat, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	fields := map[string]any{}
+	err = json.Unmarshal(dat, &fields)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, key := range []string{"id", "created_at", "updated_at", "email", "is_chirpy_red"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("user JSON is missing %q", key)
+		}
+	}
+	for _, key := range []string{"hashed_password", "HashedPassword", "token", "refresh_token"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("user JSON exposes %q", key)
+		}
+	}
+	if strings.Contains(string(dat), "secrethash") {
+		t.Errorf("user JSON contains the password hash: %s", dat)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		name string
+		term string
+		want string
+	}{
+		{
+			name: "Plain term",
+			term: "chirpy",
+			want: "chirpy",
+		},
+		{
+			name: "Percent",
+			term: "100%",
+			want: `100\%`,
+		},
+		{
+			name: "Underscore",
+			term: "snake_case",
+			want: `snake\_case`,
+		},
+		{
+			name: "Backslash",
+			term: `C:\temp`,
+			want: `C:\\temp`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeLike(tt.term); got != tt.want {
+				t.Errorf("escapeLike() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChirpsSearch(t *testing.T) {
+	a, _ := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+	postChirp(t, a, alice.Token, `{"body":"Hello from Alice"}`)
+	postChirp(t, a, alice.Token, `{"body":"nothing to see"}`)
+	postChirp(t, a, bob.Token, `{"body":"hello from Bob"}`)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "Match",
+			query: "?search=HELLO",
+			want:  []string{"Hello from Alice", "hello from Bob"},
+		},
+		{
+			name:  "No match",
+			query: "?search=goodbye",
+			want:  []string{},
+		},
+		{
+			name:  "With author_id",
+			query: "?search=hello&author_id=" + bob.Id.String(),
+			want:  []string{"hello from Bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+tt.query, "", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var chirps []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &chirps)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			got := []string{}
+			for _, c := range chirps {
+				got = append(got, c.Body)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getChirps(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "Unset",
+			value: "",
+			want:  []string{"*"},
+		},
+		{
+			name:  "Single value",
+			value: "https://example.com",
+			want:  []string{"https://example.com"},
+		},
+		{
+			name:  "Multiple values with spaces",
+			value: "https://a.example, https://b.example ,",
+			want:  []string{"https://a.example", "https://b.example"},
+		},
+		{
+			name:  "Only separators",
+			value: " , ,",
+			want:  []string{"*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_LIST", tt.value)
+			if got := listEnv("TEST_LIST", []string{"*"}); !slices.Equal(got, tt.want) {
+				t.Errorf("listEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetReadyzClosedDB(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/chirpy?sslmode=disable")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	db.Close()
+
+	a := &apiConfig{db: db}
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(http.MethodGet, "/api/readyz", nil)
+
+	a.getReadyz(rec, rq)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("getReadyz() status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("getReadyz() Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestResponseTimestampsAreUTC(t *testing.T) {
+	offset := time.FixedZone("UTC+5", 5*60*60)
+	ts := time.Date(2025, 1, 1, 17, 0, 0, 0, offset)
+
+	tests := []struct {
+		name    string
+		payload any
+	}{
+		{
+			name: "Chirp",
+			payload: chirpFromRow(database.Chirp{
+				ID:        uuid.New(),
+				CreatedAt: ts,
+				UpdatedAt: ts,
+			}),
+		},
+		{
+			name: "User",
+			payload: userFromRow(database.User{
+				ID:        uuid.New(),
+				CreatedAt: ts,
+				UpdatedAt: ts,
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dat, err := json.Marshal(tt.payload)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+
+			fields := map[string]any{}
+			err = json.Unmarshal(dat, &fields)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			for _, key := range []string{"created_at", "updated_at"} {
+				if got := fields[key]; got != "2025-01-01T12:00:00Z" {
+					t.Errorf("%s = %v, want 2025-01-01T12:00:00Z", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPostPolkaWebhooksAuth(t *testing.T) {
+	const key = "f271c81ff7084ee5b99a5091b42d486e"
+	const signingSecret = "polka-signing-secret"
+	body := `{"event":"user.created","data":{"user_id":"` + uuid.NewString() + `"}}`
+
+	tests := []struct {
+		name          string
+		header        string
+		signingSecret string
+		signature     string
+		wantStatus    int
+	}{
+		{
+			name:       "Valid key",
+			header:     "ApiKey " + key,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Wrong key",
+			header:     "ApiKey " + strings.Repeat("0", len(key)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing key",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Valid signature",
+			header:        "ApiKey " + key,
+			signingSecret: signingSecret,
+			signature:     auth.SignHMAC([]byte(body), signingSecret),
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:          "Bad signature",
+			header:        "ApiKey " + key,
+			signingSecret: signingSecret,
+			signature:     auth.SignHMAC([]byte(body), "wrong-secret"),
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Missing signature",
+			header:        "ApiKey " + key,
+			signingSecret: signingSecret,
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &apiConfig{polkaKey: key, polkaSigningSecret: tt.signingSecret}
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(
+				http.MethodPost,
+				"/api/polka/webhooks",
+				strings.NewReader(body),
+			)
+			if tt.header != "" {
+				rq.Header.Set("Authorization", tt.header)
+			}
+			if tt.signature != "" {
+				rq.Header.Set("X-Polka-Signature", tt.signature)
+			}
+
+			a.postPolkaWebhooks(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("postPolkaWebhooks() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPostPolkaWebhooksIdempotent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	const key = "f271c81ff7084ee5b99a5091b42d486e"
+	a := &apiConfig{db: db, qry: database.New(db), polkaKey: key}
+	userID := uuid.New()
+	body := `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`
+	now := time.Now()
+
+	// The first delivery records the event, upgrades the user and audits it.
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO processed_webhooks").
+		WithArgs("evt_1", "user.upgraded").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE users").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(userID, now, now, "user@example.com", "hash", true, false, 0, nil))
+	mock.ExpectQuery("INSERT INTO audit_log").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "created_at", "actor_id", "action", "target"},
+		).AddRow(uuid.New(), now, nil, auditUserUpgrade, userID.String()))
+	mock.ExpectCommit()
+
+	// The retry finds the event already recorded and changes nothing.
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO processed_webhooks").
+		WithArgs("evt_1", "user.upgraded").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	for i := range 2 {
+		rec := httptest.NewRecorder()
+		rq := httptest.NewRequest(
+			http.MethodPost,
+			"/api/polka/webhooks",
+			strings.NewReader(body),
+		)
+		rq.Header.Set("Authorization", "ApiKey "+key)
+
+		a.postPolkaWebhooks(rec, rq)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("delivery %d: postPolkaWebhooks() status = %d, want %d", i+1, rec.Code, http.StatusNoContent)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostPolkaWebhooksUnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	const key = "f271c81ff7084ee5b99a5091b42d486e"
+	a := &apiConfig{db: db, qry: database.New(db), polkaKey: key}
+	userID := uuid.New()
+	body := `{"event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE users").
+		WithArgs(userID).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(
+		http.MethodPost,
+		"/api/polka/webhooks",
+		strings.NewReader(body),
+	)
+	rq.Header.Set("Authorization", "ApiKey "+key)
+
+	a.postPolkaWebhooks(rec, rq)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("postPolkaWebhooks() status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	const secret = "secret"
+	a := &apiConfig{db: db, qry: database.New(db), secret: secret}
+	userID := uuid.New()
+	now := time.Now()
+
+	// The first delete removes the account and audits it.
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE\\s+FROM users").
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO audit_log").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "created_at", "actor_id", "action", "target"},
+		).AddRow(uuid.New(), now, userID, auditUserDelete, userID.String()))
+	mock.ExpectCommit()
+
+	// A second delete with the same token finds nothing to remove.
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE\\s+FROM users").
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		rq := newAuthedRequest(t, http.MethodDelete, "/api/users", userID, secret)
+
+		a.middlewareAuth(a.deleteUsers)(rec, rq)
+
+		if rec.Code != want {
+			t.Errorf("delete %d: deleteUsers() status = %d, want %d", i+1, rec.Code, want)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// Account deletion relies on the database to remove everything a user owns,
+// so every reference to users(id) must cascade or be cleared.
+func TestUserReferencesCascade(t *testing.T) {
+	files, err := filepath.Glob("sql/schema/*.sql")
+	if err != nil {
+		t.Fatalf("filepath.Glob() error = %v", err)
+	}
+
+	ref := regexp.MustCompile(`REFERENCES users\(id\)[^,\n]*`)
+	for _, f := range files {
+		dat, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q) error = %v", f, err)
+		}
+
+		for _, m := range ref.FindAllString(string(dat), -1) {
+			if !strings.Contains(m, "ON DELETE CASCADE") &&
+				!strings.Contains(m, "ON DELETE SET NULL") {
+				t.Errorf("%s: %q does not cascade on delete", f, m)
+			}
+		}
+	}
+}
+
+func TestPostLoginRollsBackOnFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	hash, err := auth.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	a := &apiConfig{
+		db:        db,
+		qry:       database.New(db),
+		secret:    "secret",
+		jwtExpiry: time.Hour,
+	}
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM users").
+		WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(userID, now, now, "user@example.com", hash, false, false, 0, nil))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(
+		http.MethodPost,
+		"/api/login",
+		strings.NewReader(`{"email":"user@example.com","password":"correct horse battery"}`),
+	)
+	a.postLogin(rec, rq)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("postLogin() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostLoginUnknownEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	a := &apiConfig{db: db, qry: database.New(db), secret: "secret"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM users").
+		WithArgs("nobody@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(
+		http.MethodPost,
+		"/api/login",
+		strings.NewReader(`{"email":"nobody@example.com","password":"whatever"}`),
+	)
+	a.postLogin(rec, rq)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("postLogin() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Body.String(); got != "Incorrect email or password" {
+		t.Errorf("postLogin() body = %q, want %q", got, "Incorrect email or password")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestBeginTxUnsupportedQuerier(t *testing.T) {
+	// Embedding the fake as a Querier hides its BeginTx, leaving a Querier
+	// that can't start transactions.
+	a := &apiConfig{qry: struct{ Querier }{newFakeQuerier()}}
+
+	_, _, err := a.beginTx(context.Background())
+	if err == nil {
+		t.Errorf("beginTx() error = nil, want an error")
+	}
+}
+
+func newFakeConfig() (*apiConfig, *fakeQuerier) {
+	f := newFakeQuerier()
+	return &apiConfig{
+		qry:               f,
+		secret:            "secret",
+		jwtExpiry:         time.Hour,
+		minPasswordLength: auth.DefaultMinPasswordLength,
+		bcryptCost:        bcrypt.MinCost,
+	}, f
+}
+
+func doJSON(
+	t *testing.T,
+	h http.HandlerFunc,
+	method string,
+	target string,
+	bearer string,
+	body string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(method, target, strings.NewReader(body))
+	if bearer != "" {
+		rq.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	h(rec, rq)
+	return rec
+}
+
+func signUpAndLogIn(t *testing.T, a *apiConfig, email string) user {
+	t.Helper()
+
+	creds := `{"email":"` + email + `","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postUsers, http.MethodPost, "/api/users", "", creds)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postUsers() status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	rec = doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	u := user{}
+	err := json.Unmarshal(rec.Body.Bytes(), &u)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return u
+}
+
+// tokenExpiry returns the exp claim of an access token without verifying it.
+func tokenExpiry(t *testing.T, token string) time.Time {
+	t.Helper()
+
+	claims := jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, &claims)
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	return claims.ExpiresAt.Time
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	a, f := newFakeConfig()
+	a.lockoutThreshold = 3
+	a.lockoutDuration = time.Minute
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	good := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	bad := `{"email":"user@example.com","password":"wrong-password-1"}`
+	login := func(creds string, wantStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+		if rec.Code != wantStatus {
+			t.Fatalf("postLogin() status = %d, want %d", rec.Code, wantStatus)
+		}
+		return rec
+	}
+
+	// Failures below the threshold are forgotten after a success.
+	login(bad, http.StatusUnauthorized)
+	login(bad, http.StatusUnauthorized)
+	if got := f.state.users[u.Id].FailedLoginCount; got != 2 {
+		t.Errorf("failed_login_count = %d, want 2", got)
+	}
+	login(good, http.StatusOK)
+	if got := f.state.users[u.Id].FailedLoginCount; got != 0 {
+		t.Errorf("failed_login_count after success = %d, want 0", got)
+	}
+
+	for range a.lockoutThreshold {
+		login(bad, http.StatusUnauthorized)
+	}
+
+	rec := login(good, http.StatusLocked)
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("postLogin() Retry-After = %q, want %q", got, "60")
+	}
+	login(bad, http.StatusLocked)
+
+	now = now.Add(a.lockoutDuration + time.Second)
+	login(good, http.StatusOK)
+	if row := f.state.users[u.Id]; row.LockedUntil.Valid || row.FailedLoginCount != 0 {
+		t.Errorf("lockout not cleared after success: %+v", row)
+	}
+}
+
+func TestSignUpUsesBcryptCost(t *testing.T) {
+	a, f := newFakeConfig()
+	a.bcryptCost = bcrypt.MinCost + 1
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	cost, err := bcrypt.Cost([]byte(f.state.users[u.Id].HashedPassword))
+	if err != nil {
+		t.Fatalf("bcrypt.Cost() error = %v", err)
+	}
+	if cost != a.bcryptCost {
+		t.Errorf("stored password cost = %d, want %d", cost, a.bcryptCost)
+	}
+}
+
+func TestLoginRehashesLowCostPassword(t *testing.T) {
+	a, f := newFakeConfig()
+	a.bcryptCost = auth.DefaultCost
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	lowCost, err := bcrypt.GenerateFromPassword(
+		[]byte("correct-horse-battery-1"),
+		bcrypt.MinCost,
+	)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	row := f.state.users[u.Id]
+	row.HashedPassword = string(lowCost)
+	f.state.users[u.Id] = row
+
+	creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	hash := f.state.users[u.Id].HashedPassword
+	if hash == string(lowCost) {
+		t.Fatalf("postLogin() kept the low-cost hash")
+	}
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != auth.DefaultCost {
+		t.Errorf("rehashed password cost = %d, want %d", cost, auth.DefaultCost)
+	}
+	if auth.CheckPasswordHash("correct-horse-battery-1", hash) != nil {
+		t.Errorf("rehashed password no longer matches")
+	}
+}
+
+func TestLoginUnknownEmailMatchesWrongPassword(t *testing.T) {
+	a, _ := newFakeConfig()
+	signUpAndLogIn(t, a, "user@example.com")
+
+	if cost, err := bcrypt.Cost([]byte(dummyPasswordHash)); err != nil {
+		t.Fatalf("dummyPasswordHash is not a bcrypt hash: %v", err)
+	} else if cost != auth.DefaultCost {
+		t.Errorf("dummyPasswordHash cost = %d, want %d", cost, auth.DefaultCost)
+	}
+
+	tests := []struct {
+		name  string
+		creds string
+	}{
+		{
+			name:  "Wrong password",
+			creds: `{"email":"user@example.com","password":"wrong-password-1"}`,
+		},
+		{
+			name:  "Unknown email",
+			creds: `{"email":"nobody@example.com","password":"wrong-password-1"}`,
+		},
+	}
+
+	var bodies []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", tt.creds)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("postLogin() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			bodies = append(bodies, rec.Body.String())
+		})
+	}
+	if len(bodies) == 2 && bodies[0] != bodies[1] {
+		t.Errorf("postLogin() bodies differ: %q vs %q", bodies[0], bodies[1])
+	}
+}
+
+func TestCreatedLocation(t *testing.T) {
+	a, _ := newFakeConfig()
+
+	rec := doJSON(
+		t,
+		a.postUsers,
+		http.MethodPost,
+		"/api/users",
+		"",
+		`{"email":"user@example.com","password":"correct-horse-battery-1"}`,
+	)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postUsers() status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	u := user{}
+	err := json.Unmarshal(rec.Body.Bytes(), &u)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got, want := rec.Header().Get("Location"), "/api/users/"+u.Id.String(); got != want {
+		t.Errorf("postUsers() Location = %q, want %q", got, want)
+	}
+
+	creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	rec = doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+	err = json.Unmarshal(rec.Body.Bytes(), &u)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.postChirps), http.MethodPost, "/api/chirps", u.Token, `{"body":"hello"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postChirps() status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	c := chirp{}
+	err = json.Unmarshal(rec.Body.Bytes(), &c)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	id, ok := strings.CutPrefix(rec.Header().Get("Location"), "/api/chirps/")
+	if !ok {
+		t.Fatalf("postChirps() Location = %q, want /api/chirps/{id}", rec.Header().Get("Location"))
+	}
+	if parsed, err := uuid.Parse(id); err != nil || parsed != c.Id {
+		t.Errorf("postChirps() Location id = %q, want %v", id, c.Id)
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	expired, _ := auth.MakeJWT(u.Id, a.secret, auth.DefaultAudience, -time.Minute)
+	deleted, _ := auth.MakeJWT(uuid.New(), a.secret, auth.DefaultAudience, time.Hour)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "Valid token",
+			token:      u.Token,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Expired token",
+			token:      expired,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing token",
+			token:      "",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Unknown user",
+			token:      deleted,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.middlewareAuth(a.getMe), http.MethodGet, "/api/me", tt.token, "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getMe() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			got := user{}
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if got.Id != u.Id || got.Email != u.Email {
+				t.Errorf("getMe() = %v %q, want %v %q", got.Id, got.Email, u.Id, u.Email)
+			}
+			if got.Token != "" || got.RefreshToken != "" {
+				t.Errorf("getMe() returned tokens")
+			}
+		})
+	}
+}
+
+func TestLoginContentTypes(t *testing.T) {
+	a, _ := newFakeConfig()
+	want := signUpAndLogIn(t, a, "user@example.com")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:        "JSON",
+			contentType: "application/json",
+			body:        `{"email":"user@example.com","password":"correct-horse-battery-1"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "JSON with charset",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"email":"user@example.com","password":"correct-horse-battery-1"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "Form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "email=user%40example.com&password=correct-horse-battery-1",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "Form with wrong password",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "email=user%40example.com&password=wrong",
+			wantStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:        "Unsupported type",
+			contentType: "text/plain",
+			body:        "user@example.com correct-horse-battery-1",
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(tt.body))
+			rq.Header.Set("Content-Type", tt.contentType)
+			a.postLogin(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("postLogin() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			got := user{}
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if got.Id != want.Id || got.Email != want.Email {
+				t.Errorf("postLogin() user = %v %q, want %v %q", got.Id, got.Email, want.Id, want.Email)
+			}
+			if got.Token == "" || got.RefreshToken == "" {
+				t.Errorf("postLogin() did not issue tokens")
+			}
+		})
+	}
+}
+
+func TestSignUpWithLogin(t *testing.T) {
+	a, _ := newFakeConfig()
+
+	creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postUsers, http.MethodPost, "/api/users?login=true", "", creds)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postUsers() status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	u := user{}
+	err := json.Unmarshal(rec.Body.Bytes(), &u)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if u.Token == "" || u.RefreshToken == "" || u.ExpiresAt == nil {
+		t.Fatalf("postUsers() with login=true did not issue tokens: %s", rec.Body.String())
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.getMe), http.MethodGet, "/api/me", u.Token, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("getMe() with signup token status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("postRefresh() with signup refresh token status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	creds = `{"email":"other@example.com","password":"correct-horse-battery-1"}`
+	rec = doJSON(t, a.postUsers, http.MethodPost, "/api/users", "", creds)
+	if strings.Contains(rec.Body.String(), "token") {
+		t.Errorf("postUsers() without login=true issued tokens: %s", rec.Body.String())
+	}
+}
+
+func TestDeleteChirps(t *testing.T) {
+	a, f := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+
+	_, parent := postChirp(t, a, alice.Token, `{"body":"one"}`)
+	postChirp(t, a, alice.Token, `{"body":"two"}`)
+	_, kept := postChirp(t, a, bob.Token, `{"body":"three"}`)
+	_, reply := postChirp(t, a, bob.Token, `{"body":"reply","parent_id":"`+parent.Id.String()+`"}`)
+
+	rec := doJSON(t, a.middlewareAuth(a.deleteChirps), http.MethodDelete, "/api/chirps", alice.Token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirps() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("X-Deleted-Count"); got != "2" {
+		t.Errorf("deleteChirps() X-Deleted-Count = %q, want %q", got, "2")
+	}
+
+	for id, c := range f.state.chirps {
+		if got, want := c.DeletedAt.Valid, c.UserID == alice.Id; got != want {
+			t.Errorf("chirp %v deleted = %v, want %v", id, got, want)
+		}
+	}
+	if _, ok := f.state.chirps[kept.Id]; !ok {
+		t.Errorf("deleteChirps() removed another user's chirp")
+	}
+	if got := f.state.chirps[reply.Id].ParentID; got.UUID != parent.Id {
+		t.Errorf("reply parent_id = %v after deleteChirps(), want %v", got, parent.Id)
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.deleteChirps), http.MethodDelete, "/api/chirps", alice.Token, "")
+	if got := rec.Header().Get("X-Deleted-Count"); got != "0" {
+		t.Errorf("second deleteChirps() X-Deleted-Count = %q, want %q", got, "0")
+	}
+}
+
+func TestTokenExpiresAt(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	if u.ExpiresAt == nil {
+		t.Fatalf("postLogin() expires_at is missing")
+	}
+	if want := tokenExpiry(t, u.Token); !u.ExpiresAt.Equal(want) {
+		t.Errorf("postLogin() expires_at = %v, want %v", *u.ExpiresAt, want)
+	}
+
+	rec := doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postRefresh() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	raw := struct {
+		Token     string `json:"token"`
+		ExpiresAt string `json:"expires_at"`
+	}{}
+	err := json.Unmarshal(rec.Body.Bytes(), &raw)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	got, err := time.Parse(time.RFC3339, raw.ExpiresAt)
+	if err != nil {
+		t.Fatalf("postRefresh() expires_at = %q is not RFC3339", raw.ExpiresAt)
+	}
+	if want := tokenExpiry(t, raw.Token); !got.Equal(want) {
+		t.Errorf("postRefresh() expires_at = %v, want %v", got, want)
+	}
+}
+
+func TestSignUpAndLogIn(t *testing.T) {
+	a, f := newFakeConfig()
+
+	u := signUpAndLogIn(t, a, "User@Example.com")
+
+	if u.Email != "user@example.com" {
+		t.Errorf("email = %q, want %q", u.Email, "user@example.com")
+	}
+	if u.Token == "" || u.RefreshToken == "" {
+		t.Errorf("login returned token %q and refresh token %q, want both", u.Token, u.RefreshToken)
+	}
+	if _, ok := f.state.refreshTokens[u.RefreshToken]; !ok {
+		t.Errorf("refresh token %q was not stored", u.RefreshToken)
+	}
+}
+
+// Rows created before signup normalized emails can still be mixed-case.
+func TestLoginMatchesStoredEmailCaseInsensitively(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	row := f.state.users[u.Id]
+	row.Email = "User@Example.com"
+	f.state.users[u.Id] = row
+
+	creds := `{"email":"USER@example.COM","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		t.Errorf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestPostUsersDuplicateEmail(t *testing.T) {
+	a, _ := newFakeConfig()
+	signUpAndLogIn(t, a, "user@example.com")
+
+	rec := doJSON(
+		t,
+		a.postUsers,
+		http.MethodPost,
+		"/api/users",
+		"",
+		`{"email":"USER@example.com","password":"another-good-password-2"}`,
+	)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("postUsers() status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestPostUsersBadInviteRollsBack(t *testing.T) {
+	a, f := newFakeConfig()
+	a.inviteOnly = true
+	m := &recordingMailer{sent: map[uuid.UUID]string{}}
+	a.mailer = m
+
+	rec := doJSON(
+		t,
+		a.postUsers,
+		http.MethodPost,
+		"/api/users",
+		"",
+		`{"email":"user@example.com","password":"correct-horse-battery-1","invite_code":"nope"}`,
+	)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("postUsers() status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if len(f.state.users) != 0 {
+		t.Errorf("users = %d, want 0 after rollback", len(f.state.users))
+	}
+	if len(f.state.verifications) != 0 || len(m.sent) != 0 {
+		t.Errorf("verification token issued for a rejected invite")
+	}
+}
+
+func TestPostUsersInviteCode(t *testing.T) {
+	a, f := newFakeConfig()
+	a.inviteOnly = true
+	a.platform = "dev"
+
+	rec := doJSON(t, a.postInvites, http.MethodPost, "/admin/invites", "", "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("postInvites() status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	invite := struct {
+		Code string `json:"code"`
+	}{}
+	err := json.Unmarshal(rec.Body.Bytes(), &invite)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	signUp := func(email string) int {
+		t.Helper()
+
+		body := `{"email":"` + email + `","password":"correct-horse-battery-1","invite_code":"` + invite.Code + `"}`
+		return doJSON(t, a.postUsers, http.MethodPost, "/api/users", "", body).Code
+	}
+
+	if code := signUp("user@example.com"); code != http.StatusCreated {
+		t.Fatalf("postUsers() with a valid invite status = %d, want %d", code, http.StatusCreated)
+	}
+	if !f.state.invites[invite.Code].UsedBy.Valid {
+		t.Errorf("invite was not marked as used")
+	}
+
+	if code := signUp("other@example.com"); code != http.StatusForbidden {
+		t.Errorf("postUsers() with a used invite status = %d, want %d", code, http.StatusForbidden)
+	}
+	if len(f.state.users) != 1 {
+		t.Errorf("users = %d, want 1", len(f.state.users))
+	}
+}
+
+func TestPostRefreshRotationAndReplay(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	rec := doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postRefresh() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rotated := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	err := json.Unmarshal(rec.Body.Bytes(), &rotated)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == u.RefreshToken {
+		t.Fatalf("postRefresh() refresh_token = %q, want a new token", rotated.RefreshToken)
+	}
+
+	// Replaying the consumed token is treated as theft and revokes the
+	// whole family, including the replacement.
+	rec = doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed postRefresh() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if !f.state.refreshTokens[rotated.RefreshToken].RevokedAt.Valid {
+		t.Errorf("replacement token was not revoked after replay")
+	}
+}
+
+func TestPutUsersPartialUpdate(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	oldHash := f.state.users[u.Id].HashedPassword
+
+	rec := doJSON(t, a.middlewareAuth(a.putUsers), http.MethodPut, "/api/users", u.Token, `{"email":"new@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putUsers() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	got := f.state.users[u.Id]
+	if got.Email != "new@example.com" {
+		t.Errorf("email = %q, want %q", got.Email, "new@example.com")
+	}
+	if got.HashedPassword != oldHash {
+		t.Errorf("email-only update changed the password hash")
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.putUsers), http.MethodPut, "/api/users", u.Token, `{"password":"a-brand-new-password-3"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putUsers() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	got = f.state.users[u.Id]
+	if got.Email != "new@example.com" {
+		t.Errorf("password-only update changed the email to %q", got.Email)
+	}
+	if auth.CheckPasswordHash("a-brand-new-password-3", got.HashedPassword) != nil {
+		t.Errorf("password was not updated")
+	}
+}
+
+func TestPostRefreshExpiredToken(t *testing.T) {
+	a, f := newFakeConfig()
+	a.refreshExpiry = time.Hour
+	// Log in two hours ago so the refresh token has already lapsed.
+	a.now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	u := signUpAndLogIn(t, a, "user@example.com")
+	a.now = nil
+
+	if got := f.state.refreshTokens[u.RefreshToken].ExpiresAt; got.After(time.Now()) {
+		t.Fatalf("expires_at = %v, want a time in the past", got)
+	}
+
+	rec := doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("postRefresh() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPostRevokeAll(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	second := user{}
+	err := json.Unmarshal(rec.Body.Bytes(), &second)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.postRevokeAll), http.MethodPost, "/api/revoke-all", u.Token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("postRevokeAll() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	for _, token := range []string{u.RefreshToken, second.RefreshToken} {
+		rec = doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", token, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("postRefresh() after revoke-all status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestPostRefreshKeepsExpiry(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	want := f.state.refreshTokens[u.RefreshToken].ExpiresAt
+
+	rec := doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postRefresh() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rotated := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	err := json.Unmarshal(rec.Body.Bytes(), &rotated)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got := f.state.refreshTokens[rotated.RefreshToken].ExpiresAt; !got.Equal(want) {
+		t.Errorf("rotated expires_at = %v, want %v", got, want)
+	}
+}
+
+func TestCleanStringCustomWords(t *testing.T) {
+	badWords := []string{"heck", "darn"}
+
+	got := cleanString("Heck, that darn kerfuffle!", badWords)
+	want := "****, that **** kerfuffle!"
+	if got != want {
+		t.Errorf("cleanString() = %q, want %q", got, want)
+	}
+}
+
+func TestBadWordsFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad_words.txt")
+	err := os.WriteFile(path, []byte("Gosh\n\nGolly\r\n"), 0o600)
+	if err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		list    string
+		file    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Unset",
+			want: defaultBadWords,
+		},
+		{
+			name: "Comma-separated list",
+			list: " Heck, darn ,,",
+			want: []string{"heck", "darn"},
+		},
+		{
+			name: "File overrides list",
+			list: "heck",
+			file: path,
+			want: []string{"gosh", "golly"},
+		},
+		{
+			name:    "Missing file",
+			file:    filepath.Join(t.TempDir(), "missing.txt"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BAD_WORDS", tt.list)
+			t.Setenv("BAD_WORDS_FILE", tt.file)
+
+			got, err := badWordsFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("badWordsFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("badWordsFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func postChirp(t *testing.T, a *apiConfig, token string, body string) (int, chirp) {
+	t.Helper()
+
+	rec := doJSON(t, a.middlewareAuth(a.postChirps), http.MethodPost, "/api/chirps", token, body)
+	c := chirp{}
+	if rec.Code == http.StatusCreated {
+		err := json.Unmarshal(rec.Body.Bytes(), &c)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+	}
+	return rec.Code, c
+}
+
+func TestChirpReplies(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	_, parent := postChirp(t, a, u.Token, `{"body":"parent"}`)
+	_, other := postChirp(t, a, u.Token, `{"body":"unrelated"}`)
+
+	var replies []chirp
+	for _, body := range []string{"first reply", "second reply"} {
+		code, reply := postChirp(
+			t,
+			a,
+			u.Token,
+			`{"body":"`+body+`","parent_id":"`+parent.Id.String()+`"}`,
+		)
+		if code != http.StatusCreated {
+			t.Fatalf("postChirps() reply status = %d, want %d", code, http.StatusCreated)
+		}
+		if reply.ParentId == nil || *reply.ParentId != parent.Id {
+			t.Fatalf("reply parent_id = %v, want %v", reply.ParentId, parent.Id)
+		}
+		replies = append(replies, reply)
+	}
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(
+		http.MethodGet,
+		"/api/chirps/"+parent.Id.String()+"/replies",
+		nil,
+	)
+	rq.SetPathValue("chirpID", parent.Id.String())
+	a.getChirpsChirpIDReplies(rec, rq)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getChirpsChirpIDReplies() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	got := []chirp{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	ids := func(cs []chirp) []uuid.UUID {
+		out := make([]uuid.UUID, len(cs))
+		for i, c := range cs {
+			out[i] = c.Id
+		}
+		return out
+	}
+	if !slices.Equal(ids(got), ids(replies)) {
+		t.Errorf("replies = %v, want %v", ids(got), ids(replies))
+	}
+	if slices.Contains(ids(got), other.Id) {
+		t.Errorf("replies include unrelated chirp %v", other.Id)
+	}
+}
+
+func TestPostChirpsReplyToMissingParent(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	code, _ := postChirp(
+		t,
+		a,
+		u.Token,
+		`{"body":"hello?","parent_id":"`+uuid.NewString()+`"}`,
+	)
+
+	if code != http.StatusNotFound {
+		t.Errorf("postChirps() status = %d, want %d", code, http.StatusNotFound)
+	}
+	if len(f.state.chirps) != 0 {
+		t.Errorf("chirps = %d, want 0", len(f.state.chirps))
+	}
+}
+
+func TestHandlersRejectMalformedJSON(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.polkaKey = "f271c81ff7084ee5b99a5091b42d486e"
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		auth    string
+	}{
+		{
+			name:    "postChirps",
+			handler: a.middlewareAuth(a.postChirps),
+			method:  http.MethodPost,
+			target:  "/api/chirps",
+			auth:    "Bearer " + u.Token,
+		},
+		{
+			name:    "postUsers",
+			handler: a.postUsers,
+			method:  http.MethodPost,
+			target:  "/api/users",
+			auth:    "",
+		},
+		{
+			name:    "postLogin",
+			handler: a.postLogin,
+			method:  http.MethodPost,
+			target:  "/api/login",
+			auth:    "",
+		},
+		{
+			name:    "putUsers",
+			handler: a.middlewareAuth(a.putUsers),
+			method:  http.MethodPut,
+			target:  "/api/users",
+			auth:    "Bearer " + u.Token,
+		},
+		{
+			name:    "postPolkaWebhooks",
+			handler: a.postPolkaWebhooks,
+			method:  http.MethodPost,
+			target:  "/api/polka/webhooks",
+			auth:    "ApiKey " + a.polkaKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"email":`))
+			if tt.auth != "" {
+				rq.Header.Set("Authorization", tt.auth)
+			}
+
+			tt.handler(rec, rq)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s() status = %d, want %d", tt.name, rec.Code, http.StatusBadRequest)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("%s() Content-Type = %q, want application/json", tt.name, ct)
+			}
+		})
+	}
+}
+
+func TestHandlersRejectUnknownFields(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		token   string
+		body    string
+	}{
+		{
+			name:    "postChirps",
+			handler: a.middlewareAuth(a.postChirps),
+			method:  http.MethodPost,
+			target:  "/api/chirps",
+			token:   u.Token,
+			body:    `{"body":"hello","bdoy":"typo"}`,
+		},
+		{
+			name:    "postUsers",
+			handler: a.postUsers,
+			method:  http.MethodPost,
+			target:  "/api/users",
+			body:    `{"emial":"other@example.com","password":"correct-horse-battery-1"}`,
+		},
+		{
+			name:    "postLogin",
+			handler: a.postLogin,
+			method:  http.MethodPost,
+			target:  "/api/login",
+			body:    `{"email":"user@example.com","password":"correct-horse-battery-1","remember":true}`,
+		},
+		{
+			name:    "putUsers",
+			handler: a.middlewareAuth(a.putUsers),
+			method:  http.MethodPut,
+			target:  "/api/users",
+			token:   u.Token,
+			body:    `{"emial":"new@example.com"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, tt.handler, tt.method, tt.target, tt.token, tt.body)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("%s() status = %d, want %d", tt.name, rec.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(rec.Body.String(), "unknown field") {
+				t.Errorf("%s() body = %q, want it to name the unknown field", tt.name, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetChirpsCount(t *testing.T) {
+	a, _ := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+
+	postChirp(t, a, alice.Token, `{"body":"one"}`)
+	postChirp(t, a, alice.Token, `{"body":"two"}`)
+	postChirp(t, a, bob.Token, `{"body":"three"}`)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCount  int64
+	}{
+		{
+			name:       "All chirps",
+			query:      "",
+			wantStatus: http.StatusOK,
+			wantCount:  3,
+		},
+		{
+			name:       "By author",
+			query:      "?author_id=" + alice.Id.String(),
+			wantStatus: http.StatusOK,
+			wantCount:  2,
+		},
+		{
+			name:       "Author without chirps",
+			query:      "?author_id=" + uuid.NewString(),
+			wantStatus: http.StatusOK,
+			wantCount:  0,
+		},
+		{
+			name:       "Invalid author",
+			query:      "?author_id=nope",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirpsCount, http.MethodGet, "/api/chirps/count"+tt.query, "", "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getChirpsCount() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			got := struct {
+				Count int64 `json:"count"`
+			}{}
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if got.Count != tt.wantCount {
+				t.Errorf("getChirpsCount() count = %d, want %d", got.Count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestGetChirpsSortBy(t *testing.T) {
+	a, fake := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	_, first := postChirp(t, a, u.Token, `{"body":"first"}`)
+	postChirp(t, a, u.Token, `{"body":"second"}`)
+	postChirp(t, a, u.Token, `{"body":"third"}`)
+
+	_, err := fake.UpdateChirp(
+		context.Background(),
+		database.UpdateChirpParams{ID: first.Id, Body: "first, edited"},
+	)
+	if err != nil {
+		t.Fatalf("UpdateChirp() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "Default",
+			query:      "",
+			wantStatus: http.StatusOK,
+			want:       []string{"first, edited", "second", "third"},
+		},
+		{
+			name:       "created_at descending",
+			query:      "?sort_by=created_at&sort=desc",
+			wantStatus: http.StatusOK,
+			want:       []string{"third", "second", "first, edited"},
+		},
+		{
+			name:       "updated_at ascending",
+			query:      "?sort_by=updated_at",
+			wantStatus: http.StatusOK,
+			want:       []string{"second", "third", "first, edited"},
+		},
+		{
+			name:       "updated_at descending",
+			query:      "?sort_by=updated_at&sort=desc",
+			wantStatus: http.StatusOK,
+			want:       []string{"first, edited", "third", "second"},
+		},
+		{
+			name:       "Unknown column",
+			query:      "?sort_by=body",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Injection attempt",
+			query:      "?sort_by=created_at%3B%20DROP%20TABLE%20chirps",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+tt.query, "", "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			bodies := []string{}
+			for _, c := range got {
+				bodies = append(bodies, c.Body)
+			}
+			if !slices.Equal(bodies, tt.want) {
+				t.Errorf("getChirps() order = %q, want %q", bodies, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChirpsIDs(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, first := postChirp(t, a, u.Token, `{"body":"first"}`)
+	postChirp(t, a, u.Token, `{"body":"second"}`)
+	_, third := postChirp(t, a, u.Token, `{"body":"third"}`)
+
+	tests := []struct {
+		name       string
+		ids        string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "Mixed existence",
+			ids:        third.Id.String() + "," + uuid.NewString() + "," + first.Id.String(),
+			wantStatus: http.StatusOK,
+			want:       []string{"third", "first"},
+		},
+		{
+			name:       "None exist",
+			ids:        uuid.NewString(),
+			wantStatus: http.StatusOK,
+			want:       []string{},
+		},
+		{
+			name:       "Invalid UUID",
+			ids:        first.Id.String() + ",not-a-uuid",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty",
+			ids:        "",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps?ids="+tt.ids, "", "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			bodies := []string{}
+			for _, c := range got {
+				bodies = append(bodies, c.Body)
+			}
+			if !slices.Equal(bodies, tt.want) {
+				t.Errorf("getChirps() = %q, want %q", bodies, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChirpsAuthorID(t *testing.T) {
+	a, _ := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+	postChirp(t, a, alice.Token, `{"body":"from alice"}`)
+	postChirp(t, a, bob.Token, `{"body":"from bob"}`)
+	carol := signUpAndLogIn(t, a, "carol@example.com")
+
+	tests := []struct {
+		name       string
+		authorID   string
+		wantStatus int
+		want       []string
+		wantError  string
+	}{
+		{
+			name:       "Valid author",
+			authorID:   bob.Id.String(),
+			wantStatus: http.StatusOK,
+			want:       []string{"from bob"},
+		},
+		{
+			name:       "Author without chirps",
+			authorID:   carol.Id.String(),
+			wantStatus: http.StatusOK,
+			want:       []string{},
+		},
+		{
+			name:       "Malformed UUID",
+			authorID:   "not-a-uuid",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid author_id",
+		},
+		{
+			name:       "Unknown author",
+			authorID:   uuid.NewString(),
+			wantStatus: http.StatusNotFound,
+			wantError:  "author not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(
+				t,
+				a.getChirps,
+				http.MethodGet,
+				"/api/chirps?author_id="+tt.authorID,
+				"",
+				"",
+			)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				var got struct {
+					Error string `json:"error"`
+				}
+				err := json.Unmarshal(rec.Body.Bytes(), &got)
+				if err != nil {
+					t.Fatalf("json.Unmarshal() error = %v", err)
+				}
+				if got.Error != tt.wantError {
+					t.Errorf("getChirps() error = %q, want %q", got.Error, tt.wantError)
+				}
+				return
+			}
+
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			bodies := []string{}
+			for _, c := range got {
+				bodies = append(bodies, c.Body)
+			}
+			if !slices.Equal(bodies, tt.want) {
+				t.Errorf("getChirps() = %q, want %q", bodies, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandAuthor(t *testing.T) {
+	a, f := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+	_, aliceChirp := postChirp(t, a, alice.Token, `{"body":"from alice"}`)
+	postChirp(t, a, bob.Token, `{"body":"from bob"}`)
+
+	row := f.state.users[bob.Id]
+	row.IsChirpyRed = true
+	f.state.users[bob.Id] = row
+	want := map[uuid.UUID]chirpAuthor{
+		alice.Id: {Id: alice.Id, Email: "alice@example.com"},
+		bob.Id:   {Id: bob.Id, Email: "bob@example.com", IsChirpyRed: true},
+	}
+
+	t.Run("List", func(t *testing.T) {
+		rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps", "", "")
+		if strings.Contains(rec.Body.String(), `"author"`) {
+			t.Errorf("getChirps() without expand embedded an author: %s", rec.Body.String())
+		}
+
+		rec = doJSON(t, a.getChirps, http.MethodGet, "/api/chirps?expand=author", "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("getChirps() status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var got []chirp
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("getChirps() returned %d chirps, want 2", len(got))
+		}
+		for _, c := range got {
+			if c.Author == nil || *c.Author != want[c.UserId] {
+				t.Errorf("chirp %q author = %+v, want %+v", c.Body, c.Author, want[c.UserId])
+			}
+		}
+	})
+
+	t.Run("Single", func(t *testing.T) {
+		rec := getChirpByID(t, a, aliceChirp.Id)
+		if strings.Contains(rec.Body.String(), `"author"`) {
+			t.Errorf("getChirpsChirpID() without expand embedded an author: %s", rec.Body.String())
+		}
+
+		rq := httptest.NewRequest(
+			http.MethodGet,
+			"/api/chirps/"+aliceChirp.Id.String()+"?expand=author",
+			nil,
+		)
+		rq.SetPathValue("chirpID", aliceChirp.Id.String())
+		rec = httptest.NewRecorder()
+		a.getChirpsChirpID(rec, rq)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		got := chirp{}
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if got.Author == nil || *got.Author != want[alice.Id] {
+			t.Errorf("getChirpsChirpID() author = %+v, want %+v", got.Author, want[alice.Id])
+		}
+	})
+}
+
+func TestGetChirpsLimitOffset(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	for _, body := range []string{"one", "two", "three", "four"} {
+		postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "Window",
+			query: "?limit=2&offset=1",
+			want:  []string{"two", "three"},
+		},
+		{
+			name:  "Window descending",
+			query: "?sort=desc&limit=2&offset=1",
+			want:  []string{"three", "two"},
+		},
+		{
+			name:  "Limit past the end",
+			query: "?limit=10&offset=3",
+			want:  []string{"four"},
+		},
+		{
+			name:  "Offset out of range",
+			query: "?offset=10",
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+tt.query, "", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var chirps []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &chirps)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			got := []string{}
+			for _, c := range chirps {
+				got = append(got, c.Body)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getChirps(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChirpsTotalCount(t *testing.T) {
+	a, _ := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+
+	postChirp(t, a, alice.Token, `{"body":"hello from alice"}`)
+	postChirp(t, a, alice.Token, `{"body":"goodbye from alice"}`)
+	postChirp(t, a, alice.Token, `{"body":"hello again"}`)
+	postChirp(t, a, bob.Token, `{"body":"hello from bob"}`)
+	postChirp(t, a, bob.Token, `{"body":"bob again"}`)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCount string
+		wantRows  int
+	}{
+		{
+			name:      "All chirps",
+			query:     "?limit=2",
+			wantCount: "5",
+			wantRows:  2,
+		},
+		{
+			name:      "All chirps past the end",
+			query:     "?limit=2&offset=4",
+			wantCount: "5",
+			wantRows:  1,
+		},
+		{
+			name:      "By author",
+			query:     "?author_id=" + alice.Id.String() + "&limit=1&offset=1",
+			wantCount: "3",
+			wantRows:  1,
+		},
+		{
+			name:      "Search",
+			query:     "?search=hello&limit=1",
+			wantCount: "3",
+			wantRows:  1,
+		},
+		{
+			name:      "Search by author",
+			query:     "?search=hello&author_id=" + bob.Id.String() + "&offset=5",
+			wantCount: "1",
+			wantRows:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+tt.query, "", "")
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("X-Total-Count"); got != tt.wantCount {
+				t.Errorf("getChirps() X-Total-Count = %q, want %q", got, tt.wantCount)
+			}
+
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if len(got) != tt.wantRows {
+				t.Errorf("getChirps() returned %d chirps, want %d", len(got), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestGetChirpsDateRange(t *testing.T) {
+	a, f := newFakeConfig()
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	daysAgo := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+	backdate := func(token, body string, created time.Time) {
+		t.Helper()
+		_, c := postChirp(t, a, token, `{"body":"`+body+`"}`)
+		row := f.state.chirps[c.Id]
+		row.CreatedAt = created
+		f.state.chirps[c.Id] = row
+	}
+	backdate(alice.Token, "ten days ago", daysAgo(10))
+	backdate(alice.Token, "five days ago", daysAgo(5))
+	backdate(bob.Token, "bob five days ago", daysAgo(5).Add(time.Hour))
+	backdate(alice.Token, "yesterday", daysAgo(1))
+
+	rfc := func(t time.Time) string { return url.QueryEscape(t.Format(time.RFC3339)) }
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "Bounded range",
+			query:      "?start=" + rfc(daysAgo(7)) + "&end=" + rfc(daysAgo(2)),
+			wantStatus: http.StatusOK,
+			want:       []string{"five days ago", "bob five days ago"},
+		},
+		{
+			name: "Bounded range by author",
+			query: "?start=" + rfc(daysAgo(7)) + "&end=" + rfc(daysAgo(2)) +
+				"&author_id=" + bob.Id.String(),
+			wantStatus: http.StatusOK,
+			want:       []string{"bob five days ago"},
+		},
+		{
+			name:       "Inclusive bounds",
+			query:      "?start=" + rfc(daysAgo(10)) + "&end=" + rfc(daysAgo(10)),
+			wantStatus: http.StatusOK,
+			want:       []string{"ten days ago"},
+		},
+		{
+			name:       "Only start",
+			query:      "?start=" + rfc(daysAgo(3)),
+			wantStatus: http.StatusOK,
+			want:       []string{"yesterday"},
+		},
+		{
+			name:       "Only end",
+			query:      "?end=" + rfc(daysAgo(7)),
+			wantStatus: http.StatusOK,
+			want:       []string{"ten days ago"},
+		},
+		{
+			name:       "Start after end",
+			query:      "?start=" + rfc(daysAgo(2)) + "&end=" + rfc(daysAgo(7)),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unparseable start",
+			query:      "?start=last-week",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+tt.query, "", "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getChirps() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got []chirp
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			bodies := []string{}
+			for _, c := range got {
+				bodies = append(bodies, c.Body)
+			}
+			if !slices.Equal(bodies, tt.want) {
+				t.Errorf("getChirps() = %q, want %q", bodies, tt.want)
+			}
+			wantCount := strconv.Itoa(len(tt.want))
+			if count := rec.Header().Get("X-Total-Count"); count != wantCount {
+				t.Errorf("getChirps() X-Total-Count = %q, want %q", count, wantCount)
+			}
+		})
+	}
+}
+
+func TestDeleteChirpIsSoft(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, parent := postChirp(t, a, u.Token, `{"body":"parent"}`)
+	_, reply := postChirp(
+		t,
+		a,
+		u.Token,
+		`{"body":"reply","parent_id":"`+parent.Id.String()+`"}`,
+	)
+
+	rq := newAuthedRequest(t, http.MethodDelete, "/api/chirps/"+parent.Id.String(), u.Id, a.secret)
+	rq.SetPathValue("chirpID", parent.Id.String())
+	rec := httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	row, ok := f.state.chirps[parent.Id]
+	if !ok {
+		t.Fatalf("deleteChirpsChirpID() removed the row")
+	}
+	if !row.DeletedAt.Valid {
+		t.Errorf("deleteChirpsChirpID() didn't set deleted_at")
+	}
+	if r := f.state.chirps[reply.Id]; r.ParentID.UUID != parent.Id {
+		t.Errorf("reply parent_id = %v, want %v", r.ParentID, parent.Id)
+	}
+
+	if rec := getChirpByID(t, a, parent.Id); rec.Code != http.StatusNotFound {
+		t.Errorf("getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = doJSON(t, a.getChirps, http.MethodGet, "/api/chirps", "", "")
+	var got []chirp
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Id != reply.Id {
+		t.Errorf("getChirps() = %v, want only the reply", got)
+	}
+	if count := rec.Header().Get("X-Total-Count"); count != "1" {
+		t.Errorf("getChirps() X-Total-Count = %q, want %q", count, "1")
+	}
+
+	rq = newAuthedRequest(t, http.MethodDelete, "/api/chirps/"+parent.Id.String(), u.Id, a.secret)
+	rq.SetPathValue("chirpID", parent.Id.String())
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetAdminUsers(t *testing.T) {
+	a, _ := newFakeConfig()
+	for _, email := range []string{
+		"a@example.com",
+		"b@example.com",
+		"c@example.com",
+	} {
+		signUpAndLogIn(t, a, email)
+	}
+
+	tests := []struct {
+		name       string
+		platform   string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "Not dev",
+			platform:   "prod",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "All users",
+			platform:   "dev",
+			wantStatus: http.StatusOK,
+			want:       []string{"a@example.com", "b@example.com", "c@example.com"},
+		},
+		{
+			name:       "Page window",
+			platform:   "dev",
+			query:      "?limit=1&offset=1",
+			wantStatus: http.StatusOK,
+			want:       []string{"b@example.com"},
+		},
+		{
+			name:       "Past the end",
+			platform:   "dev",
+			query:      "?offset=10",
+			wantStatus: http.StatusOK,
+			want:       []string{},
+		},
+		{
+			name:       "Invalid limit",
+			platform:   "dev",
+			query:      "?limit=x",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.platform = tt.platform
+			rec := doJSON(t, a.getAdminUsers, http.MethodGet, "/admin/users"+tt.query, "", "")
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("getAdminUsers() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if strings.Contains(rec.Body.String(), "password") {
+				t.Errorf("getAdminUsers() body = %q exposes a password field", rec.Body.String())
+			}
+
+			var got []user
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			emails := []string{}
+			for _, u := range got {
+				emails = append(emails, u.Email)
+			}
+			if !slices.Equal(emails, tt.want) {
+				t.Errorf("getAdminUsers() emails = %q, want %q", emails, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWWWAuthenticate(t *testing.T) {
+	a, _ := newFakeConfig()
+	userID := uuid.New()
+	expired, _ := auth.MakeJWT(userID, a.secret, auth.DefaultAudience, -time.Minute)
+	forged, _ := auth.MakeJWT(userID, "not-the-secret", auth.DefaultAudience, time.Hour)
+
+	tests := []struct {
+		name     string
+		token    string
+		wantDesc string
+	}{
+		{
+			name:     "Expired token",
+			token:    expired,
+			wantDesc: "access token expired",
+		},
+		{
+			name:     "Forged token",
+			token:    forged,
+			wantDesc: "access token is invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, a.middlewareAuth(a.getFeed), http.MethodGet, "/api/feed", tt.token, "")
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("getFeed() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			got := rec.Header().Get("WWW-Authenticate")
+			if !strings.Contains(got, `error="invalid_token"`) ||
+				!strings.Contains(got, tt.wantDesc) {
+				t.Errorf("WWW-Authenticate = %q, want invalid_token with %q", got, tt.wantDesc)
+			}
+		})
+	}
+}
+
+func TestPostResetToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		platform    string
+		configured  string
+		header      string
+		wantStatus  int
+		wantDeleted bool
+	}{
+		{
+			name:        "Correct token",
+			platform:    "dev",
+			configured:  "let-me-reset",
+			header:      "let-me-reset",
+			wantStatus:  http.StatusOK,
+			wantDeleted: true,
+		},
+		{
+			name:       "Wrong token",
+			platform:   "dev",
+			configured: "let-me-reset",
+			header:     "guess",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Missing token",
+			platform:   "dev",
+			configured: "let-me-reset",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "No token configured",
+			platform:   "dev",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Not dev",
+			platform:   "production",
+			configured: "let-me-reset",
+			header:     "let-me-reset",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, f := newFakeConfig()
+			a.platform = tt.platform
+			a.adminResetToken = tt.configured
+			signUpAndLogIn(t, a, "user@example.com")
+
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(
+				http.MethodPost,
+				"/admin/reset",
+				strings.NewReader(`{"confirm":"RESET"}`),
+			)
+			if tt.header != "" {
+				rq.Header.Set("X-Admin-Reset-Token", tt.header)
+			}
+			a.postReset(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("postReset() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if deleted := len(f.state.users) == 0; deleted != tt.wantDeleted {
+				t.Errorf("postReset() deleted users = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestPostResetConfirmation(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantDeleted bool
+	}{
+		{
+			name:        "Confirmed",
+			body:        `{"confirm":"RESET"}`,
+			wantStatus:  http.StatusOK,
+			wantDeleted: true,
+		},
+		{
+			name:       "Missing body",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing confirm",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Wrong confirm",
+			body:       `{"confirm":"reset"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, f := newFakeConfig()
+			a.platform = "dev"
+			a.adminResetToken = "let-me-reset"
+			signUpAndLogIn(t, a, "user@example.com")
+
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(
+				http.MethodPost,
+				"/admin/reset",
+				strings.NewReader(tt.body),
+			)
+			rq.Header.Set("X-Admin-Reset-Token", "let-me-reset")
+			a.postReset(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("postReset() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if deleted := len(f.state.users) == 0; deleted != tt.wantDeleted {
+				t.Errorf("postReset() deleted users = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		port    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Unset",
+			want: ":8080",
+		},
+		{
+			name: "Port",
+			port: "3000",
+			want: ":3000",
+		},
+		{
+			name: "Address",
+			addr: "127.0.0.1:9000",
+			port: "3000",
+			want: "127.0.0.1:9000",
+		},
+		{
+			name:    "Non-numeric port",
+			port:    "http",
+			wantErr: true,
+		},
+		{
+			name:    "Port out of range",
+			port:    "70000",
+			wantErr: true,
+		},
+		{
+			name:    "Port zero",
+			port:    "0",
+			wantErr: true,
+		},
+		{
+			name:    "Address without port",
+			addr:    "localhost",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADDR", tt.addr)
+			t.Setenv("PORT", tt.port)
+
+			got, err := listenAddr()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listenAddr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("listenAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
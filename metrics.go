@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// metrics holds the counters exposed on /metrics. The logging middleware
+// counts every request; handlers bump the domain counters on success.
+type metrics struct {
+	requests      atomic.Int64
+	inFlight      atomic.Int64
+	statusClasses [5]atomic.Int64
+	chirpsCreated atomic.Int64
+	chirpsEdited  atomic.Int64
+	chirpsDeleted atomic.Int64
+	usersCreated  atomic.Int64
+	logins        atomic.Int64
+}
+
+// resetLifecycle zeroes the chirp and user counters shown on /admin/metrics,
+// for postReset. The HTTP counters keep running.
+func (m *metrics) resetLifecycle() {
+	m.chirpsCreated.Store(0)
+	m.chirpsEdited.Store(0)
+	m.chirpsDeleted.Store(0)
+	m.usersCreated.Store(0)
+}
+
+// observe records a finished request with the given status code.
+func (m *metrics) observe(status int) {
+	m.requests.Add(1)
+
+	class := status/100 - 1
+	if class >= 0 && class < len(m.statusClasses) {
+		m.statusClasses[class].Add(1)
+	}
+}
+
+// getPrometheusMetrics reports the counters in the Prometheus text format.
+func (a *apiConfig) getPrometheusMetrics(
+	rw http.ResponseWriter,
+	rq *http.Request,
+) {
+	m := &a.metrics
+	b := &strings.Builder{}
+
+	writeMetric := func(name, kind, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+	}
+
+	writeMetric(
+		"chirpy_http_requests_total",
+		"counter",
+		"Total HTTP requests handled.",
+	)
+	fmt.Fprintf(b, "chirpy_http_requests_total %d\n", m.requests.Load())
+
+	writeMetric(
+		"chirpy_http_responses_total",
+		"counter",
+		"HTTP responses by status class.",
+	)
+	for i := range m.statusClasses {
+		fmt.Fprintf(
+			b,
+			"chirpy_http_responses_total{class=\"%dxx\"} %d\n",
+			i+1,
+			m.statusClasses[i].Load(),
+		)
+	}
+
+	writeMetric(
+		"chirpy_http_requests_in_flight",
+		"gauge",
+		"HTTP requests currently being handled.",
+	)
+	fmt.Fprintf(b, "chirpy_http_requests_in_flight %d\n", m.inFlight.Load())
+
+	writeMetric(
+		"chirpy_chirps_created_total",
+		"counter",
+		"Chirps created.",
+	)
+	fmt.Fprintf(b, "chirpy_chirps_created_total %d\n", m.chirpsCreated.Load())
+
+	writeMetric(
+		"chirpy_chirps_edited_total",
+		"counter",
+		"Chirps edited.",
+	)
+	fmt.Fprintf(b, "chirpy_chirps_edited_total %d\n", m.chirpsEdited.Load())
+
+	writeMetric(
+		"chirpy_chirps_deleted_total",
+		"counter",
+		"Chirps deleted.",
+	)
+	fmt.Fprintf(b, "chirpy_chirps_deleted_total %d\n", m.chirpsDeleted.Load())
+
+	writeMetric(
+		"chirpy_users_created_total",
+		"counter",
+		"Users created.",
+	)
+	fmt.Fprintf(b, "chirpy_users_created_total %d\n", m.usersCreated.Load())
+
+	writeMetric(
+		"chirpy_logins_total",
+		"counter",
+		"Successful logins.",
+	)
+	fmt.Fprintf(b, "chirpy_logins_total %d\n", m.logins.Load())
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, err := rw.Write([]byte(b.String()))
+	if err != nil {
+		fmt.Printf("apiConfig.getPrometheusMetrics: %v\n", err)
+	}
+}
+
+// getAdminDB reports the database connection pool's statistics, for spotting
+// pool exhaustion. Like the other admin endpoints it's only served in dev.
+func (a *apiConfig) getAdminDB(rw http.ResponseWriter, rq *http.Request) {
+	if a.platform != "dev" {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if a.db == nil {
+		respondWithError(rw, http.StatusServiceUnavailable, "no database")
+		return
+	}
+
+	stats := a.db.Stats()
+
+	type response struct {
+		MaxOpenConnections  int     `json:"max_open_connections"`
+		OpenConnections     int     `json:"open_connections"`
+		InUse               int     `json:"in_use"`
+		Idle                int     `json:"idle"`
+		WaitCount           int64   `json:"wait_count"`
+		WaitDurationSeconds float64 `json:"wait_duration_seconds"`
+		MaxIdleClosed       int64   `json:"max_idle_closed"`
+		MaxIdleTimeClosed   int64   `json:"max_idle_time_closed"`
+		MaxLifetimeClosed   int64   `json:"max_lifetime_closed"`
+	}
+	respondWithJSON(rw, http.StatusOK, response{
+		MaxOpenConnections:  stats.MaxOpenConnections,
+		OpenConnections:     stats.OpenConnections,
+		InUse:               stats.InUse,
+		Idle:                stats.Idle,
+		WaitCount:           stats.WaitCount,
+		WaitDurationSeconds: stats.WaitDuration.Seconds(),
+		MaxIdleClosed:       stats.MaxIdleClosed,
+		MaxIdleTimeClosed:   stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:   stats.MaxLifetimeClosed,
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetPrometheusMetrics(t *testing.T) {
+	a := &apiConfig{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", a.getPrometheusMetrics)
+	mux.Handle("GET /ok", okHandler())
+	handler := a.middlewareLogging(mux)
+
+	for _, path := range []string{"/ok", "/ok", "/missing"} {
+		handler.ServeHTTP(
+			httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, path, nil),
+		)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"chirpy_http_requests_total 3\n",
+		"chirpy_http_responses_total{class=\"2xx\"} 2\n",
+		"chirpy_http_responses_total{class=\"4xx\"} 1\n",
+		"chirpy_http_requests_in_flight 1\n",
+		"chirpy_chirps_created_total 0\n",
+		"chirpy_chirps_edited_total 0\n",
+		"chirpy_chirps_deleted_total 0\n",
+		"chirpy_users_created_total 0\n",
+		"chirpy_logins_total 0\n",
+		"# TYPE chirpy_http_requests_in_flight gauge\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestLifecycleMetrics(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.platform = "dev"
+	a.adminResetToken = "let-me-reset"
+
+	check := func(created, edited, deleted, users int64) {
+		t.Helper()
+
+		m := &a.metrics
+		got := [4]int64{
+			m.chirpsCreated.Load(),
+			m.chirpsEdited.Load(),
+			m.chirpsDeleted.Load(),
+			m.usersCreated.Load(),
+		}
+		if want := [4]int64{created, edited, deleted, users}; got != want {
+			t.Errorf("created, edited, deleted, users = %v, want %v", got, want)
+		}
+	}
+
+	u := signUpAndLogIn(t, a, "user@example.com")
+	check(0, 0, 0, 1)
+
+	_, first := postChirp(t, a, u.Token, `{"body":"first chirp"}`)
+	_, second := postChirp(t, a, u.Token, `{"body":"second chirp"}`)
+	check(2, 0, 0, 1)
+
+	rq := httptest.NewRequest(
+		http.MethodPut,
+		"/api/chirps/"+first.Id.String(),
+		strings.NewReader(`{"body":"edited chirp"}`),
+	)
+	rq.Header.Set("Authorization", "Bearer "+u.Token)
+	rq.SetPathValue("chirpID", first.Id.String())
+	rec := httptest.NewRecorder()
+	a.middlewareAuth(a.putChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	check(2, 1, 0, 1)
+
+	rq = newAuthedRequest(
+		t,
+		http.MethodDelete,
+		"/api/chirps/"+second.Id.String(),
+		u.Id,
+		a.secret,
+	)
+	rq.SetPathValue("chirpID", second.Id.String())
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	check(2, 1, 1, 1)
+
+	rec = httptest.NewRecorder()
+	a.getMetrics(rec, httptest.NewRequest(http.MethodGet, "/admin/metrics", nil))
+	for _, want := range []string{
+		"Chirps created: 2",
+		"Chirps edited: 1",
+		"Chirps deleted: 1",
+		"Users created: 1",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("getMetrics() missing %q:\n%s", want, rec.Body.String())
+		}
+	}
+
+	rq = httptest.NewRequest(
+		http.MethodPost,
+		"/admin/reset",
+		strings.NewReader(`{"confirm":"RESET"}`),
+	)
+	rq.Header.Set("X-Admin-Reset-Token", "let-me-reset")
+	rec = httptest.NewRecorder()
+	a.postReset(rec, rq)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("postReset() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	check(0, 0, 0, 0)
+}
+
+func TestGetAdminDB(t *testing.T) {
+	a := newSQLiteConfig(t)
+
+	rec := doJSON(t, a.getAdminDB, http.MethodGet, "/admin/db", "", "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("getAdminDB() outside dev status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	a.platform = "dev"
+	rec = doJSON(t, a.getAdminDB, http.MethodGet, "/admin/db", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getAdminDB() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got map[string]any
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, field := range []string{
+		"max_open_connections",
+		"open_connections",
+		"in_use",
+		"idle",
+		"wait_count",
+		"wait_duration_seconds",
+	} {
+		if _, ok := got[field]; !ok {
+			t.Errorf("getAdminDB() missing %q: %s", field, rec.Body.String())
+		}
+	}
+	if got["open_connections"].(float64) < 1 {
+		t.Errorf("getAdminDB() open_connections = %v, want at least 1", got["open_connections"])
+	}
+}
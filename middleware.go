@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+)
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code
+// written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack lets WebSocket upgrades through the middleware. The connection is
+// logged as 101 since nothing calls WriteHeader once it's hijacked.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// middlewareRecover turns a panicking handler into a 500 for that request
+// instead of letting it take the whole server down.
+func (a *apiConfig) middlewareRecover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// net/http uses this panic to abort a response on purpose.
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			slog.Error(
+				"handler panicked",
+				"method", rq.Method,
+				"path", rq.URL.Path,
+				"error", err,
+				"stack", string(debug.Stack()),
+			)
+			respondWithError(
+				rw,
+				http.StatusInternalServerError,
+				"internal server error",
+			)
+		}()
+
+		next.ServeHTTP(rw, rq)
+	})
+}
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestIDFromContext returns the ID middlewareRequestID assigned to the
+// request, or "" outside of one.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// middlewareRequestID tags each request with the caller's X-Request-Id, or a
+// fresh UUID if it has none, and echoes it on the response.
+func (a *apiConfig) middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		id := rq.Header.Get("X-Request-Id")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		rw.Header().Set("X-Request-Id", id)
+		ctx := context.WithValue(rq.Context(), requestIDKey{}, id)
+		next.ServeHTTP(rw, rq.WithContext(ctx))
+	})
+}
+
+func (a *apiConfig) middlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+		a.metrics.inFlight.Add(1)
+		defer a.metrics.inFlight.Add(-1)
+
+		slog.Debug(
+			"request started",
+			"request_id", requestIDFromContext(rq.Context()),
+			"method", rq.Method,
+			"path", rq.URL.Path,
+			"remote_addr", rq.RemoteAddr,
+		)
+
+		next.ServeHTTP(rec, rq)
+		a.metrics.observe(rec.status)
+
+		slog.Info(
+			"request",
+			"request_id", requestIDFromContext(rq.Context()),
+			"method", rq.Method,
+			"path", rq.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+type userIDKey struct{}
+
+// userIDFromContext returns the user middlewareAuth authenticated the request
+// as. It reports false if the request didn't pass through middlewareAuth.
+func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(uuid.UUID)
+	return userID, ok
+}
+
+// middlewareAuth only lets requests with a valid, unrevoked access token or
+// an active API key through to next, and records the caller for
+// userIDFromContext. API keys are sent as "Authorization: ApiKey <key>".
+func (a *apiConfig) middlewareAuth(next http.HandlerFunc) http.HandlerFunc {
+	jwtAuth := a.middlewareJWTAuth(next)
+	return func(rw http.ResponseWriter, rq *http.Request) {
+		header := strings.TrimSpace(rq.Header.Get("Authorization"))
+		if scheme, _, _ := strings.Cut(header, " "); scheme != "ApiKey" {
+			jwtAuth(rw, rq)
+			return
+		}
+
+		key, err := auth.GetAPIKey(rq.Header)
+		if err != nil {
+			fmt.Printf("apiConfig.middlewareAuth: %v\n", err)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		row, err := a.qry.GetAPIKeyByHash(rq.Context(), auth.HashAPIKey(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			fmt.Printf("apiConfig.middlewareAuth: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(rq.Context(), userIDKey{}, row.UserID)
+		next(rw, rq.WithContext(ctx))
+	}
+}
+
+// middlewareJWTAuth is middlewareAuth without API keys, for endpoints a
+// service integration mustn't reach, such as managing the keys themselves.
+func (a *apiConfig) middlewareJWTAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, rq *http.Request) {
+		tokenString, err := auth.GetBearerToken(rq.Header)
+		if err != nil {
+			fmt.Printf("apiConfig.middlewareJWTAuth: %v\n", err)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		userID, jti, err := auth.ValidateJWTWithID(
+			tokenString,
+			a.secret,
+			a.audience(),
+		)
+		if err != nil {
+			fmt.Printf("apiConfig.middlewareJWTAuth: %v\n", err)
+			respondInvalidToken(rw, err)
+			return
+		}
+
+		revoked, err := a.isAccessTokenRevoked(rq.Context(), jti)
+		if err != nil {
+			fmt.Printf("apiConfig.middlewareJWTAuth: %v\n", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		} else if revoked {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(rq.Context(), userIDKey{}, userID)
+		next(rw, rq.WithContext(ctx))
+	}
+}
+
+// middlewareReadOnly rejects every request that could modify data while the
+// API is in read-only mode. Resetting in dev stays allowed so a developer can
+// still wipe a local database during a migration.
+func (a *apiConfig) middlewareReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		if !a.readOnly {
+			next.ServeHTTP(rw, rq)
+			return
+		}
+
+		switch rq.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(rw, rq)
+			return
+		}
+
+		if a.platform == "dev" && rq.URL.Path == "/admin/reset" {
+			next.ServeHTTP(rw, rq)
+			return
+		}
+
+		respondWithError(rw, http.StatusServiceUnavailable, "read only")
+	})
+}
+
+// drainRetryAfter is how long clients turned away during shutdown are told to
+// wait, by which point another instance should be serving.
+const drainRetryAfter = 5 * time.Second
+
+// middlewareDrain turns new requests away with a 503 once shutdown has begun.
+// Requests already past it run to completion before the server stops.
+func (a *apiConfig) middlewareDrain(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		if !a.draining.Load() {
+			next.ServeHTTP(rw, rq)
+			return
+		}
+
+		rw.Header().Set(
+			"Retry-After",
+			strconv.Itoa(int(drainRetryAfter.Seconds())),
+		)
+		rw.Header().Set("Connection", "close")
+		respondWithError(
+			rw,
+			http.StatusServiceUnavailable,
+			"server is shutting down",
+		)
+	})
+}
+
+// middlewareCORS adds CORS headers to /api/ responses so browser clients on
+// other origins can call the API, and answers preflight requests itself.
+func (a *apiConfig) middlewareCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		if !strings.HasPrefix(rq.URL.Path, "/api/") {
+			next.ServeHTTP(rw, rq)
+			return
+		}
+
+		origin := rq.Header.Get("Origin")
+		if slices.Contains(a.corsOrigins, "*") {
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && slices.Contains(a.corsOrigins, origin) {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			rw.Header().Add("Vary", "Origin")
+		}
+		rw.Header().Set(
+			"Access-Control-Allow-Methods",
+			"GET, POST, PUT, DELETE, OPTIONS",
+		)
+		rw.Header().Set(
+			"Access-Control-Allow-Headers",
+			"Authorization, Content-Type",
+		)
+
+		if rq.Method == http.MethodOptions {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(rw, rq)
+	})
+}
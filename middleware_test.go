@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestMiddlewareReadOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		readOnly   bool
+		platform   string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "GET in read-only mode",
+			readOnly:   true,
+			method:     http.MethodGet,
+			path:       "/api/chirps",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "POST in read-only mode",
+			readOnly:   true,
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "PUT in read-only mode",
+			readOnly:   true,
+			method:     http.MethodPut,
+			path:       "/api/users",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "DELETE in read-only mode",
+			readOnly:   true,
+			method:     http.MethodDelete,
+			path:       "/api/chirps/123",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "Reset in dev is exempt",
+			readOnly:   true,
+			platform:   "dev",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Reset outside dev is blocked",
+			readOnly:   true,
+			platform:   "prod",
+			method:     http.MethodPost,
+			path:       "/admin/reset",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "POST with read-only mode off",
+			readOnly:   false,
+			method:     http.MethodPost,
+			path:       "/api/chirps",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &apiConfig{readOnly: tt.readOnly, platform: tt.platform}
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(tt.method, tt.path, nil)
+
+			a.middlewareReadOnly(okHandler()).ServeHTTP(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("middlewareReadOnly() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	a := &apiConfig{}
+	teapot := http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+
+	a.middlewareLogging(teapot).ServeHTTP(rec, rq)
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("middlewareLogging() status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+
+	line := buf.String()
+	for _, want := range []string{"method=GET", "path=/api/healthz", "status=418", "duration="} {
+		if !strings.Contains(line, want) {
+			t.Errorf("middlewareLogging() log %q is missing %q", line, want)
+		}
+	}
+}
+
+func TestMiddlewareLoggingDefaultStatus(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	a := &apiConfig{}
+	implicitOK := http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+		rw.Write([]byte("OK"))
+	})
+	rq := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+
+	a.middlewareLogging(implicitOK).ServeHTTP(httptest.NewRecorder(), rq)
+
+	if !strings.Contains(buf.String(), "status=200") {
+		t.Errorf("middlewareLogging() log %q is missing status=200", buf.String())
+	}
+}
+
+func TestMiddlewareCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		path        string
+		origin      string
+		wantStatus  int
+		wantOrigin  string
+		wantHandled bool
+	}{
+		{
+			name:        "Wildcard origin",
+			origins:     []string{"*"},
+			method:      http.MethodGet,
+			path:        "/api/chirps",
+			origin:      "https://example.com",
+			wantStatus:  http.StatusOK,
+			wantOrigin:  "*",
+			wantHandled: true,
+		},
+		{
+			name:        "Allowed origin",
+			origins:     []string{"https://example.com"},
+			method:      http.MethodGet,
+			path:        "/api/chirps",
+			origin:      "https://example.com",
+			wantStatus:  http.StatusOK,
+			wantOrigin:  "https://example.com",
+			wantHandled: true,
+		},
+		{
+			name:        "Disallowed origin",
+			origins:     []string{"https://example.com"},
+			method:      http.MethodGet,
+			path:        "/api/chirps",
+			origin:      "https://evil.example",
+			wantStatus:  http.StatusOK,
+			wantOrigin:  "",
+			wantHandled: true,
+		},
+		{
+			name:        "Preflight",
+			origins:     []string{"*"},
+			method:      http.MethodOptions,
+			path:        "/api/chirps",
+			origin:      "https://example.com",
+			wantStatus:  http.StatusNoContent,
+			wantOrigin:  "*",
+			wantHandled: false,
+		},
+		{
+			name:        "Non-API path",
+			origins:     []string{"*"},
+			method:      http.MethodGet,
+			path:        "/app/",
+			origin:      "https://example.com",
+			wantStatus:  http.StatusOK,
+			wantOrigin:  "",
+			wantHandled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			next := http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+				handled = true
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			a := &apiConfig{corsOrigins: tt.origins}
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(tt.method, tt.path, nil)
+			rq.Header.Set("Origin", tt.origin)
+
+			a.middlewareCORS(next).ServeHTTP(rec, rq)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("middlewareCORS() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("middlewareCORS() called handler = %v, want %v", handled, tt.wantHandled)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if strings.HasPrefix(tt.path, "/api/") {
+				if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Authorization, Content-Type" {
+					t.Errorf("Access-Control-Allow-Headers = %q", got)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Methods"); got == "" {
+					t.Errorf("Access-Control-Allow-Methods is missing")
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantEcho bool
+	}{
+		{
+			name:     "Supplied ID",
+			header:   "abc-123",
+			wantEcho: true,
+		},
+		{
+			name:     "No ID",
+			header:   "",
+			wantEcho: false,
+		},
+		{
+			name:     "Oversized ID",
+			header:   strings.Repeat("a", maxRequestIDLength+1),
+			wantEcho: false,
+		},
+		{
+			name:     "ID with control characters",
+			header:   "abc\tdef",
+			wantEcho: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &apiConfig{}
+			var seen string
+			handler := http.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request) {
+				seen = requestIDFromContext(rq.Context())
+			})
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+			if tt.header != "" {
+				rq.Header.Set("X-Request-Id", tt.header)
+			}
+
+			a.middlewareRequestID(handler).ServeHTTP(rec, rq)
+
+			got := rec.Header().Get("X-Request-Id")
+			if got != seen {
+				t.Errorf("response ID %q != context ID %q", got, seen)
+			}
+			if tt.wantEcho && got != tt.header {
+				t.Errorf("X-Request-Id = %q, want %q", got, tt.header)
+			}
+			if !tt.wantEcho {
+				if _, err := uuid.Parse(got); err != nil {
+					t.Errorf("X-Request-Id = %q, want a generated UUID", got)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareLoggingRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	a := &apiConfig{}
+	rq := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+	rq.Header.Set("X-Request-Id", "abc-123")
+
+	a.middlewareRequestID(a.middlewareLogging(okHandler())).ServeHTTP(httptest.NewRecorder(), rq)
+
+	if !strings.Contains(buf.String(), "request_id=abc-123") {
+		t.Errorf("middlewareLogging() log %q is missing request_id=abc-123", buf.String())
+	}
+}
+
+func TestMiddlewareRecover(t *testing.T) {
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	a := &apiConfig{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /panic", func(rw http.ResponseWriter, rq *http.Request) {
+		panic("boom")
+	})
+	mux.Handle("GET /ok", okHandler())
+
+	srv := httptest.NewServer(a.middlewareRecover(mux))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/panic")
+	if err != nil {
+		t.Fatalf("GET /panic error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("GET /panic status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if !strings.Contains(string(body), `"error"`) {
+		t.Errorf("GET /panic body = %q, want a JSON error", body)
+	}
+
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatalf("GET /ok error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /ok status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestMiddlewareAuth(t *testing.T) {
+	a, f := newFakeConfig()
+	userID := uuid.New()
+	valid, _ := auth.MakeJWT(userID, a.secret, auth.DefaultAudience, time.Hour)
+	forged, _ := auth.MakeJWT(userID, "not-the-secret", auth.DefaultAudience, time.Hour)
+	revoked, _ := auth.MakeJWT(userID, a.secret, auth.DefaultAudience, time.Hour)
+	otherAudience, _ := auth.MakeJWT(userID, a.secret, "another-chirpy", time.Hour)
+	_, jti, _ := auth.ValidateJWTWithID(revoked, a.secret, a.audience())
+	f.state.revokedJTIs[jti] = userID
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantCalled bool
+	}{
+		{
+			name:       "Valid token",
+			token:      valid,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:       "Missing token",
+			token:      "",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Forged token",
+			token:      forged,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Revoked token",
+			token:      revoked,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Token for another audience",
+			token:      otherAudience,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			var got uuid.UUID
+			next := func(rw http.ResponseWriter, rq *http.Request) {
+				called = true
+				got, _ = userIDFromContext(rq.Context())
+			}
+
+			rec := doJSON(t, a.middlewareAuth(next), http.MethodGet, "/api/me", tt.token, "")
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("middlewareAuth() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantCalled {
+				t.Fatalf("middlewareAuth() called next = %v, want %v", called, tt.wantCalled)
+			}
+			if called && got != userID {
+				t.Errorf("userIDFromContext() = %v, want %v", got, userID)
+			}
+		})
+	}
+}
+
+func TestUserIDFromContextUnauthenticated(t *testing.T) {
+	rq := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	if _, ok := userIDFromContext(rq.Context()); ok {
+		t.Errorf("userIDFromContext() ok = true outside middlewareAuth")
+	}
+}
+
+func TestMiddlewareDrain(t *testing.T) {
+	a := &apiConfig{}
+	startDrain := false
+	h := a.middlewareDrain(http.HandlerFunc(
+		func(rw http.ResponseWriter, rq *http.Request) {
+			// Shutdown beginning mid-request mustn't cut this one off.
+			if startDrain {
+				a.draining.Store(true)
+			}
+			rw.WriteHeader(http.StatusOK)
+		},
+	))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("before drain status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	startDrain = true
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("in-flight request status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/api/chirps", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s while draining status = %d, want %d", method, rec.Code, http.StatusServiceUnavailable)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("%s while draining Retry-After = %q, want %q", method, got, "5")
+		}
+	}
+
+	a.draining.Store(false)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("after clearing drain status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+type page struct {
+	Limit  int32
+	Offset int32
+}
+
+// parsePage reads the limit and offset query parameters shared by the listing
+// endpoints. Limits above maxPageLimit are clamped rather than rejected.
+func parsePage(query url.Values) (page, error) {
+	p := page{Limit: defaultPageLimit, Offset: 0}
+
+	if val := query.Get("limit"); val != "" {
+		limit, err := strconv.ParseInt(val, 10, 32)
+		if err != nil || limit < 0 {
+			return page{}, fmt.Errorf("invalid limit: %q", val)
+		}
+		p.Limit = int32(min(limit, maxPageLimit))
+	}
+
+	if val := query.Get("offset"); val != "" {
+		offset, err := strconv.ParseInt(val, 10, 32)
+		if err != nil || offset < 0 {
+			return page{}, fmt.Errorf("invalid offset: %q", val)
+		}
+		p.Offset = int32(offset)
+	}
+
+	return p, nil
+}
+
+// chirpCursor marks a position in a newest-first chirp listing: the next page
+// holds the chirps that sort after it by (created_at, id) descending.
+type chirpCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// String encodes c as the opaque token sent in X-Next-Cursor.
+func (c chirpCursor) String() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "," + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseCursor decodes a token made by chirpCursor.String.
+func parseCursor(token string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return chirpCursor{}, fmt.Errorf("invalid cursor: %q", token)
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return chirpCursor{}, fmt.Errorf("invalid cursor: %q", token)
+	}
+
+	c := chirpCursor{}
+	c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return chirpCursor{}, fmt.Errorf("invalid cursor: %q", token)
+	}
+	c.ID, err = uuid.Parse(id)
+	if err != nil {
+		return chirpCursor{}, fmt.Errorf("invalid cursor: %q", token)
+	}
+	return c, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    page
+		wantErr bool
+	}{
+		{
+			name:    "Defaults",
+			query:   "",
+			want:    page{Limit: defaultPageLimit, Offset: 0},
+			wantErr: false,
+		},
+		{
+			name:    "Explicit window",
+			query:   "limit=10&offset=20",
+			want:    page{Limit: 10, Offset: 20},
+			wantErr: false,
+		},
+		{
+			name:    "Limit above max is clamped",
+			query:   "limit=1000",
+			want:    page{Limit: maxPageLimit, Offset: 0},
+			wantErr: false,
+		},
+		{
+			name:    "Zero limit",
+			query:   "limit=0",
+			want:    page{Limit: 0, Offset: 0},
+			wantErr: false,
+		},
+		{
+			name:    "Negative limit",
+			query:   "limit=-1",
+			wantErr: true,
+		},
+		{
+			name:    "Garbage offset",
+			query:   "offset=abc",
+			wantErr: true,
+		},
+		{
+			name:    "Negative offset",
+			query:   "offset=-5",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := parsePage(query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parsePage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parsePage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// walkChirps pages through getChirps newest first by following X-Next-Cursor,
+// calling between after each page, and returns the bodies page by page.
+func walkChirps(t *testing.T, a *apiConfig, between func()) [][]string {
+	t.Helper()
+
+	pages := [][]string{}
+	query := "?limit=2&before="
+	for range 10 {
+		rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+query, "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("getChirps(%q) status = %d, want %d", query, rec.Code, http.StatusOK)
+		}
+		var chirps []chirp
+		err := json.Unmarshal(rec.Body.Bytes(), &chirps)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		bodies := []string{}
+		for _, c := range chirps {
+			bodies = append(bodies, c.Body)
+		}
+		pages = append(pages, bodies)
+
+		next := rec.Header().Get("X-Next-Cursor")
+		if next == "" {
+			return pages
+		}
+		between()
+		query = "?limit=2&before=" + next
+	}
+	t.Fatalf("getChirps() kept returning X-Next-Cursor")
+	return nil
+}
+
+func TestGetChirpsKeyset(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	for _, body := range []string{"one", "two", "three", "four", "five"} {
+		postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+	}
+
+	// Chirps posted while paging belong before the first page, so they must
+	// not shift the ones still to come the way they would with offset.
+	posted := 0
+	pages := walkChirps(t, a, func() {
+		posted++
+		postChirp(t, a, u.Token, `{"body":"late"}`)
+	})
+	want := [][]string{{"five", "four"}, {"three", "two"}, {"one"}}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Errorf("pages = %q, want %q", pages, want)
+	}
+	if posted != 2 {
+		t.Errorf("followed %d cursors, want 2", posted)
+	}
+
+	// Chirps created in the same instant are ordered by id.
+	same := time.Now().UTC()
+	for id, c := range f.state.chirps {
+		c.CreatedAt = same
+		f.state.chirps[id] = c
+	}
+	seen := slices.Concat(walkChirps(t, a, func() {})...)
+	slices.Sort(seen)
+	all := []string{"five", "four", "late", "late", "one", "three", "two"}
+	if !slices.Equal(seen, all) {
+		t.Errorf("chirps seen = %q, want each exactly once", seen)
+	}
+}
+
+func TestGetChirpsKeysetNeedsBefore(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	for _, body := range []string{"one", "two", "three"} {
+		postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+	}
+
+	rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps?sort=desc&limit=2", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getChirps() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("X-Next-Cursor"); got != "" {
+		t.Errorf("getChirps() without before X-Next-Cursor = %q, want none", got)
+	}
+}
+
+func TestGetChirpsKeysetErrors(t *testing.T) {
+	a, _ := newFakeConfig()
+	cursor := chirpCursor{CreatedAt: time.Now(), ID: uuid.New()}.String()
+
+	for _, query := range []string{
+		"?before=not-a-cursor",
+		"?before=" + cursor + "&offset=2",
+		"?before=" + cursor + "&sort_by=updated_at",
+	} {
+		rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+query, "", "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("getChirps(%q) status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	want := chirpCursor{
+		CreatedAt: time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+	got, err := parseCursor(want.String())
+	if err != nil {
+		t.Fatalf("parseCursor() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("parseCursor() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// pathUUIDError reports a path value that isn't a UUID. Its message is safe to
+// send back to the client.
+type pathUUIDError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *pathUUIDError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("missing %s", e.Name)
+	}
+	return fmt.Sprintf("invalid %s: %q", e.Name, e.Value)
+}
+
+func (e *pathUUIDError) Unwrap() error {
+	return e.Err
+}
+
+// parsePathUUID parses the named path value, such as {chirpID}, as a UUID.
+// Handlers answer a *pathUUIDError with a 400 carrying its message.
+func parsePathUUID(rq *http.Request, name string) (uuid.UUID, error) {
+	val := rq.PathValue(name)
+	id, err := uuid.Parse(val)
+	if err != nil {
+		return uuid.Nil, &pathUUIDError{Name: name, Value: val, Err: err}
+	}
+	return id, nil
+}
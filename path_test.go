@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParsePathUUID(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name    string
+		value   string
+		want    uuid.UUID
+		wantErr string
+	}{
+		{
+			name:  "Valid",
+			value: id.String(),
+			want:  id,
+		},
+		{
+			name:    "Empty",
+			value:   "",
+			wantErr: "missing chirpID",
+		},
+		{
+			name:    "Malformed",
+			value:   "not-a-uuid",
+			wantErr: `invalid chirpID: "not-a-uuid"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := httptest.NewRequest(http.MethodGet, "/api/chirps/x", nil)
+			rq.SetPathValue("chirpID", tt.value)
+
+			got, err := parsePathUUID(rq, "chirpID")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parsePathUUID() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("parsePathUUID() = %v, want %v", got, tt.want)
+				}
+				return
+			}
+
+			var pathErr *pathUUIDError
+			if !errors.As(err, &pathErr) {
+				t.Fatalf("parsePathUUID() error = %v, want a *pathUUIDError", err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("parsePathUUID() error = %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBadPathUUIDResponses(t *testing.T) {
+	a, _ := newFakeConfig()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+	}{
+		{
+			name:    "getChirpsChirpID",
+			handler: a.getChirpsChirpID,
+			path:    "chirpID",
+		},
+		{
+			name:    "getChirpsChirpIDReplies",
+			handler: a.getChirpsChirpIDReplies,
+			path:    "chirpID",
+		},
+		{
+			name:    "getUsersUserID",
+			handler: a.getUsersUserID,
+			path:    "userID",
+		},
+		{
+			name:    "postUsersUserIDVerify",
+			handler: a.postUsersUserIDVerify,
+			path:    "userID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := httptest.NewRequest(http.MethodGet, "/", nil)
+			rq.SetPathValue(tt.path, "nope")
+			rec := httptest.NewRecorder()
+			tt.handler(rec, rq)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("%s() status = %d, want %d", tt.name, rec.Code, http.StatusBadRequest)
+			}
+			var got struct {
+				Error string `json:"error"`
+			}
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if want := `invalid ` + tt.path + `: "nope"`; got.Error != want {
+				t.Errorf("%s() error = %q, want %q", tt.name, got.Error, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+// Querier is the subset of database.Queries the handlers use. sqliteQuerier
+// implements it for DB_DRIVER=sqlite, and tests swap in an in-memory
+// implementation so handlers can run without a database.
+type Querier interface {
+	ConsumeRefreshToken(
+		ctx context.Context,
+		token string,
+	) (database.RefreshToken, error)
+	ConsumeEmailVerificationToken(
+		ctx context.Context,
+		arg database.ConsumeEmailVerificationTokenParams,
+	) (database.EmailVerificationToken, error)
+	CreateAPIKey(
+		ctx context.Context,
+		arg database.CreateAPIKeyParams,
+	) (database.ApiKey, error)
+	CreateAuditEntry(
+		ctx context.Context,
+		arg database.CreateAuditEntryParams,
+	) (database.AuditLog, error)
+	CreateChirp(
+		ctx context.Context,
+		arg database.CreateChirpParams,
+	) (database.Chirp, error)
+	CreateEmailVerificationToken(
+		ctx context.Context,
+		arg database.CreateEmailVerificationTokenParams,
+	) (database.EmailVerificationToken, error)
+	CreateInvite(ctx context.Context, code string) (database.Invite, error)
+	CreateRefreshToken(
+		ctx context.Context,
+		arg database.CreateRefreshTokenParams,
+	) (database.RefreshToken, error)
+	CreateUser(
+		ctx context.Context,
+		arg database.CreateUserParams,
+	) (database.User, error)
+	DeleteEmailVerificationTokensForUser(
+		ctx context.Context,
+		userID uuid.UUID,
+	) error
+	DeleteUser(ctx context.Context, id uuid.UUID) (int64, error)
+	FollowUser(ctx context.Context, arg database.FollowUserParams) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (database.ApiKey, error)
+	GetActiveRefreshTokensForUser(
+		ctx context.Context,
+		userID uuid.UUID,
+	) ([]database.RefreshToken, error)
+	GetAllChirpsPaged(
+		ctx context.Context,
+		arg database.GetAllChirpsPagedParams,
+	) ([]database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirpAuthors(
+		ctx context.Context,
+		chirpIds []uuid.UUID,
+	) ([]database.GetChirpAuthorsRow, error)
+	GetChirpCount(
+		ctx context.Context,
+		arg database.GetChirpCountParams,
+	) (int64, error)
+	GetChirpForUpdate(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirpLikeCount(ctx context.Context, chirpID uuid.UUID) (int64, error)
+	GetChirpLikeCounts(
+		ctx context.Context,
+		chirpIds []uuid.UUID,
+	) ([]database.GetChirpLikeCountsRow, error)
+	GetChirpReplies(
+		ctx context.Context,
+		arg database.GetChirpRepliesParams,
+	) ([]database.Chirp, error)
+	GetChirpsBefore(
+		ctx context.Context,
+		arg database.GetChirpsBeforeParams,
+	) ([]database.Chirp, error)
+	GetChirpsByCreatedAtRange(
+		ctx context.Context,
+		arg database.GetChirpsByCreatedAtRangeParams,
+	) ([]database.Chirp, error)
+	GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]database.Chirp, error)
+	GetChirpsByUserIDPaged(
+		ctx context.Context,
+		arg database.GetChirpsByUserIDPagedParams,
+	) ([]database.Chirp, error)
+	GetFeed(
+		ctx context.Context,
+		arg database.GetFeedParams,
+	) ([]database.Chirp, error)
+	GetLikedChirps(
+		ctx context.Context,
+		arg database.GetLikedChirpsParams,
+	) ([]database.Chirp, error)
+	GetRefreshTokenByToken(
+		ctx context.Context,
+		token string,
+	) (database.RefreshToken, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	IncrementQuoteCount(ctx context.Context, id uuid.UUID) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	LikeChirp(ctx context.Context, arg database.LikeChirpParams) error
+	ListAuditEntries(
+		ctx context.Context,
+		arg database.ListAuditEntriesParams,
+	) ([]database.AuditLog, error)
+	ListUsers(
+		ctx context.Context,
+		arg database.ListUsersParams,
+	) ([]database.User, error)
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) (database.User, error)
+	MarkWebhookProcessed(
+		ctx context.Context,
+		arg database.MarkWebhookProcessedParams,
+	) (int64, error)
+	RecordFailedLogin(
+		ctx context.Context,
+		arg database.RecordFailedLoginParams,
+	) (database.User, error)
+	ResetFailedLogins(ctx context.Context, id uuid.UUID) error
+	ResetUsers(ctx context.Context) error
+	RevokeAccessToken(
+		ctx context.Context,
+		arg database.RevokeAccessTokenParams,
+	) error
+	RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeAPIKey(
+		ctx context.Context,
+		arg database.RevokeAPIKeyParams,
+	) (int64, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	SearchChirps(
+		ctx context.Context,
+		arg database.SearchChirpsParams,
+	) ([]database.Chirp, error)
+	SetInviteUsedBy(
+		ctx context.Context,
+		arg database.SetInviteUsedByParams,
+	) error
+	SoftDeleteChirp(ctx context.Context, id uuid.UUID) error
+	SoftDeleteChirpsByUserID(
+		ctx context.Context,
+		userID uuid.UUID,
+	) ([]uuid.UUID, error)
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error
+	UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error
+	UpdateChirp(
+		ctx context.Context,
+		arg database.UpdateChirpParams,
+	) (database.Chirp, error)
+	UpdateToChirpyRed(ctx context.Context, id uuid.UUID) (database.User, error)
+	UpdateUser(
+		ctx context.Context,
+		arg database.UpdateUserParams,
+	) (database.User, error)
+	UseInvite(ctx context.Context, code string) (database.Invite, error)
+}
+
+var _ Querier = (*database.Queries)(nil)
+
+// txn is the part of *sql.Tx the handlers need to finish a transaction.
+type txn interface {
+	Commit() error
+	Rollback() error
+}
+
+// txBeginner is implemented by Queriers that manage their own transactions
+// rather than running on a.db.
+type txBeginner interface {
+	BeginTx(ctx context.Context) (txn, Querier, error)
+}
+
+// beginTx starts a transaction and returns a Querier bound to it. Rolling back
+// after a commit is a no-op, so callers can always defer Rollback. Any Querier
+// that isn't a txBeginner must be a *database.Queries backed by a.db.
+func (a *apiConfig) beginTx(ctx context.Context) (txn, Querier, error) {
+	if b, ok := a.qry.(txBeginner); ok {
+		return b.BeginTx(ctx)
+	}
+
+	q, ok := a.qry.(*database.Queries)
+	if !ok {
+		return nil, nil, fmt.Errorf("beginTx: %T can't start transactions", a.qry)
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, q.WithTx(tx), nil
+}
@@ -0,0 +1,1150 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+type fakePair struct {
+	a uuid.UUID
+	b uuid.UUID
+}
+
+type fakeState struct {
+	users         map[uuid.UUID]database.User
+	chirps        map[uuid.UUID]database.Chirp
+	refreshTokens map[string]database.RefreshToken
+	revokedJTIs   map[string]uuid.UUID
+	invites       map[string]database.Invite
+	likes         map[fakePair]bool
+	follows       map[fakePair]bool
+	webhooks      map[string]string
+	verifications map[string]database.EmailVerificationToken
+	apiKeys       map[uuid.UUID]database.ApiKey
+	audit         []database.AuditLog
+}
+
+func (s fakeState) clone() fakeState {
+	return fakeState{
+		users:         maps.Clone(s.users),
+		chirps:        maps.Clone(s.chirps),
+		refreshTokens: maps.Clone(s.refreshTokens),
+		revokedJTIs:   maps.Clone(s.revokedJTIs),
+		invites:       maps.Clone(s.invites),
+		likes:         maps.Clone(s.likes),
+		follows:       maps.Clone(s.follows),
+		webhooks:      maps.Clone(s.webhooks),
+		verifications: maps.Clone(s.verifications),
+		apiKeys:       maps.Clone(s.apiKeys),
+		audit:         slices.Clone(s.audit),
+	}
+}
+
+// fakeQuerier is an in-memory Querier for handler tests. It mirrors the SQL
+// closely enough for the handlers' behaviour, including cascading deletes and
+// unique constraints, and rolls transactions back by restoring a snapshot.
+type fakeQuerier struct {
+	mu    sync.Mutex
+	state fakeState
+	clock time.Time
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		state: fakeState{
+			users:         map[uuid.UUID]database.User{},
+			chirps:        map[uuid.UUID]database.Chirp{},
+			refreshTokens: map[string]database.RefreshToken{},
+			revokedJTIs:   map[string]uuid.UUID{},
+			invites:       map[string]database.Invite{},
+			likes:         map[fakePair]bool{},
+			follows:       map[fakePair]bool{},
+			webhooks:      map[string]string{},
+			verifications: map[string]database.EmailVerificationToken{},
+			apiKeys:       map[uuid.UUID]database.ApiKey{},
+		},
+	}
+}
+
+// now follows the wall clock like NOW() does, but never repeats a value so
+// rows always have distinct, ordered times.
+func (f *fakeQuerier) now() time.Time {
+	now := time.Now().UTC()
+	if !now.After(f.clock) {
+		now = f.clock.Add(time.Microsecond)
+	}
+	f.clock = now
+	return now
+}
+
+type fakeTx struct {
+	f        *fakeQuerier
+	snapshot fakeState
+	done     bool
+}
+
+func (t *fakeTx) Commit() error {
+	t.done = true
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.state = t.snapshot
+	return nil
+}
+
+func (f *fakeQuerier) BeginTx(ctx context.Context) (txn, Querier, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &fakeTx{f: f, snapshot: f.state.clone()}, f, nil
+}
+
+func (f *fakeQuerier) ConsumeRefreshToken(
+	ctx context.Context,
+	token string,
+) (database.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.state.refreshTokens[token]
+	now := f.now()
+	if !ok || r.RevokedAt.Valid || !r.ExpiresAt.After(now) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	r.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	r.UpdatedAt = now
+	f.state.refreshTokens[token] = r
+	return r, nil
+}
+
+func (f *fakeQuerier) ConsumeEmailVerificationToken(
+	ctx context.Context,
+	arg database.ConsumeEmailVerificationTokenParams,
+) (database.EmailVerificationToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.state.verifications[arg.Token]
+	if !ok || v.UserID != arg.UserID {
+		return database.EmailVerificationToken{}, sql.ErrNoRows
+	}
+	delete(f.state.verifications, arg.Token)
+	return v, nil
+}
+
+func (f *fakeQuerier) CreateAPIKey(
+	ctx context.Context,
+	arg database.CreateAPIKeyParams,
+) (database.ApiKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.state.apiKeys {
+		if k.KeyHash == arg.KeyHash {
+			return database.ApiKey{}, &pq.Error{Code: uniqueViolation}
+		}
+	}
+	k := database.ApiKey{
+		ID:        uuid.New(),
+		CreatedAt: f.now(),
+		UserID:    arg.UserID,
+		KeyHash:   arg.KeyHash,
+	}
+	f.state.apiKeys[k.ID] = k
+	return k, nil
+}
+
+func (f *fakeQuerier) CreateAuditEntry(
+	ctx context.Context,
+	arg database.CreateAuditEntryParams,
+) (database.AuditLog, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := database.AuditLog{
+		ID:        uuid.New(),
+		CreatedAt: f.now(),
+		ActorID:   arg.ActorID,
+		Action:    arg.Action,
+		Target:    arg.Target,
+	}
+	f.state.audit = append(f.state.audit, e)
+	return e, nil
+}
+
+func (f *fakeQuerier) CreateChirp(
+	ctx context.Context,
+	arg database.CreateChirpParams,
+) (database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.users[arg.UserID]; !ok {
+		return database.Chirp{}, &pq.Error{Code: "23503"}
+	}
+	now := f.now()
+	c := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		QuoteOf:   arg.QuoteOf,
+		ParentID:  arg.ParentID,
+	}
+	f.state.chirps[c.ID] = c
+	return c, nil
+}
+
+func (f *fakeQuerier) CreateEmailVerificationToken(
+	ctx context.Context,
+	arg database.CreateEmailVerificationTokenParams,
+) (database.EmailVerificationToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.users[arg.UserID]; !ok {
+		return database.EmailVerificationToken{}, &pq.Error{Code: "23503"}
+	}
+	v := database.EmailVerificationToken{
+		Token:     arg.Token,
+		CreatedAt: f.now(),
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	f.state.verifications[v.Token] = v
+	return v, nil
+}
+
+func (f *fakeQuerier) CreateInvite(
+	ctx context.Context,
+	code string,
+) (database.Invite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.invites[code]; ok {
+		return database.Invite{}, &pq.Error{Code: uniqueViolation}
+	}
+	i := database.Invite{Code: code, CreatedAt: f.now()}
+	f.state.invites[code] = i
+	return i, nil
+}
+
+func (f *fakeQuerier) CreateRefreshToken(
+	ctx context.Context,
+	arg database.CreateRefreshTokenParams,
+) (database.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	r := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		UserAgent: arg.UserAgent,
+		IpAddress: arg.IpAddress,
+	}
+	f.state.refreshTokens[arg.Token] = r
+	return r, nil
+}
+
+func (f *fakeQuerier) CreateUser(
+	ctx context.Context,
+	arg database.CreateUserParams,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, &pq.Error{Code: uniqueViolation}
+	}
+	now := f.now()
+	u := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	f.state.users[u.ID] = u
+	return u, nil
+}
+
+func (f *fakeQuerier) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range f.state.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeQuerier) deleteChirp(id uuid.UUID) {
+	delete(f.state.chirps, id)
+	for k := range f.state.likes {
+		if k.b == id {
+			delete(f.state.likes, k)
+		}
+	}
+	for cid, c := range f.state.chirps {
+		if c.QuoteOf.Valid && c.QuoteOf.UUID == id {
+			c.QuoteOf = uuid.NullUUID{}
+		}
+		if c.ParentID.Valid && c.ParentID.UUID == id {
+			c.ParentID = uuid.NullUUID{}
+		}
+		f.state.chirps[cid] = c
+	}
+}
+
+func (f *fakeQuerier) DeleteEmailVerificationTokensForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for token, v := range f.state.verifications {
+		if v.UserID == userID {
+			delete(f.state.verifications, token)
+		}
+	}
+	return nil
+}
+
+func (f *fakeQuerier) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.users[id]; !ok {
+		return 0, nil
+	}
+	f.deleteUser(id)
+	return 1, nil
+}
+
+func (f *fakeQuerier) deleteUser(id uuid.UUID) {
+	delete(f.state.users, id)
+	for cid, c := range f.state.chirps {
+		if c.UserID == id {
+			f.deleteChirp(cid)
+		}
+	}
+	for t, r := range f.state.refreshTokens {
+		if r.UserID == id {
+			delete(f.state.refreshTokens, t)
+		}
+	}
+	for jti, uid := range f.state.revokedJTIs {
+		if uid == id {
+			delete(f.state.revokedJTIs, jti)
+		}
+	}
+	for k := range f.state.likes {
+		if k.a == id {
+			delete(f.state.likes, k)
+		}
+	}
+	for k := range f.state.follows {
+		if k.a == id || k.b == id {
+			delete(f.state.follows, k)
+		}
+	}
+	for t, v := range f.state.verifications {
+		if v.UserID == id {
+			delete(f.state.verifications, t)
+		}
+	}
+	for kid, k := range f.state.apiKeys {
+		if k.UserID == id {
+			delete(f.state.apiKeys, kid)
+		}
+	}
+	for code, i := range f.state.invites {
+		if i.UsedBy.Valid && i.UsedBy.UUID == id {
+			i.UsedBy = uuid.NullUUID{}
+			f.state.invites[code] = i
+		}
+	}
+}
+
+func (f *fakeQuerier) FollowUser(
+	ctx context.Context,
+	arg database.FollowUserParams,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.state.follows[fakePair{arg.FollowerID, arg.FolloweeID}] = true
+	return nil
+}
+
+// fakeInRange reports whether c was created within the inclusive bounds the
+// range queries take. Invalid bounds are open.
+func fakeInRange(c database.Chirp, start, end sql.NullTime) bool {
+	if start.Valid && c.CreatedAt.Before(start.Time) {
+		return false
+	}
+	return !end.Valid || !c.CreatedAt.After(end.Time)
+}
+
+// fakePage sorts rows by creation time and applies limit and offset.
+func fakePage(
+	rows []database.Chirp,
+	sortBy string,
+	desc bool,
+	limit int32,
+	offset int32,
+) []database.Chirp {
+	key := func(c database.Chirp) time.Time { return c.CreatedAt }
+	if sortBy == "updated_at" {
+		key = func(c database.Chirp) time.Time { return c.UpdatedAt }
+	}
+	slices.SortFunc(rows, func(x, y database.Chirp) int {
+		if desc {
+			return key(y).Compare(key(x))
+		}
+		return key(x).Compare(key(y))
+	})
+	if int(offset) >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func (f *fakeQuerier) chirpsWhere(keep func(database.Chirp) bool) []database.Chirp {
+	rows := []database.Chirp{}
+	for _, c := range f.state.chirps {
+		if !c.DeletedAt.Valid && keep(c) {
+			rows = append(rows, c)
+		}
+	}
+	return rows
+}
+
+func (f *fakeQuerier) GetAPIKeyByHash(
+	ctx context.Context,
+	keyHash string,
+) (database.ApiKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.state.apiKeys {
+		if k.KeyHash == keyHash && !k.RevokedAt.Valid {
+			return k, nil
+		}
+	}
+	return database.ApiKey{}, sql.ErrNoRows
+}
+
+func (f *fakeQuerier) GetActiveRefreshTokensForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]database.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	tokens := []database.RefreshToken{}
+	for _, r := range f.state.refreshTokens {
+		if r.UserID == userID && !r.RevokedAt.Valid && r.ExpiresAt.After(now) {
+			tokens = append(tokens, r)
+		}
+	}
+	slices.SortFunc(tokens, func(x, y database.RefreshToken) int {
+		return y.CreatedAt.Compare(x.CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (f *fakeQuerier) GetAllChirpsPaged(
+	ctx context.Context,
+	arg database.GetAllChirpsPagedParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := f.chirpsWhere(func(database.Chirp) bool { return true })
+	return fakePage(rows, arg.SortBy, arg.SortDesc, arg.RowLimit, arg.RowOffset), nil
+}
+
+func (f *fakeQuerier) GetChirp(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.state.chirps[id]
+	if !ok || c.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (f *fakeQuerier) GetChirpAuthors(
+	ctx context.Context,
+	chirpIds []uuid.UUID,
+) ([]database.GetChirpAuthorsRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := map[uuid.UUID]bool{}
+	rows := []database.GetChirpAuthorsRow{}
+	for _, id := range chirpIds {
+		c, ok := f.state.chirps[id]
+		if !ok || seen[c.UserID] {
+			continue
+		}
+		u, ok := f.state.users[c.UserID]
+		if !ok {
+			continue
+		}
+		seen[c.UserID] = true
+		rows = append(rows, database.GetChirpAuthorsRow{
+			ID:          u.ID,
+			Email:       u.Email,
+			IsChirpyRed: u.IsChirpyRed,
+		})
+	}
+	return rows, nil
+}
+
+func (f *fakeQuerier) GetChirpCount(
+	ctx context.Context,
+	arg database.GetChirpCountParams,
+) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	term := strings.ToLower(unescapeLike(arg.Term.String))
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		if arg.UserID.Valid && c.UserID != arg.UserID.UUID {
+			return false
+		}
+		if !fakeInRange(c, arg.StartTime, arg.EndTime) {
+			return false
+		}
+		return !arg.Term.Valid ||
+			strings.Contains(strings.ToLower(c.Body), term)
+	})
+	return int64(len(rows)), nil
+}
+
+func (f *fakeQuerier) GetChirpForUpdate(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.Chirp, error) {
+	return f.GetChirp(ctx, id)
+}
+
+func (f *fakeQuerier) GetChirpLikeCount(
+	ctx context.Context,
+	chirpID uuid.UUID,
+) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int64
+	for k := range f.state.likes {
+		if k.b == chirpID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeQuerier) GetChirpLikeCounts(
+	ctx context.Context,
+	chirpIds []uuid.UUID,
+) ([]database.GetChirpLikeCountsRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	counts := map[uuid.UUID]int64{}
+	for k := range f.state.likes {
+		if slices.Contains(chirpIds, k.b) {
+			counts[k.b]++
+		}
+	}
+	rows := []database.GetChirpLikeCountsRow{}
+	for id, n := range counts {
+		rows = append(rows, database.GetChirpLikeCountsRow{ChirpID: id, Count: n})
+	}
+	return rows, nil
+}
+
+func (f *fakeQuerier) GetChirpReplies(
+	ctx context.Context,
+	arg database.GetChirpRepliesParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		return c.ParentID.Valid && c.ParentID.UUID == arg.ParentID
+	})
+	return fakePage(rows, "created_at", false, arg.RowLimit, arg.RowOffset), nil
+}
+
+func (f *fakeQuerier) GetChirpsBefore(
+	ctx context.Context,
+	arg database.GetChirpsBeforeParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	term := strings.ToLower(unescapeLike(arg.Term.String))
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		if arg.UserID.Valid && c.UserID != arg.UserID.UUID {
+			return false
+		}
+		if !fakeInRange(c, arg.StartTime, arg.EndTime) {
+			return false
+		}
+		if arg.Term.Valid && !strings.Contains(strings.ToLower(c.Body), term) {
+			return false
+		}
+		return !arg.BeforeCreatedAt.Valid || !arg.BeforeID.Valid ||
+			fakeKeysetCompare(c, arg.BeforeCreatedAt.Time, arg.BeforeID.UUID) < 0
+	})
+	slices.SortFunc(rows, func(x, y database.Chirp) int {
+		return fakeKeysetCompare(y, x.CreatedAt, x.ID)
+	})
+	if int(arg.RowLimit) < len(rows) {
+		rows = rows[:arg.RowLimit]
+	}
+	return rows, nil
+}
+
+// fakeKeysetCompare orders c against the (created_at, id) pair the way
+// Postgres compares row values.
+func fakeKeysetCompare(c database.Chirp, createdAt time.Time, id uuid.UUID) int {
+	return cmp.Or(
+		c.CreatedAt.Compare(createdAt),
+		bytes.Compare(c.ID[:], id[:]),
+	)
+}
+
+func (f *fakeQuerier) GetChirpsByCreatedAtRange(
+	ctx context.Context,
+	arg database.GetChirpsByCreatedAtRangeParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		if arg.UserID.Valid && c.UserID != arg.UserID.UUID {
+			return false
+		}
+		return fakeInRange(c, arg.StartTime, arg.EndTime)
+	})
+	return fakePage(rows, arg.SortBy, arg.SortDesc, arg.RowLimit, arg.RowOffset), nil
+}
+
+func (f *fakeQuerier) GetChirpsByIDs(
+	ctx context.Context,
+	ids []uuid.UUID,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.chirpsWhere(func(c database.Chirp) bool {
+		return slices.Contains(ids, c.ID)
+	}), nil
+}
+
+func (f *fakeQuerier) GetChirpsByUserIDPaged(
+	ctx context.Context,
+	arg database.GetChirpsByUserIDPagedParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		return c.UserID == arg.UserID
+	})
+	return fakePage(rows, arg.SortBy, arg.SortDesc, arg.RowLimit, arg.RowOffset), nil
+}
+
+func (f *fakeQuerier) GetFeed(
+	ctx context.Context,
+	arg database.GetFeedParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		return f.state.follows[fakePair{arg.FollowerID, c.UserID}]
+	})
+	return fakePage(rows, "created_at", true, arg.RowLimit, arg.RowOffset), nil
+}
+
+// GetLikedChirps orders by chirp age rather than like time, which the fake
+// doesn't record.
+func (f *fakeQuerier) GetLikedChirps(
+	ctx context.Context,
+	arg database.GetLikedChirpsParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		return f.state.likes[fakePair{arg.UserID, c.ID}]
+	})
+	return fakePage(rows, "created_at", true, arg.RowLimit, arg.RowOffset), nil
+}
+
+func (f *fakeQuerier) GetRefreshTokenByToken(
+	ctx context.Context,
+	token string,
+) (database.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.state.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return r, nil
+}
+
+func (f *fakeQuerier) GetUserByEmail(
+	ctx context.Context,
+	email string,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.state.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (f *fakeQuerier) GetUserByID(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.state.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (f *fakeQuerier) IncrementQuoteCount(ctx context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.state.chirps[id]
+	if ok {
+		c.QuoteCount++
+		f.state.chirps[id] = c
+	}
+	return nil
+}
+
+func (f *fakeQuerier) IsAccessTokenRevoked(
+	ctx context.Context,
+	jti string,
+) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.state.revokedJTIs[jti]
+	return ok, nil
+}
+
+func (f *fakeQuerier) LikeChirp(
+	ctx context.Context,
+	arg database.LikeChirpParams,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.state.likes[fakePair{arg.UserID, arg.ChirpID}] = true
+	return nil
+}
+
+func (f *fakeQuerier) ListAuditEntries(
+	ctx context.Context,
+	arg database.ListAuditEntriesParams,
+) ([]database.AuditLog, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := slices.Clone(f.state.audit)
+	slices.SortFunc(rows, func(x, y database.AuditLog) int {
+		return cmp.Or(
+			y.CreatedAt.Compare(x.CreatedAt),
+			bytes.Compare(y.ID[:], x.ID[:]),
+		)
+	})
+	if int(arg.Offset) >= len(rows) {
+		return nil, nil
+	}
+	rows = rows[arg.Offset:]
+	if int(arg.Limit) < len(rows) {
+		rows = rows[:arg.Limit]
+	}
+	return rows, nil
+}
+
+func (f *fakeQuerier) ListUsers(
+	ctx context.Context,
+	arg database.ListUsersParams,
+) ([]database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := slices.Collect(maps.Values(f.state.users))
+	slices.SortFunc(rows, func(x, y database.User) int {
+		return x.CreatedAt.Compare(y.CreatedAt)
+	})
+	if int(arg.Offset) >= len(rows) {
+		return nil, nil
+	}
+	rows = rows[arg.Offset:]
+	if int(arg.Limit) < len(rows) {
+		rows = rows[:arg.Limit]
+	}
+	return rows, nil
+}
+
+func (f *fakeQuerier) MarkEmailVerified(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.state.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	u.EmailVerified = true
+	u.UpdatedAt = f.now()
+	f.state.users[id] = u
+	return u, nil
+}
+
+func (f *fakeQuerier) MarkWebhookProcessed(
+	ctx context.Context,
+	arg database.MarkWebhookProcessedParams,
+) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.webhooks[arg.ID]; ok {
+		return 0, nil
+	}
+	f.state.webhooks[arg.ID] = arg.Event
+	return 1, nil
+}
+
+func (f *fakeQuerier) ResetUsers(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id := range f.state.users {
+		f.deleteUser(id)
+	}
+	return nil
+}
+
+func (f *fakeQuerier) RevokeAccessToken(
+	ctx context.Context,
+	arg database.RevokeAccessTokenParams,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.revokedJTIs[arg.Jti]; !ok {
+		f.state.revokedJTIs[arg.Jti] = arg.UserID
+	}
+	return nil
+}
+
+func (f *fakeQuerier) RevokeAllRefreshTokensForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	for t, r := range f.state.refreshTokens {
+		if r.UserID == userID && !r.RevokedAt.Valid {
+			r.RevokedAt = sql.NullTime{Time: now, Valid: true}
+			r.UpdatedAt = now
+			f.state.refreshTokens[t] = r
+		}
+	}
+	return nil
+}
+
+func (f *fakeQuerier) RevokeAPIKey(
+	ctx context.Context,
+	arg database.RevokeAPIKeyParams,
+) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k, ok := f.state.apiKeys[arg.ID]
+	if !ok || k.UserID != arg.UserID || k.RevokedAt.Valid {
+		return 0, nil
+	}
+	k.RevokedAt = sql.NullTime{Time: f.now(), Valid: true}
+	f.state.apiKeys[arg.ID] = k
+	return 1, nil
+}
+
+func (f *fakeQuerier) RevokeRefreshToken(ctx context.Context, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.state.refreshTokens[token]
+	if ok {
+		now := f.now()
+		r.RevokedAt = sql.NullTime{Time: now, Valid: true}
+		r.UpdatedAt = now
+		f.state.refreshTokens[token] = r
+	}
+	return nil
+}
+
+// unescapeLike undoes escapeLike so the fake can do a plain substring match.
+func unescapeLike(term string) string {
+	return strings.NewReplacer(`\\`, `\`, `\%`, `%`, `\_`, `_`).Replace(term)
+}
+
+func (f *fakeQuerier) SearchChirps(
+	ctx context.Context,
+	arg database.SearchChirpsParams,
+) ([]database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	term := strings.ToLower(unescapeLike(arg.Term))
+	rows := f.chirpsWhere(func(c database.Chirp) bool {
+		if arg.UserID.Valid && c.UserID != arg.UserID.UUID {
+			return false
+		}
+		if !fakeInRange(c, arg.StartTime, arg.EndTime) {
+			return false
+		}
+		return strings.Contains(strings.ToLower(c.Body), term)
+	})
+	return fakePage(rows, arg.SortBy, arg.SortDesc, arg.RowLimit, arg.RowOffset), nil
+}
+
+func (f *fakeQuerier) RecordFailedLogin(
+	ctx context.Context,
+	arg database.RecordFailedLoginParams,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.state.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	u.FailedLoginCount++
+	if u.FailedLoginCount >= arg.MaxFailures {
+		u.FailedLoginCount = 0
+		u.LockedUntil = sql.NullTime{Time: arg.LockUntil, Valid: true}
+	}
+	f.state.users[arg.ID] = u
+	return u, nil
+}
+
+func (f *fakeQuerier) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.state.users[id]
+	if ok {
+		u.FailedLoginCount = 0
+		u.LockedUntil = sql.NullTime{}
+		f.state.users[id] = u
+	}
+	return nil
+}
+
+func (f *fakeQuerier) SetInviteUsedBy(
+	ctx context.Context,
+	arg database.SetInviteUsedByParams,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i, ok := f.state.invites[arg.Code]
+	if ok {
+		i.UsedBy = arg.UsedBy
+		f.state.invites[arg.Code] = i
+	}
+	return nil
+}
+
+func (f *fakeQuerier) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.state.chirps[id]
+	if ok && !c.DeletedAt.Valid {
+		c.DeletedAt = sql.NullTime{Time: f.now(), Valid: true}
+		f.state.chirps[id] = c
+	}
+	return nil
+}
+
+func (f *fakeQuerier) SoftDeleteChirpsByUserID(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]uuid.UUID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ids []uuid.UUID
+	now := f.now()
+	for id, c := range f.state.chirps {
+		if c.UserID == userID && !c.DeletedAt.Valid {
+			c.DeletedAt = sql.NullTime{Time: now, Valid: true}
+			c.UpdatedAt = now
+			f.state.chirps[id] = c
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeQuerier) UnfollowUser(
+	ctx context.Context,
+	arg database.UnfollowUserParams,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.state.follows, fakePair{arg.FollowerID, arg.FolloweeID})
+	return nil
+}
+
+func (f *fakeQuerier) UnlikeChirp(
+	ctx context.Context,
+	arg database.UnlikeChirpParams,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.state.likes, fakePair{arg.UserID, arg.ChirpID})
+	return nil
+}
+
+func (f *fakeQuerier) UpdateChirp(
+	ctx context.Context,
+	arg database.UpdateChirpParams,
+) (database.Chirp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.state.chirps[arg.ID]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	c.Body = arg.Body
+	c.UpdatedAt = f.now()
+	f.state.chirps[arg.ID] = c
+	return c, nil
+}
+
+func (f *fakeQuerier) UpdateToChirpyRed(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.state.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	u.IsChirpyRed = true
+	f.state.users[id] = u
+	return u, nil
+}
+
+func (f *fakeQuerier) UpdateUser(
+	ctx context.Context,
+	arg database.UpdateUserParams,
+) (database.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.state.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if arg.Email.Valid {
+		if f.emailTaken(arg.Email.String, arg.ID) {
+			return database.User{}, &pq.Error{Code: uniqueViolation}
+		}
+		if arg.Email.String != u.Email {
+			u.EmailVerified = false
+		}
+		u.Email = arg.Email.String
+	}
+	if arg.HashedPassword.Valid {
+		u.HashedPassword = arg.HashedPassword.String
+	}
+	u.UpdatedAt = f.now()
+	f.state.users[arg.ID] = u
+	return u, nil
+}
+
+func (f *fakeQuerier) UseInvite(
+	ctx context.Context,
+	code string,
+) (database.Invite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i, ok := f.state.invites[code]
+	if !ok || i.UsedAt.Valid {
+		return database.Invite{}, sql.ErrNoRows
+	}
+	i.UsedAt = sql.NullTime{Time: f.now(), Valid: true}
+	f.state.invites[code] = i
+	return i, nil
+}
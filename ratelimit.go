@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// loginLimiter counts failed logins per key within a fixed window and blocks
+// further attempts once max failures have been seen. A nil *loginLimiter
+// allows everything.
+type loginLimiter struct {
+	mu        sync.Mutex
+	max       int
+	window    time.Duration
+	now       func() time.Time
+	failures  map[string]*failureWindow
+	lastSweep time.Time
+}
+
+type failureWindow struct {
+	count int
+	start time.Time
+}
+
+func newLoginLimiter(max int, window time.Duration) *loginLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &loginLimiter{
+		max:      max,
+		window:   window,
+		now:      time.Now,
+		failures: map[string]*failureWindow{},
+	}
+}
+
+// allow reports whether key may attempt a login. When it may not, it also
+// returns how long until the current window ends.
+func (l *loginLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fw, ok := l.failures[key]
+	if !ok {
+		return true, 0
+	}
+
+	now := l.now()
+	end := fw.start.Add(l.window)
+	if !now.Before(end) {
+		delete(l.failures, key)
+		return true, 0
+	}
+
+	if fw.count >= l.max {
+		return false, end.Sub(now)
+	}
+	return true, 0
+}
+
+func (l *loginLimiter) fail(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	fw, ok := l.failures[key]
+	if !ok || !now.Before(fw.start.Add(l.window)) {
+		l.failures[key] = &failureWindow{count: 1, start: now}
+		return
+	}
+	fw.count++
+}
+
+func (l *loginLimiter) reset(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
+
+// sweep drops expired windows so keys that stop failing don't accumulate
+// forever. It runs at most once per window. l.mu must be held.
+func (l *loginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, fw := range l.failures {
+		if !now.Before(fw.start.Add(l.window)) {
+			delete(l.failures, key)
+		}
+	}
+}
+
+// clientIP returns the host part of the connection's remote address.
+func clientIP(rq *http.Request) string {
+	host, _, err := net.SplitHostPort(rq.RemoteAddr)
+	if err != nil {
+		return rq.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newLoginLimiter(3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("1.2.3.4"); !ok {
+			t.Fatalf("allow() blocked after %d failures, want 3 allowed", i)
+		}
+		l.fail("1.2.3.4")
+	}
+
+	ok, retryAfter := l.allow("1.2.3.4")
+	if ok {
+		t.Fatalf("allow() after 3 failures = true, want false")
+	}
+	if retryAfter != time.Minute {
+		t.Errorf("allow() retryAfter = %v, want %v", retryAfter, time.Minute)
+	}
+
+	if ok, _ := l.allow("5.6.7.8"); !ok {
+		t.Errorf("allow() blocked an unrelated key")
+	}
+
+	now = now.Add(45 * time.Second)
+	if _, retryAfter := l.allow("1.2.3.4"); retryAfter != 15*time.Second {
+		t.Errorf("allow() retryAfter = %v, want %v", retryAfter, 15*time.Second)
+	}
+
+	now = now.Add(15 * time.Second)
+	if ok, _ := l.allow("1.2.3.4"); !ok {
+		t.Errorf("allow() still blocked after the window ended")
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	l := newLoginLimiter(2, time.Minute)
+
+	l.fail("1.2.3.4")
+	l.fail("1.2.3.4")
+	if ok, _ := l.allow("1.2.3.4"); ok {
+		t.Fatalf("allow() after 2 failures = true, want false")
+	}
+
+	l.reset("1.2.3.4")
+	if ok, _ := l.allow("1.2.3.4"); !ok {
+		t.Errorf("allow() after reset = false, want true")
+	}
+}
+
+func TestLoginLimiterDisabled(t *testing.T) {
+	l := newLoginLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		l.fail("1.2.3.4")
+	}
+	if ok, _ := l.allow("1.2.3.4"); !ok {
+		t.Errorf("disabled limiter blocked a request")
+	}
+}
+
+func TestPostLoginRateLimited(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.loginLimiter = newLoginLimiter(2, time.Minute)
+	signUpAndLogIn(t, a, "user@example.com")
+	mux := a.routes()
+
+	login := func(password string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rq := httptest.NewRequest(
+			http.MethodPost,
+			"/api/login",
+			strings.NewReader(`{"email":"user@example.com","password":"`+password+`"}`),
+		)
+		rq.RemoteAddr = "1.2.3.4:5678"
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, rq)
+		return rec
+	}
+
+	for range 2 {
+		if rec := login("wrong-password-1"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("postLogin() with wrong password status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Once limited, even the right password is turned away.
+	rec := login("correct-horse-battery-1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("postLogin() over the limit status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want %q", got, "60")
+	}
+}
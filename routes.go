@@ -0,0 +1,101 @@
+package main
+
+import "net/http"
+
+// routes registers every handler. Patterns carry their method, so ServeMux
+// itself answers a known path requested with another method with 405 and an
+// Allow header listing the methods that are registered. A GET pattern also
+// matches HEAD, and the server drops the body of a HEAD response, so GET
+// routes answer HEAD with the same status and headers and no handler of
+// their own.
+func (a *apiConfig) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("/app/", a.middlewareMetricsInc(http.StripPrefix(
+		"/app",
+		http.FileServer(http.Dir(".")))))
+
+	mux.HandleFunc(
+		"DELETE /api/chirps/{chirpID}",
+		a.middlewareAuth(a.deleteChirpsChirpID),
+	)
+	mux.HandleFunc("DELETE /api/chirps", a.middlewareAuth(a.deleteChirps))
+	mux.HandleFunc("DELETE /api/users", a.middlewareAuth(a.deleteUsers))
+	mux.HandleFunc(
+		"DELETE /api/apikeys/{id}",
+		a.middlewareJWTAuth(a.deleteAPIKeysID),
+	)
+	mux.HandleFunc(
+		"DELETE /api/chirps/{chirpID}/likes",
+		a.middlewareAuth(a.deleteChirpsChirpIDLikes),
+	)
+	mux.HandleFunc(
+		"DELETE /api/users/{userID}/follow",
+		a.middlewareAuth(a.deleteUsersUserIDFollow),
+	)
+
+	mux.HandleFunc("GET /api/healthz", getHealthz)
+	mux.HandleFunc("GET /api/readyz", a.getReadyz)
+	mux.HandleFunc("GET /api/version", getVersion)
+	mux.HandleFunc("GET /api/stream", a.getStream)
+	mux.HandleFunc("GET /api/events", a.getEvents)
+	mux.HandleFunc("GET /api/chirps", a.getChirps)
+	mux.HandleFunc("GET /api/chirps/count", a.getChirpsCount)
+	mux.HandleFunc("GET /admin/metrics", a.getMetrics)
+	mux.HandleFunc("GET /metrics", a.getPrometheusMetrics)
+	mux.HandleFunc("GET /admin/audit", a.getAdminAudit)
+	mux.HandleFunc("GET /admin/users", a.getAdminUsers)
+	mux.HandleFunc("GET /admin/db", a.getAdminDB)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", a.getChirpsChirpID)
+	mux.HandleFunc(
+		"GET /api/chirps/{chirpID}/replies",
+		a.getChirpsChirpIDReplies,
+	)
+	mux.HandleFunc("GET /api/users/{userID}", a.getUsersUserID)
+	mux.HandleFunc("GET /api/me", a.middlewareAuth(a.getMe))
+	mux.HandleFunc("GET /api/feed", a.middlewareAuth(a.getFeed))
+	mux.HandleFunc(
+		"GET /api/users/me/likes",
+		a.middlewareJWTAuth(a.getUsersMeLikes),
+	)
+	mux.HandleFunc("GET /api/sessions", a.middlewareJWTAuth(a.getSessions))
+
+	mux.HandleFunc("POST /api/chirps", a.middlewareAuth(a.postChirps))
+	mux.HandleFunc(
+		"POST /api/chirps/batch",
+		a.middlewareAuth(a.postChirpsBatch),
+	)
+	mux.HandleFunc(
+		"POST /api/chirps/{chirpID}/likes",
+		a.middlewareAuth(a.postChirpsChirpIDLikes),
+	)
+	mux.HandleFunc("POST /api/apikeys", a.middlewareJWTAuth(a.postAPIKeys))
+	mux.HandleFunc("POST /admin/reset", a.postReset)
+	mux.HandleFunc("POST /admin/invites", a.postInvites)
+	mux.HandleFunc("POST /api/users", a.postUsers)
+	mux.HandleFunc(
+		"POST /api/users/{userID}/verify",
+		a.postUsersUserIDVerify,
+	)
+	mux.HandleFunc("POST /api/login", a.postLogin)
+	mux.HandleFunc("POST /api/refresh", a.postRefresh)
+	mux.HandleFunc("POST /api/revoke", a.postRevoke)
+	mux.HandleFunc("POST /api/revoke-access", a.postRevokeAccess)
+	mux.HandleFunc(
+		"POST /api/revoke-all",
+		a.middlewareAuth(a.postRevokeAll),
+	)
+	mux.HandleFunc("POST /api/polka/webhooks", a.postPolkaWebhooks)
+	mux.HandleFunc(
+		"POST /api/users/{userID}/follow",
+		a.middlewareAuth(a.postUsersUserIDFollow),
+	)
+
+	mux.HandleFunc("PUT /api/users", a.middlewareAuth(a.putUsers))
+	mux.HandleFunc(
+		"PUT /api/chirps/{chirpID}",
+		a.middlewareAuth(a.putChirpsChirpID),
+	)
+
+	return mux
+}
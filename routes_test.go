@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRoutesMethodNotAllowed(t *testing.T) {
+	a, _ := newFakeConfig()
+	mux := a.routes()
+
+	tests := []struct {
+		method    string
+		target    string
+		wantAllow []string
+	}{
+		{
+			method:    http.MethodPatch,
+			target:    "/api/chirps",
+			wantAllow: []string{"DELETE", "GET", "HEAD", "POST"},
+		},
+		{
+			method:    http.MethodGet,
+			target:    "/api/users",
+			wantAllow: []string{"DELETE", "POST", "PUT"},
+		},
+		{
+			method:    http.MethodPost,
+			target:    "/api/chirps/00000000-0000-0000-0000-000000000000",
+			wantAllow: []string{"DELETE", "GET", "HEAD", "PUT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+			}
+			allow := strings.Split(rec.Header().Get("Allow"), ", ")
+			slices.Sort(allow)
+			if !slices.Equal(allow, tt.wantAllow) {
+				t.Errorf("Allow = %v, want %v", allow, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestRoutesUnknownPath(t *testing.T) {
+	a, _ := newFakeConfig()
+
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRoutesHead(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"hello head"}`)
+
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	do := func(method, path string) *http.Response {
+		t.Helper()
+
+		rq, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest() error = %v", err)
+		}
+		resp, err := http.DefaultClient.Do(rq)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	tests := []struct {
+		path    string
+		headers []string
+	}{
+		{"/api/healthz", []string{"Content-Type"}},
+		{"/api/chirps", []string{"Content-Type", "X-Total-Count"}},
+		{"/api/chirps/" + c.Id.String(), []string{"Content-Type", "ETag"}},
+		{"/api/chirps/00000000-0000-0000-0000-000000000000", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			get := do(http.MethodGet, tt.path)
+			head := do(http.MethodHead, tt.path)
+
+			if head.StatusCode != get.StatusCode {
+				t.Errorf("HEAD status = %d, want %d", head.StatusCode, get.StatusCode)
+			}
+			for _, h := range tt.headers {
+				if got, want := head.Header.Get(h), get.Header.Get(h); got != want || got == "" {
+					t.Errorf("HEAD %s = %q, want %q", h, got, want)
+				}
+			}
+			body, err := io.ReadAll(head.Body)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if len(body) != 0 {
+				t.Errorf("HEAD body = %q, want empty", body)
+			}
+		})
+	}
+}
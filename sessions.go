@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxUserAgentLength caps the User-Agent stored with a refresh token, in
+// characters.
+const maxUserAgentLength = 512
+
+type session struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IpAddress string    `json:"ip_address"`
+}
+
+// sessionUserAgent is the User-Agent recorded for a new refresh token. The
+// header is client-controlled, so invalid UTF-8 is dropped rather than left
+// for the database to reject, and long values are cut on a rune boundary.
+func sessionUserAgent(rq *http.Request) string {
+	ua := strings.ToValidUTF8(rq.UserAgent(), "")
+	if utf8.RuneCountInString(ua) > maxUserAgentLength {
+		ua = string([]rune(ua)[:maxUserAgentLength])
+	}
+	return ua
+}
+
+// sessionIP is the client address recorded for a new refresh token: the
+// first X-Forwarded-For hop when a proxy sent one, otherwise clientIP. The
+// header can be forged, which is fine for showing users where they're logged
+// in but is why rate limiting doesn't use it.
+func sessionIP(rq *http.Request) string {
+	first, _, _ := strings.Cut(rq.Header.Get("X-Forwarded-For"), ",")
+	if ip := strings.TrimSpace(first); ip != "" {
+		return ip
+	}
+	return clientIP(rq)
+}
+
+// getSessions lists the caller's active logins, newest first: one for each
+// refresh token that hasn't been revoked or expired. The tokens themselves
+// are left out; a session is ended with /api/revoke, or all of them with
+// /api/revoke-all.
+func (a *apiConfig) getSessions(rw http.ResponseWriter, rq *http.Request) {
+	userID, ok := userIDFromContext(rq.Context())
+	if !ok {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := a.qry.GetActiveRefreshTokensForUser(rq.Context(), userID)
+	if err != nil {
+		fmt.Printf("apiConfig.getSessions: %v\n", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sessions := make([]session, len(rows))
+	for i, r := range rows {
+		sessions[i] = session{
+			CreatedAt: r.CreatedAt.UTC(),
+			ExpiresAt: r.ExpiresAt.UTC(),
+			UserAgent: r.UserAgent,
+			IpAddress: r.IpAddress,
+		}
+	}
+	respondWithJSON(rw, http.StatusOK, sessions)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGetSessions(t *testing.T) {
+	a, _ := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	signUpAndLogIn(t, a, "other@example.com")
+
+	rec := doJSON(t, a.middlewareAuth(a.postRevokeAll), http.MethodPost, "/api/revoke-all", u.Token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("postRevokeAll() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	logIn := func() user {
+		t.Helper()
+
+		creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+		rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		got := user{}
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return got
+	}
+	listSessions := func(token string) []session {
+		t.Helper()
+
+		rec := doJSON(t, a.middlewareJWTAuth(a.getSessions), http.MethodGet, "/api/sessions", token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("getSessions() status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var got []session
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return got
+	}
+
+	first := logIn()
+	second := logIn()
+
+	got := listSessions(second.Token)
+	if len(got) != 2 {
+		t.Fatalf("getSessions() = %d sessions, want 2", len(got))
+	}
+	if got[0].CreatedAt.Before(got[1].CreatedAt) {
+		t.Errorf("getSessions() = %+v, want newest first", got)
+	}
+
+	rec = doJSON(t, a.postRevoke, http.MethodPost, "/api/revoke", first.RefreshToken, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("postRevoke() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := listSessions(second.Token); len(got) != 1 {
+		t.Errorf("getSessions() after revoking one = %d sessions, want 1", len(got))
+	}
+}
+
+func TestRefreshTokenMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		forwardedFor  string
+		wantIPAddress string
+	}{
+		{
+			name:          "Direct",
+			wantIPAddress: "192.0.2.1",
+		},
+		{
+			name:          "Behind proxy",
+			forwardedFor:  "203.0.113.7, 10.0.0.1",
+			wantIPAddress: "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, f := newFakeConfig()
+			signUpAndLogIn(t, a, "user@example.com")
+
+			rec := httptest.NewRecorder()
+			rq := httptest.NewRequest(
+				http.MethodPost,
+				"/api/login",
+				strings.NewReader(`{"email":"user@example.com","password":"correct-horse-battery-1"}`),
+			)
+			rq.Header.Set("User-Agent", "chirpy-test/1.0")
+			if tt.forwardedFor != "" {
+				rq.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			a.postLogin(rec, rq)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			got := user{}
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+
+			r := f.state.refreshTokens[got.RefreshToken]
+			if r.UserAgent != "chirpy-test/1.0" {
+				t.Errorf("user_agent = %q, want %q", r.UserAgent, "chirpy-test/1.0")
+			}
+			if r.IpAddress != tt.wantIPAddress {
+				t.Errorf("ip_address = %q, want %q", r.IpAddress, tt.wantIPAddress)
+			}
+		})
+	}
+}
+
+func TestSessionUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{
+			name:      "Plain",
+			userAgent: "chirpy-test/1.0",
+			want:      "chirpy-test/1.0",
+		},
+		{
+			name:      "Invalid UTF-8",
+			userAgent: "chirpy\xff\xfe-test",
+			want:      "chirpy-test",
+		},
+		{
+			name:      "Long multi-byte",
+			userAgent: strings.Repeat("é", maxUserAgentLength+1),
+			want:      strings.Repeat("é", maxUserAgentLength),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+			rq.Header.Set("User-Agent", tt.userAgent)
+
+			got := sessionUserAgent(rq)
+			if got != tt.want {
+				t.Errorf("sessionUserAgent() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sessionUserAgent() = %q, want valid UTF-8", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, key_hash)
+VALUES (gen_random_uuid(), NOW(), $1, $2)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT *
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
@@ -0,0 +1,10 @@
+-- name: CreateAuditEntry :one
+INSERT INTO audit_log (id, created_at, actor_id, action, target)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3)
+RETURNING *;
+
+-- name: ListAuditEntries :many
+SELECT *
+FROM audit_log
+ORDER BY created_at DESC, id DESC
+LIMIT $1 OFFSET $2;
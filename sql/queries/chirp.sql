@@ -1,24 +1,157 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of, parent_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4)
 RETURNING *;
 
 -- name: GetAllChirps :many
 SELECT *
 FROM chirps
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetChirp :one
 SELECT *
 FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: DeleteChirp :exec
 DELETE
 FROM chirps
 WHERE id = $1;
 
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetChirpsByIDs :many
+SELECT *
+FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[]) AND deleted_at IS NULL;
+
 -- name: GetChirpsByUserID :many
 SELECT *
 FROM chirps
-WHERE user_id = $1;
+WHERE user_id = $1 AND deleted_at IS NULL;
+
+-- name: GetChirpForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: IncrementQuoteCount :exec
+UPDATE chirps
+SET quote_count = quote_count + 1
+WHERE id = $1;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetAllChirpsPaged :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' AND sqlc.arg(sort_desc)::boolean
+        THEN updated_at END DESC,
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN sqlc.arg(sort_desc)::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetChirpsByUserIDPaged :many
+SELECT *
+FROM chirps
+WHERE user_id = sqlc.arg(user_id) AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' AND sqlc.arg(sort_desc)::boolean
+        THEN updated_at END DESC,
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN sqlc.arg(sort_desc)::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: SearchChirps :many
+SELECT *
+FROM chirps
+WHERE body ILIKE '%' || sqlc.arg(term)::text || '%'
+    AND (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+    AND (sqlc.narg(start_time)::timestamp IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (sqlc.narg(end_time)::timestamp IS NULL OR created_at <= sqlc.narg(end_time))
+    AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' AND sqlc.arg(sort_desc)::boolean
+        THEN updated_at END DESC,
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN sqlc.arg(sort_desc)::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetChirpsByCreatedAtRange :many
+SELECT *
+FROM chirps
+WHERE (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+    AND (sqlc.narg(start_time)::timestamp IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (sqlc.narg(end_time)::timestamp IS NULL OR created_at <= sqlc.narg(end_time))
+    AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' AND sqlc.arg(sort_desc)::boolean
+        THEN updated_at END DESC,
+    CASE WHEN sqlc.arg(sort_by)::text = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN sqlc.arg(sort_desc)::boolean THEN created_at END DESC,
+    created_at ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetChirpReplies :many
+SELECT *
+FROM chirps
+WHERE parent_id = sqlc.arg(parent_id)::uuid AND deleted_at IS NULL
+ORDER BY created_at ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetChirpCount :one
+SELECT COUNT(*)
+FROM chirps
+WHERE (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+    AND (
+        sqlc.narg(term)::text IS NULL
+        OR body ILIKE '%' || sqlc.narg(term)::text || '%'
+    )
+    AND (sqlc.narg(start_time)::timestamp IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (sqlc.narg(end_time)::timestamp IS NULL OR created_at <= sqlc.narg(end_time))
+    AND deleted_at IS NULL;
+
+-- name: GetChirpsBefore :many
+SELECT *
+FROM chirps
+WHERE (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+    AND (
+        sqlc.narg(term)::text IS NULL
+        OR body ILIKE '%' || sqlc.narg(term)::text || '%'
+    )
+    AND (sqlc.narg(start_time)::timestamp IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (sqlc.narg(end_time)::timestamp IS NULL OR created_at <= sqlc.narg(end_time))
+    AND (
+        sqlc.narg(before_created_at)::timestamp IS NULL
+        OR sqlc.narg(before_id)::uuid IS NULL
+        OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id))
+    )
+    AND deleted_at IS NULL
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: SoftDeleteChirpsByUserID :many
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND deleted_at IS NULL
+RETURNING id;
+
+-- name: GetChirpAuthors :many
+SELECT DISTINCT users.id, users.email, users.is_chirpy_red
+FROM users
+JOIN chirps ON chirps.user_id = users.id
+WHERE chirps.id = ANY(sqlc.arg(chirp_ids)::uuid[]);
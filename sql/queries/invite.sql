@@ -0,0 +1,15 @@
+-- name: CreateInvite :one
+INSERT INTO invites (code, created_at)
+VALUES ($1, NOW())
+RETURNING *;
+
+-- name: UseInvite :one
+UPDATE invites
+SET used_at = NOW()
+WHERE code = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: SetInviteUsedBy :exec
+UPDATE invites
+SET used_by = $2
+WHERE code = $1;
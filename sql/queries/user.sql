@@ -10,11 +10,13 @@ FROM users;
 -- name: GetUserByEmail :one
 SELECT *
 FROM users
-WHERE email = $1;
+WHERE LOWER(email) = LOWER($1);
 
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, NOW() + INTERVAL '60 DAYS')
+INSERT INTO refresh_tokens (
+    token, created_at, updated_at, user_id, expires_at, user_agent, ip_address
+)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5)
 RETURNING *;
 
 -- name: GetRefreshToken :one
@@ -22,6 +24,12 @@ SELECT *
 FROM refresh_tokens
 WHERE token = $1 AND revoked_at IS NULL AND expires_at > NOW();
 
+-- name: GetActiveRefreshTokensForUser :many
+SELECT *
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC;
+
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
@@ -29,8 +37,12 @@ WHERE token = $1;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3
+SET email = COALESCE(sqlc.narg(email), email),
+    hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+    -- A new address has to be verified again.
+    email_verified = email_verified AND email = COALESCE(sqlc.narg(email), email),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
 RETURNING users.*;
 
 -- name: UpdateToChirpyRed :one
@@ -43,3 +55,61 @@ RETURNING users.*;
 SELECT *
 FROM users
 WHERE id = $1;
+
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, created_at, user_id)
+VALUES ($1, NOW(), $2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1
+    FROM revoked_access_tokens
+    WHERE jti = $1
+);
+
+-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = $1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: GetRefreshTokenByToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token = $1;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteUser :execrows
+DELETE
+FROM users
+WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT *
+FROM users
+ORDER BY created_at ASC, id ASC
+LIMIT $1 OFFSET $2;
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_count = CASE
+        WHEN failed_login_count + 1 >= sqlc.arg(max_failures)::integer THEN 0
+        ELSE failed_login_count + 1
+    END,
+    locked_until = CASE
+        WHEN failed_login_count + 1 >= sqlc.arg(max_failures)::integer
+            THEN sqlc.arg(lock_until)::timestamp
+        ELSE locked_until
+    END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_count = 0, locked_until = NULL
+WHERE id = $1;
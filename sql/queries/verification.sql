@@ -0,0 +1,21 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token, created_at, user_id, expires_at)
+VALUES ($1, NOW(), $2, $3)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+DELETE
+FROM email_verification_tokens
+WHERE token = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteEmailVerificationTokensForUser :exec
+DELETE
+FROM email_verification_tokens
+WHERE user_id = $1;
+
+-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified = TRUE, updated_at = NOW()
+WHERE id = $1
+RETURNING users.*;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE invites (
+    code TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    used_by UUID NULL REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE invites;
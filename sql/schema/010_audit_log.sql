@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    actor_id UUID NULL,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE audit_log;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE processed_webhooks (
+    id TEXT PRIMARY KEY,
+    event TEXT NOT NULL,
+    processed_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE processed_webhooks;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Emails are matched case-insensitively, so two spellings of one address
+-- mustn't both be able to sign up. Older rows may predate normalisation, and
+-- accounts that differ only by case have to be merged or renamed by hand
+-- before they can be lower-cased.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(addr, ', ' ORDER BY addr) INTO conflicts
+    FROM (
+        SELECT LOWER(email) AS addr
+        FROM users
+        GROUP BY LOWER(email)
+        HAVING COUNT(*) > 1
+    ) dupes;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email address ignoring case: %', conflicts
+        USING HINT = 'Merge or rename these accounts, then rerun the migration.';
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+UPDATE users SET email = LOWER(email) WHERE email <> LOWER(email);
+CREATE UNIQUE INDEX users_email_lower_idx ON users (LOWER(email));
+
+-- +goose Down
+DROP INDEX users_email_lower_idx;
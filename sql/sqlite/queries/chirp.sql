@@ -0,0 +1,184 @@
+-- The CASTs only tell sqlc the parameter types. SQLite gives uuid and
+-- TIMESTAMP numeric affinity, so they're only ever applied to parameters that
+-- are checked for NULL or are plain text, booleans and integers. sqlc doesn't
+-- see parameters in ORDER BY, so the sort options come in through a subquery.
+
+-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of, parent_id)
+VALUES (gen_random_uuid(), NOW(), NOW(), ?1, ?2, ?3, ?4)
+RETURNING *;
+
+-- name: GetAllChirps :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+ORDER BY created_at ASC;
+
+-- name: GetChirp :one
+SELECT *
+FROM chirps
+WHERE id = ?1 AND deleted_at IS NULL;
+
+-- name: DeleteChirp :exec
+DELETE
+FROM chirps
+WHERE id = ?1;
+
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW()
+WHERE id = ?1 AND deleted_at IS NULL;
+
+-- name: GetChirpsByIDs :many
+SELECT *
+FROM chirps
+WHERE id IN (sqlc.slice(ids)) AND deleted_at IS NULL;
+
+-- name: GetChirpsByUserID :many
+SELECT *
+FROM chirps
+WHERE user_id = ?1 AND deleted_at IS NULL;
+
+-- There's no FOR UPDATE: transactions begin IMMEDIATE, which takes SQLite's
+-- single write lock up front.
+
+-- name: GetChirpForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = ?1 AND deleted_at IS NULL;
+
+-- name: IncrementQuoteCount :exec
+UPDATE chirps
+SET quote_count = quote_count + 1
+WHERE id = ?1;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = ?2, updated_at = NOW()
+WHERE id = ?1
+RETURNING *;
+
+-- name: GetAllChirpsPaged :many
+SELECT chirps.*
+FROM chirps, (
+    SELECT CAST(sqlc.arg(sort_by) AS TEXT) AS sort_column,
+        CAST(sqlc.arg(sort_desc) AS BOOLEAN) AS descending
+) AS opts
+WHERE deleted_at IS NULL
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
+
+-- name: GetChirpsByUserIDPaged :many
+SELECT chirps.*
+FROM chirps, (
+    SELECT CAST(sqlc.arg(sort_by) AS TEXT) AS sort_column,
+        CAST(sqlc.arg(sort_desc) AS BOOLEAN) AS descending
+) AS opts
+WHERE user_id = sqlc.arg(user_id) AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
+
+-- SQLite's LIKE is case-insensitive for ASCII, which stands in for ILIKE.
+-- like() is LIKE ... ESCAPE, which sqlc can't parse.
+
+-- name: SearchChirps :many
+SELECT chirps.*
+FROM chirps, (
+    SELECT CAST(sqlc.arg(sort_by) AS TEXT) AS sort_column,
+        CAST(sqlc.arg(sort_desc) AS BOOLEAN) AS descending
+) AS opts
+WHERE like('%' || CAST(sqlc.arg(term) AS TEXT) || '%', body, '\')
+    AND (CAST(sqlc.narg(user_id) AS uuid) IS NULL OR user_id = sqlc.narg(user_id))
+    AND (CAST(sqlc.narg(start_time) AS TIMESTAMP) IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (CAST(sqlc.narg(end_time) AS TIMESTAMP) IS NULL OR created_at <= sqlc.narg(end_time))
+    AND deleted_at IS NULL
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
+
+-- name: GetChirpsByCreatedAtRange :many
+SELECT chirps.*
+FROM chirps, (
+    SELECT CAST(sqlc.arg(sort_by) AS TEXT) AS sort_column,
+        CAST(sqlc.arg(sort_desc) AS BOOLEAN) AS descending
+) AS opts
+WHERE deleted_at IS NULL
+    AND (CAST(sqlc.narg(user_id) AS uuid) IS NULL OR user_id = sqlc.narg(user_id))
+    AND (CAST(sqlc.narg(start_time) AS TIMESTAMP) IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (CAST(sqlc.narg(end_time) AS TIMESTAMP) IS NULL OR created_at <= sqlc.narg(end_time))
+ORDER BY
+    CASE WHEN opts.sort_column = 'updated_at' AND opts.descending
+        THEN updated_at END DESC,
+    CASE WHEN opts.sort_column = 'updated_at' THEN updated_at END ASC,
+    CASE WHEN opts.descending THEN created_at END DESC,
+    created_at ASC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
+
+-- name: GetChirpReplies :many
+SELECT *
+FROM chirps
+WHERE parent_id = sqlc.arg(parent_id) AND deleted_at IS NULL
+ORDER BY created_at ASC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
+
+-- name: GetChirpCount :one
+SELECT COUNT(*)
+FROM chirps
+WHERE deleted_at IS NULL
+    AND (
+        CAST(sqlc.narg(term) AS TEXT) IS NULL
+        OR like('%' || sqlc.narg(term) || '%', body, '\')
+    )
+    AND (CAST(sqlc.narg(user_id) AS uuid) IS NULL OR user_id = sqlc.narg(user_id))
+    AND (CAST(sqlc.narg(start_time) AS TIMESTAMP) IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (CAST(sqlc.narg(end_time) AS TIMESTAMP) IS NULL OR created_at <= sqlc.narg(end_time));
+
+-- name: GetChirpsBefore :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+    AND (CAST(sqlc.narg(user_id) AS uuid) IS NULL OR user_id = sqlc.narg(user_id))
+    AND (
+        CAST(sqlc.narg(term) AS TEXT) IS NULL
+        OR like('%' || sqlc.narg(term) || '%', body, '\')
+    )
+    AND (CAST(sqlc.narg(start_time) AS TIMESTAMP) IS NULL OR created_at >= sqlc.narg(start_time))
+    AND (CAST(sqlc.narg(end_time) AS TIMESTAMP) IS NULL OR created_at <= sqlc.narg(end_time))
+    AND (
+        CAST(sqlc.narg(before_created_at) AS TIMESTAMP) IS NULL
+        OR CAST(sqlc.narg(before_id) AS uuid) IS NULL
+        OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id))
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT CAST(sqlc.arg(row_limit) AS int4);
+
+-- name: SoftDeleteChirpsByUserID :many
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE user_id = ?1 AND deleted_at IS NULL
+RETURNING id;
+
+-- name: GetChirpAuthors :many
+SELECT DISTINCT users.id, users.email, users.is_chirpy_red
+FROM users
+JOIN chirps ON chirps.user_id = users.id
+WHERE chirps.id IN (sqlc.slice(chirp_ids));
@@ -0,0 +1,19 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (?1, ?2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE
+FROM follows
+WHERE follower_id = ?1 AND followee_id = ?2;
+
+-- name: GetFeed :many
+SELECT chirps.*
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg(follower_id)
+    AND chirps.deleted_at IS NULL
+ORDER BY chirps.created_at DESC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
@@ -0,0 +1,30 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES (?1, ?2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE
+FROM chirp_likes
+WHERE user_id = ?1 AND chirp_id = ?2;
+
+-- name: GetChirpLikeCount :one
+SELECT COUNT(*)
+FROM chirp_likes
+WHERE chirp_id = ?1;
+
+-- name: GetChirpLikeCounts :many
+SELECT chirp_id, COUNT(*)
+FROM chirp_likes
+WHERE chirp_id IN (sqlc.slice(chirp_ids))
+GROUP BY chirp_id;
+
+-- name: GetLikedChirps :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id
+WHERE chirp_likes.user_id = sqlc.arg(user_id)
+    AND chirps.deleted_at IS NULL
+ORDER BY chirp_likes.created_at DESC
+LIMIT CAST(sqlc.arg(row_limit) AS int4)
+OFFSET CAST(sqlc.arg(row_offset) AS int4);
@@ -0,0 +1,115 @@
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (gen_random_uuid(), NOW(), NOW(), ?1, ?2)
+RETURNING *;
+
+-- name: ResetUsers :exec
+DELETE
+FROM users;
+
+-- name: GetUserByEmail :one
+SELECT *
+FROM users
+WHERE LOWER(email) = LOWER(?1);
+
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (
+    token, created_at, updated_at, user_id, expires_at, user_agent, ip_address
+)
+VALUES (?1, NOW(), NOW(), ?2, ?3, ?4, ?5)
+RETURNING *;
+
+-- name: GetRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token = ?1 AND revoked_at IS NULL AND expires_at > NOW();
+
+-- name: GetActiveRefreshTokensForUser :many
+SELECT *
+FROM refresh_tokens
+WHERE user_id = ?1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = ?1;
+
+-- name: UpdateUser :one
+UPDATE users
+SET email = COALESCE(sqlc.narg(email), email),
+    hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+    -- A new address has to be verified again.
+    email_verified = email_verified AND email = COALESCE(sqlc.narg(email), email),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: UpdateToChirpyRed :one
+UPDATE users
+SET is_chirpy_red = TRUE
+WHERE id = ?1
+RETURNING *;
+
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = ?1;
+
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, created_at, user_id)
+VALUES (?1, NOW(), ?2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1
+    FROM revoked_access_tokens
+    WHERE jti = ?1
+);
+
+-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE token = ?1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: GetRefreshTokenByToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token = ?1;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = ?1 AND revoked_at IS NULL;
+
+-- name: DeleteUser :execrows
+DELETE
+FROM users
+WHERE id = ?1;
+
+-- name: ListUsers :many
+SELECT *
+FROM users
+ORDER BY created_at ASC, id ASC
+LIMIT CAST(sqlc.arg(limit) AS int4) OFFSET CAST(sqlc.arg(offset) AS int4);
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_count = CASE
+        WHEN failed_login_count + 1 >= CAST(sqlc.arg(max_failures) AS int4) THEN 0
+        ELSE failed_login_count + 1
+    END,
+    locked_until = CASE
+        WHEN failed_login_count + 1 >= CAST(sqlc.arg(max_failures) AS int4)
+            THEN sqlc.arg(lock_until)
+        ELSE locked_until
+    END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_count = 0, locked_until = NULL
+WHERE id = ?1;
@@ -0,0 +1,4 @@
+-- name: MarkWebhookProcessed :execrows
+INSERT INTO processed_webhooks (id, event, processed_at)
+VALUES (?1, ?2, NOW())
+ON CONFLICT (id) DO NOTHING;
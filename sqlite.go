@@ -0,0 +1,708 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+
+	"github.com/davidw1457/chirpy/internal/database"
+	"github.com/davidw1457/chirpy/internal/sqlitedb"
+)
+
+//go:embed sql/sqlite/schema.sql
+var sqliteSchema string
+
+// sqliteTimeFormat is how times are stored in SQLite. They're always UTC with
+// all nine fractional digits so they compare correctly as text, which is all
+// SQLite can do with them.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+var registerSQLiteFuncs sync.Once
+
+// openSQLite opens the SQLite database file at path, creating it and its
+// tables if need be. Foreign keys are off by default in SQLite, and
+// transactions begin IMMEDIATE so they hold the write lock from the start,
+// standing in for Postgres's row locks.
+func openSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	registerSQLiteFuncs.Do(func() {
+		// The query set calls these just like the Postgres one does.
+		sqlite.MustRegisterScalarFunction(
+			"now",
+			0,
+			func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+				return formatSQLiteTime(time.Now()), nil
+			},
+		)
+		sqlite.MustRegisterScalarFunction(
+			"gen_random_uuid",
+			0,
+			func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+				return uuid.NewString(), nil
+			},
+		)
+	})
+
+	dsn := "file:" + path +
+		"?_pragma=foreign_keys(1)" +
+		"&_pragma=busy_timeout(5000)" +
+		"&_pragma=journal_mode(WAL)" +
+		"&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("openSQLite: %w", err)
+	}
+
+	err = checkEmailCaseConflicts(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("openSQLite: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("openSQLite: %w", err)
+	}
+
+	return db, nil
+}
+
+// checkEmailCaseConflicts stands in for the check in migration 019: the
+// schema lower-cases every email, which fails on a database from before that
+// migration holding two accounts that differ only by case. It names them so
+// they can be merged or renamed by hand.
+func checkEmailCaseConflicts(ctx context.Context, db *sql.DB) error {
+	var tables int
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'",
+	).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("checkEmailCaseConflicts: %w", err)
+	}
+	if tables == 0 {
+		// A new database has nothing to normalise.
+		return nil
+	}
+
+	var conflicts sql.NullString
+	err = db.QueryRowContext(
+		ctx,
+		`SELECT group_concat(addr, ', ')
+		FROM (
+			SELECT LOWER(email) AS addr
+			FROM users
+			GROUP BY LOWER(email)
+			HAVING COUNT(*) > 1
+			ORDER BY addr
+		)`,
+	).Scan(&conflicts)
+	if err != nil {
+		return fmt.Errorf("checkEmailCaseConflicts: %w", err)
+	}
+
+	if conflicts.Valid {
+		return fmt.Errorf(
+			"users share an email address ignoring case: %s; "+
+				"merge or rename these accounts first",
+			conflicts.String,
+		)
+	}
+	return nil
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteConn formats time arguments with sqliteTimeFormat on their way to
+// the driver, which would otherwise write them in their own zone.
+type sqliteConn struct {
+	sqlitedb.DBTX
+}
+
+func (c sqliteConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (sql.Result, error) {
+	return c.DBTX.ExecContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (c sqliteConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (*sql.Rows, error) {
+	return c.DBTX.QueryContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (c sqliteConn) QueryRowContext(
+	ctx context.Context,
+	query string,
+	args ...any,
+) *sql.Row {
+	return c.DBTX.QueryRowContext(ctx, query, sqliteArgs(args)...)
+}
+
+func sqliteArgs(args []any) []any {
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = formatSQLiteTime(v)
+		case sql.NullTime:
+			args[i] = nil
+			if v.Valid {
+				args[i] = formatSQLiteTime(v.Time)
+			}
+		}
+	}
+	return args
+}
+
+// sqliteQuerier is the Querier for DB_DRIVER=sqlite. It runs the SQLite
+// query set in sql/sqlite, whose rows are identical to the Postgres ones and
+// convert directly; only the parameters differ in field order.
+type sqliteQuerier struct {
+	db *sql.DB
+	q  *sqlitedb.Queries
+}
+
+func newSQLiteQuerier(db *sql.DB) *sqliteQuerier {
+	return &sqliteQuerier{db: db, q: sqlitedb.New(sqliteConn{db})}
+}
+
+var _ Querier = (*sqliteQuerier)(nil)
+
+func (s *sqliteQuerier) BeginTx(ctx context.Context) (txn, Querier, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, &sqliteQuerier{db: s.db, q: sqlitedb.New(sqliteConn{tx})}, nil
+}
+
+func sqliteChirps(rows []sqlitedb.Chirp, err error) ([]database.Chirp, error) {
+	if err != nil {
+		return nil, err
+	}
+	chirps := make([]database.Chirp, len(rows))
+	for i, r := range rows {
+		chirps[i] = database.Chirp(r)
+	}
+	return chirps, nil
+}
+
+func (s *sqliteQuerier) ConsumeRefreshToken(
+	ctx context.Context,
+	token string,
+) (database.RefreshToken, error) {
+	r, err := s.q.ConsumeRefreshToken(ctx, token)
+	return database.RefreshToken(r), err
+}
+
+func (s *sqliteQuerier) ConsumeEmailVerificationToken(
+	ctx context.Context,
+	arg database.ConsumeEmailVerificationTokenParams,
+) (database.EmailVerificationToken, error) {
+	r, err := s.q.ConsumeEmailVerificationToken(
+		ctx,
+		sqlitedb.ConsumeEmailVerificationTokenParams(arg),
+	)
+	return database.EmailVerificationToken(r), err
+}
+
+func (s *sqliteQuerier) CreateAPIKey(
+	ctx context.Context,
+	arg database.CreateAPIKeyParams,
+) (database.ApiKey, error) {
+	r, err := s.q.CreateAPIKey(ctx, sqlitedb.CreateAPIKeyParams(arg))
+	return database.ApiKey(r), err
+}
+
+func (s *sqliteQuerier) CreateAuditEntry(
+	ctx context.Context,
+	arg database.CreateAuditEntryParams,
+) (database.AuditLog, error) {
+	r, err := s.q.CreateAuditEntry(ctx, sqlitedb.CreateAuditEntryParams(arg))
+	return database.AuditLog(r), err
+}
+
+func (s *sqliteQuerier) CreateChirp(
+	ctx context.Context,
+	arg database.CreateChirpParams,
+) (database.Chirp, error) {
+	r, err := s.q.CreateChirp(ctx, sqlitedb.CreateChirpParams(arg))
+	return database.Chirp(r), err
+}
+
+func (s *sqliteQuerier) CreateEmailVerificationToken(
+	ctx context.Context,
+	arg database.CreateEmailVerificationTokenParams,
+) (database.EmailVerificationToken, error) {
+	r, err := s.q.CreateEmailVerificationToken(
+		ctx,
+		sqlitedb.CreateEmailVerificationTokenParams(arg),
+	)
+	return database.EmailVerificationToken(r), err
+}
+
+func (s *sqliteQuerier) CreateInvite(
+	ctx context.Context,
+	code string,
+) (database.Invite, error) {
+	r, err := s.q.CreateInvite(ctx, code)
+	return database.Invite(r), err
+}
+
+func (s *sqliteQuerier) CreateRefreshToken(
+	ctx context.Context,
+	arg database.CreateRefreshTokenParams,
+) (database.RefreshToken, error) {
+	r, err := s.q.CreateRefreshToken(ctx, sqlitedb.CreateRefreshTokenParams(arg))
+	return database.RefreshToken(r), err
+}
+
+func (s *sqliteQuerier) CreateUser(
+	ctx context.Context,
+	arg database.CreateUserParams,
+) (database.User, error) {
+	r, err := s.q.CreateUser(ctx, sqlitedb.CreateUserParams(arg))
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) DeleteEmailVerificationTokensForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) error {
+	return s.q.DeleteEmailVerificationTokensForUser(ctx, userID)
+}
+
+func (s *sqliteQuerier) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteUser(ctx, id)
+}
+
+func (s *sqliteQuerier) FollowUser(
+	ctx context.Context,
+	arg database.FollowUserParams,
+) error {
+	return s.q.FollowUser(ctx, sqlitedb.FollowUserParams(arg))
+}
+
+func (s *sqliteQuerier) GetAPIKeyByHash(
+	ctx context.Context,
+	keyHash string,
+) (database.ApiKey, error) {
+	r, err := s.q.GetAPIKeyByHash(ctx, keyHash)
+	return database.ApiKey(r), err
+}
+
+func (s *sqliteQuerier) GetActiveRefreshTokensForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]database.RefreshToken, error) {
+	rows, err := s.q.GetActiveRefreshTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]database.RefreshToken, len(rows))
+	for i, r := range rows {
+		tokens[i] = database.RefreshToken(r)
+	}
+	return tokens, nil
+}
+
+func (s *sqliteQuerier) GetAllChirpsPaged(
+	ctx context.Context,
+	arg database.GetAllChirpsPagedParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetAllChirpsPaged(
+		ctx,
+		sqlitedb.GetAllChirpsPagedParams{
+			SortBy:    arg.SortBy,
+			SortDesc:  arg.SortDesc,
+			RowOffset: arg.RowOffset,
+			RowLimit:  arg.RowLimit,
+		},
+	))
+}
+
+func (s *sqliteQuerier) GetChirp(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.Chirp, error) {
+	r, err := s.q.GetChirp(ctx, id)
+	return database.Chirp(r), err
+}
+
+func (s *sqliteQuerier) GetChirpAuthors(
+	ctx context.Context,
+	chirpIds []uuid.UUID,
+) ([]database.GetChirpAuthorsRow, error) {
+	rows, err := s.q.GetChirpAuthors(ctx, chirpIds)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]database.GetChirpAuthorsRow, len(rows))
+	for i, r := range rows {
+		authors[i] = database.GetChirpAuthorsRow(r)
+	}
+	return authors, nil
+}
+
+func (s *sqliteQuerier) GetChirpCount(
+	ctx context.Context,
+	arg database.GetChirpCountParams,
+) (int64, error) {
+	return s.q.GetChirpCount(
+		ctx,
+		sqlitedb.GetChirpCountParams{
+			Term:      arg.Term,
+			UserID:    arg.UserID,
+			StartTime: arg.StartTime,
+			EndTime:   arg.EndTime,
+		},
+	)
+}
+
+func (s *sqliteQuerier) GetChirpForUpdate(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.Chirp, error) {
+	r, err := s.q.GetChirpForUpdate(ctx, id)
+	return database.Chirp(r), err
+}
+
+func (s *sqliteQuerier) GetChirpLikeCount(
+	ctx context.Context,
+	chirpID uuid.UUID,
+) (int64, error) {
+	return s.q.GetChirpLikeCount(ctx, chirpID)
+}
+
+func (s *sqliteQuerier) GetChirpLikeCounts(
+	ctx context.Context,
+	chirpIds []uuid.UUID,
+) ([]database.GetChirpLikeCountsRow, error) {
+	rows, err := s.q.GetChirpLikeCounts(ctx, chirpIds)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]database.GetChirpLikeCountsRow, len(rows))
+	for i, r := range rows {
+		counts[i] = database.GetChirpLikeCountsRow(r)
+	}
+	return counts, nil
+}
+
+func (s *sqliteQuerier) GetChirpReplies(
+	ctx context.Context,
+	arg database.GetChirpRepliesParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirpReplies(
+		ctx,
+		sqlitedb.GetChirpRepliesParams{
+			ParentID:  uuid.NullUUID{UUID: arg.ParentID, Valid: true},
+			RowOffset: arg.RowOffset,
+			RowLimit:  arg.RowLimit,
+		},
+	))
+}
+
+func (s *sqliteQuerier) GetChirpsBefore(
+	ctx context.Context,
+	arg database.GetChirpsBeforeParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirpsBefore(
+		ctx,
+		sqlitedb.GetChirpsBeforeParams(arg),
+	))
+}
+
+func (s *sqliteQuerier) GetChirpsByCreatedAtRange(
+	ctx context.Context,
+	arg database.GetChirpsByCreatedAtRangeParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirpsByCreatedAtRange(
+		ctx,
+		sqlitedb.GetChirpsByCreatedAtRangeParams{
+			SortBy:    arg.SortBy,
+			SortDesc:  arg.SortDesc,
+			UserID:    arg.UserID,
+			StartTime: arg.StartTime,
+			EndTime:   arg.EndTime,
+			RowOffset: arg.RowOffset,
+			RowLimit:  arg.RowLimit,
+		},
+	))
+}
+
+func (s *sqliteQuerier) GetChirpsByIDs(
+	ctx context.Context,
+	ids []uuid.UUID,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirpsByIDs(ctx, ids))
+}
+
+func (s *sqliteQuerier) GetChirpsByUserIDPaged(
+	ctx context.Context,
+	arg database.GetChirpsByUserIDPagedParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetChirpsByUserIDPaged(
+		ctx,
+		sqlitedb.GetChirpsByUserIDPagedParams{
+			SortBy:    arg.SortBy,
+			SortDesc:  arg.SortDesc,
+			UserID:    arg.UserID,
+			RowOffset: arg.RowOffset,
+			RowLimit:  arg.RowLimit,
+		},
+	))
+}
+
+func (s *sqliteQuerier) GetFeed(
+	ctx context.Context,
+	arg database.GetFeedParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetFeed(ctx, sqlitedb.GetFeedParams(arg)))
+}
+
+func (s *sqliteQuerier) GetLikedChirps(
+	ctx context.Context,
+	arg database.GetLikedChirpsParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.GetLikedChirps(ctx, sqlitedb.GetLikedChirpsParams(arg)))
+}
+
+func (s *sqliteQuerier) GetRefreshTokenByToken(
+	ctx context.Context,
+	token string,
+) (database.RefreshToken, error) {
+	r, err := s.q.GetRefreshTokenByToken(ctx, token)
+	return database.RefreshToken(r), err
+}
+
+func (s *sqliteQuerier) GetUserByEmail(
+	ctx context.Context,
+	email string,
+) (database.User, error) {
+	r, err := s.q.GetUserByEmail(ctx, email)
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) GetUserByID(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.User, error) {
+	r, err := s.q.GetUserByID(ctx, id)
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) IncrementQuoteCount(ctx context.Context, id uuid.UUID) error {
+	return s.q.IncrementQuoteCount(ctx, id)
+}
+
+func (s *sqliteQuerier) IsAccessTokenRevoked(
+	ctx context.Context,
+	jti string,
+) (bool, error) {
+	revoked, err := s.q.IsAccessTokenRevoked(ctx, jti)
+	return revoked != 0, err
+}
+
+func (s *sqliteQuerier) LikeChirp(
+	ctx context.Context,
+	arg database.LikeChirpParams,
+) error {
+	return s.q.LikeChirp(ctx, sqlitedb.LikeChirpParams(arg))
+}
+
+func (s *sqliteQuerier) ListAuditEntries(
+	ctx context.Context,
+	arg database.ListAuditEntriesParams,
+) ([]database.AuditLog, error) {
+	rows, err := s.q.ListAuditEntries(
+		ctx,
+		sqlitedb.ListAuditEntriesParams{Offset: arg.Offset, Limit: arg.Limit},
+	)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]database.AuditLog, len(rows))
+	for i, r := range rows {
+		entries[i] = database.AuditLog(r)
+	}
+	return entries, nil
+}
+
+func (s *sqliteQuerier) ListUsers(
+	ctx context.Context,
+	arg database.ListUsersParams,
+) ([]database.User, error) {
+	rows, err := s.q.ListUsers(
+		ctx,
+		sqlitedb.ListUsersParams{Offset: arg.Offset, Limit: arg.Limit},
+	)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]database.User, len(rows))
+	for i, r := range rows {
+		users[i] = database.User(r)
+	}
+	return users, nil
+}
+
+func (s *sqliteQuerier) MarkEmailVerified(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.User, error) {
+	r, err := s.q.MarkEmailVerified(ctx, id)
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) MarkWebhookProcessed(
+	ctx context.Context,
+	arg database.MarkWebhookProcessedParams,
+) (int64, error) {
+	return s.q.MarkWebhookProcessed(ctx, sqlitedb.MarkWebhookProcessedParams(arg))
+}
+
+func (s *sqliteQuerier) RecordFailedLogin(
+	ctx context.Context,
+	arg database.RecordFailedLoginParams,
+) (database.User, error) {
+	r, err := s.q.RecordFailedLogin(
+		ctx,
+		sqlitedb.RecordFailedLoginParams{
+			MaxFailures: arg.MaxFailures,
+			LockUntil:   sql.NullTime{Time: arg.LockUntil, Valid: true},
+			ID:          arg.ID,
+		},
+	)
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	return s.q.ResetFailedLogins(ctx, id)
+}
+
+func (s *sqliteQuerier) ResetUsers(ctx context.Context) error {
+	return s.q.ResetUsers(ctx)
+}
+
+func (s *sqliteQuerier) RevokeAccessToken(
+	ctx context.Context,
+	arg database.RevokeAccessTokenParams,
+) error {
+	return s.q.RevokeAccessToken(ctx, sqlitedb.RevokeAccessTokenParams(arg))
+}
+
+func (s *sqliteQuerier) RevokeAllRefreshTokensForUser(
+	ctx context.Context,
+	userID uuid.UUID,
+) error {
+	return s.q.RevokeAllRefreshTokensForUser(ctx, userID)
+}
+
+func (s *sqliteQuerier) RevokeAPIKey(
+	ctx context.Context,
+	arg database.RevokeAPIKeyParams,
+) (int64, error) {
+	return s.q.RevokeAPIKey(ctx, sqlitedb.RevokeAPIKeyParams(arg))
+}
+
+func (s *sqliteQuerier) RevokeRefreshToken(ctx context.Context, token string) error {
+	return s.q.RevokeRefreshToken(ctx, token)
+}
+
+func (s *sqliteQuerier) SearchChirps(
+	ctx context.Context,
+	arg database.SearchChirpsParams,
+) ([]database.Chirp, error) {
+	return sqliteChirps(s.q.SearchChirps(
+		ctx,
+		sqlitedb.SearchChirpsParams{
+			SortBy:    arg.SortBy,
+			SortDesc:  arg.SortDesc,
+			Term:      arg.Term,
+			UserID:    arg.UserID,
+			StartTime: arg.StartTime,
+			EndTime:   arg.EndTime,
+			RowOffset: arg.RowOffset,
+			RowLimit:  arg.RowLimit,
+		},
+	))
+}
+
+func (s *sqliteQuerier) SetInviteUsedBy(
+	ctx context.Context,
+	arg database.SetInviteUsedByParams,
+) error {
+	return s.q.SetInviteUsedBy(ctx, sqlitedb.SetInviteUsedByParams(arg))
+}
+
+func (s *sqliteQuerier) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return s.q.SoftDeleteChirp(ctx, id)
+}
+
+func (s *sqliteQuerier) SoftDeleteChirpsByUserID(
+	ctx context.Context,
+	userID uuid.UUID,
+) ([]uuid.UUID, error) {
+	return s.q.SoftDeleteChirpsByUserID(ctx, userID)
+}
+
+func (s *sqliteQuerier) UnfollowUser(
+	ctx context.Context,
+	arg database.UnfollowUserParams,
+) error {
+	return s.q.UnfollowUser(ctx, sqlitedb.UnfollowUserParams(arg))
+}
+
+func (s *sqliteQuerier) UnlikeChirp(
+	ctx context.Context,
+	arg database.UnlikeChirpParams,
+) error {
+	return s.q.UnlikeChirp(ctx, sqlitedb.UnlikeChirpParams(arg))
+}
+
+func (s *sqliteQuerier) UpdateChirp(
+	ctx context.Context,
+	arg database.UpdateChirpParams,
+) (database.Chirp, error) {
+	r, err := s.q.UpdateChirp(ctx, sqlitedb.UpdateChirpParams(arg))
+	return database.Chirp(r), err
+}
+
+func (s *sqliteQuerier) UpdateToChirpyRed(
+	ctx context.Context,
+	id uuid.UUID,
+) (database.User, error) {
+	r, err := s.q.UpdateToChirpyRed(ctx, id)
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) UpdateUser(
+	ctx context.Context,
+	arg database.UpdateUserParams,
+) (database.User, error) {
+	r, err := s.q.UpdateUser(ctx, sqlitedb.UpdateUserParams(arg))
+	return database.User(r), err
+}
+
+func (s *sqliteQuerier) UseInvite(
+	ctx context.Context,
+	code string,
+) (database.Invite, error) {
+	r, err := s.q.UseInvite(ctx, code)
+	return database.Invite(r), err
+}
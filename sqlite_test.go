@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+)
+
+// newSQLiteConfig is newFakeConfig backed by a real SQLite database.
+func newSQLiteConfig(t *testing.T) *apiConfig {
+	t.Helper()
+
+	db, err := openSQLite(
+		context.Background(),
+		filepath.Join(t.TempDir(), "chirpy.db"),
+	)
+	if err != nil {
+		t.Fatalf("openSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &apiConfig{
+		db:                db,
+		qry:               newSQLiteQuerier(db),
+		secret:            "secret",
+		jwtExpiry:         time.Hour,
+		refreshExpiry:     time.Hour,
+		minPasswordLength: auth.DefaultMinPasswordLength,
+		bcryptCost:        bcrypt.MinCost,
+		lockoutThreshold:  3,
+		lockoutDuration:   time.Minute,
+	}
+}
+
+func TestSQLiteCRUD(t *testing.T) {
+	a := newSQLiteConfig(t)
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postUsers, http.MethodPost, "/api/users", "", creds)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate postUsers() status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	wrong := `{"email":"user@example.com","password":"wrong-password-1"}`
+	rec = doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", wrong)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("postLogin() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	start := time.Now()
+	var posted []chirp
+	for _, body := range []string{"first chirp", "second chirp", "third"} {
+		code, c := postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+		if code != http.StatusCreated {
+			t.Fatalf("postChirp() status = %d, want %d", code, http.StatusCreated)
+		}
+		posted = append(posted, c)
+	}
+
+	rec = getChirpByID(t, a, posted[0].Id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got chirp
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Body != "first chirp" || got.UserId != u.Id {
+		t.Errorf("getChirpsChirpID() = %+v, want the first chirp", got)
+	}
+	if !got.CreatedAt.Equal(posted[0].CreatedAt) {
+		t.Errorf("created_at = %v, want %v", got.CreatedAt, posted[0].CreatedAt)
+	}
+
+	listBodies := func(query string) []string {
+		t.Helper()
+
+		rec := doJSON(t, a.getChirps, http.MethodGet, "/api/chirps"+query, "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("getChirps(%q) status = %d, want %d", query, rec.Code, http.StatusOK)
+		}
+		var chirps []chirp
+		err := json.Unmarshal(rec.Body.Bytes(), &chirps)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		bodies := []string{}
+		for _, c := range chirps {
+			bodies = append(bodies, c.Body)
+		}
+		return bodies
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"first chirp", "second chirp", "third"}},
+		{"?sort=desc", []string{"third", "second chirp", "first chirp"}},
+		{"?search=CHIRP", []string{"first chirp", "second chirp"}},
+		{"?search=%25", []string{}},
+		{"?author_id=" + u.Id.String() + "&limit=1&offset=1", []string{"second chirp"}},
+		{
+			"?start=" + start.Add(-time.Minute).Format(time.RFC3339) +
+				"&end=" + start.Add(time.Minute).Format(time.RFC3339),
+			[]string{"first chirp", "second chirp", "third"},
+		},
+		{"?end=" + start.Add(-time.Minute).Format(time.RFC3339), []string{}},
+		{"?ids=" + posted[2].Id.String() + "," + posted[0].Id.String(), []string{"third", "first chirp"}},
+	}
+	for _, tt := range tests {
+		if got := listBodies(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("getChirps(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	rec = doJSON(t, a.getChirps, http.MethodGet, "/api/chirps?expand=author", "", "")
+	var expanded []chirp
+	err = json.Unmarshal(rec.Body.Bytes(), &expanded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	for _, c := range expanded {
+		if c.Author == nil || c.Author.Email != "user@example.com" {
+			t.Errorf("getChirps() author = %+v, want user@example.com", c.Author)
+		}
+	}
+
+	rq := httptest.NewRequest(
+		http.MethodPut,
+		"/api/chirps/"+posted[1].Id.String(),
+		strings.NewReader(`{"body":"edited chirp"}`),
+	)
+	rq.Header.Set("Authorization", "Bearer "+u.Token)
+	rq.SetPathValue("chirpID", posted[1].Id.String())
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.putChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putChirpsChirpID() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rq = newAuthedRequest(
+		t,
+		http.MethodDelete,
+		"/api/chirps/"+posted[0].Id.String(),
+		u.Id,
+		a.secret,
+	)
+	rq.SetPathValue("chirpID", posted[0].Id.String())
+	rec = httptest.NewRecorder()
+	a.middlewareAuth(a.deleteChirpsChirpID)(rec, rq)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirpsChirpID() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := getChirpByID(t, a, posted[0].Id); rec.Code != http.StatusNotFound {
+		t.Errorf("getChirpsChirpID() after delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	want := []string{"edited chirp", "third"}
+	if got := listBodies(""); !slices.Equal(got, want) {
+		t.Errorf("getChirps() = %v, want %v", got, want)
+	}
+
+	rec = doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("postRefresh() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec = doJSON(t, a.postRefresh, http.MethodPost, "/api/refresh", u.RefreshToken, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused postRefresh() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.deleteUsers), http.MethodDelete, "/api/users", u.Token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteUsers() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := listBodies(""); len(got) != 0 {
+		t.Errorf("getChirps() after deleting the author = %v, want none", got)
+	}
+}
+
+func TestSQLiteLoginMixedCaseEmail(t *testing.T) {
+	a := newSQLiteConfig(t)
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	res, err := a.db.Exec(
+		"UPDATE users SET email = 'User@Example.com' WHERE id = ?",
+		u.Id,
+	)
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("Exec() updated %d rows, want 1", n)
+	}
+
+	creds := `{"email":"USER@example.COM","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postLogin, http.MethodPost, "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		t.Errorf("postLogin() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestSQLiteSignUpMixedCaseDuplicate(t *testing.T) {
+	a := newSQLiteConfig(t)
+	signUpAndLogIn(t, a, "user@example.com")
+
+	_, err := a.db.Exec("UPDATE users SET email = 'User@Example.com'")
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	creds := `{"email":"user@example.com","password":"correct-horse-battery-1"}`
+	rec := doJSON(t, a.postUsers, http.MethodPost, "/api/users", "", creds)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("postUsers() status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestSQLiteKeyset(t *testing.T) {
+	a := newSQLiteConfig(t)
+	u := signUpAndLogIn(t, a, "user@example.com")
+	for _, body := range []string{"one", "two", "three", "four", "five"} {
+		postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+	}
+
+	pages := walkChirps(t, a, func() {})
+	want := [][]string{{"five", "four"}, {"three", "two"}, {"one"}}
+	if !slices.EqualFunc(pages, want, slices.Equal) {
+		t.Errorf("pages = %q, want %q", pages, want)
+	}
+
+	_, err := a.db.Exec(
+		"UPDATE chirps SET created_at = (SELECT MIN(created_at) FROM chirps)",
+	)
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for _, page := range walkChirps(t, a, func() {}) {
+		for _, body := range page {
+			if seen[body] {
+				t.Errorf("%q returned twice", body)
+			}
+			seen[body] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("chirps seen = %v, want all 5", seen)
+	}
+}
+
+func TestSQLiteDeleteChirpsKeepsReplies(t *testing.T) {
+	a := newSQLiteConfig(t)
+	alice := signUpAndLogIn(t, a, "alice@example.com")
+	bob := signUpAndLogIn(t, a, "bob@example.com")
+	_, parent := postChirp(t, a, alice.Token, `{"body":"parent"}`)
+	_, reply := postChirp(t, a, bob.Token, `{"body":"reply","parent_id":"`+parent.Id.String()+`"}`)
+
+	rec := doJSON(t, a.middlewareAuth(a.deleteChirps), http.MethodDelete, "/api/chirps", alice.Token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("deleteChirps() status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	var parentID uuid.NullUUID
+	err := a.db.QueryRow("SELECT parent_id FROM chirps WHERE id = ?", reply.Id).Scan(&parentID)
+	if err != nil {
+		t.Fatalf("QueryRow() error = %v", err)
+	}
+	if parentID.UUID != parent.Id {
+		t.Errorf("reply parent_id = %v after deleteChirps(), want %v", parentID, parent.Id)
+	}
+
+	rec = getChirpByID(t, a, parent.Id)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("getChirpsChirpID() of a purged chirp status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestSQLiteEmailCaseConflicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+	db, err := openSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatalf("openSQLite() error = %v", err)
+	}
+
+	// Recreate a database from before emails were normalised.
+	_, err = db.Exec(`
+		DROP INDEX users_email_lower_idx;
+		INSERT INTO users (id, created_at, updated_at, email)
+		VALUES
+			('` + uuid.NewString() + `', NOW(), NOW(), 'User@Example.com'),
+			('` + uuid.NewString() + `', NOW(), NOW(), 'user@example.com');
+	`)
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	db.Close()
+
+	db, err = openSQLite(context.Background(), path)
+	if err == nil {
+		db.Close()
+		t.Fatalf("openSQLite() with case-duplicate emails error = nil, want an error")
+	}
+	if !strings.Contains(err.Error(), "user@example.com") {
+		t.Errorf("openSQLite() error = %q, want it to name user@example.com", err)
+	}
+}
+
+func TestSQLiteAuditPagesWithTiedTimes(t *testing.T) {
+	a := newSQLiteConfig(t)
+	u := signUpAndLogIn(t, a, "user@example.com")
+	var deleted []string
+	for _, body := range []string{"one", "two", "three", "four"} {
+		_, c := postChirp(t, a, u.Token, `{"body":"`+body+`"}`)
+		deleteChirp(t, a, u.Token, c.Id)
+		deleted = append(deleted, c.Id.String())
+	}
+
+	// Entries written in one transaction share a timestamp. Give them ids
+	// in the order they were written so the tiebreak is predictable.
+	_, err := a.db.Exec(`
+		UPDATE audit_log
+		SET created_at = (SELECT MIN(created_at) FROM audit_log),
+			id = printf('00000000-0000-0000-0000-%012d', rowid)
+	`)
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	var got []string
+	for offset := range len(deleted) {
+		for _, e := range listAudit(t, a, "?limit=1&offset="+strconv.Itoa(offset)) {
+			got = append(got, e.Target)
+		}
+	}
+	slices.Reverse(deleted)
+	if !slices.Equal(got, deleted) {
+		t.Errorf("paged targets = %v, want %v", got, deleted)
+	}
+}
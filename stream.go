@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamBuffer is how many chirps a stream client may fall behind by
+	// before it's dropped.
+	streamBuffer = 16
+
+	streamWriteWait  = 10 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = streamPongWait * 9 / 10
+
+	// eventsHeartbeat keeps idle /api/events connections from being cut by
+	// proxies.
+	eventsHeartbeat = 15 * time.Second
+)
+
+// chirpBroker fans new chirps out to /api/stream and /api/events clients.
+// Publishing never blocks: a client whose buffer is full is dropped rather
+// than holding up postChirps. Only publish may be called on a nil
+// *chirpBroker, where it does nothing, so handlers that post chirps work
+// without streaming set up.
+type chirpBroker struct {
+	mu      sync.Mutex
+	clients map[chan chirp]struct{}
+	closed  bool
+}
+
+func newChirpBroker() *chirpBroker {
+	return &chirpBroker{clients: map[chan chirp]struct{}{}}
+}
+
+// subscribe registers a new client. The returned channel is closed when the
+// client is dropped for being slow or the broker shuts down, and is nil if it
+// already has.
+func (b *chirpBroker) subscribe() chan chirp {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	ch := make(chan chirp, streamBuffer)
+	b.clients[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes a client that has gone away. It's safe to call after
+// the client was dropped.
+func (b *chirpBroker) unsubscribe(ch chan chirp) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+func (b *chirpBroker) publish(c chirp) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.clients {
+		select {
+		case ch <- c:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// close disconnects every client and turns new ones away. http.Server
+// doesn't track hijacked connections, so Shutdown wouldn't otherwise end
+// them.
+func (b *chirpBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.clients {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+func (b *chirpBroker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// checkStreamOrigin applies the CORS allow-list to WebSocket handshakes,
+// which browsers make cross-origin without a preflight.
+func (a *apiConfig) checkStreamOrigin(rq *http.Request) bool {
+	origin := rq.Header.Get("Origin")
+	return origin == "" ||
+		slices.Contains(a.corsOrigins, "*") ||
+		slices.Contains(a.corsOrigins, origin)
+}
+
+// getStream upgrades to a WebSocket and sends a chirp.created event for every
+// chirp posted while the client is connected. Clients only need to read;
+// anything they send is discarded.
+func (a *apiConfig) getStream(rw http.ResponseWriter, rq *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: a.checkStreamOrigin}
+	conn, err := upgrader.Upgrade(rw, rq, nil)
+	if err != nil {
+		// Upgrade has already answered with an error status.
+		return
+	}
+	defer conn.Close()
+
+	chirps := a.chirpBroker.subscribe()
+	if chirps == nil {
+		closeStream(conn, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer a.chirpBroker.unsubscribe(chirps)
+
+	// The server's read and write timeouts still apply to the hijacked
+	// connection, so both deadlines are managed here instead. Reading is
+	// also what processes pongs and notices the client closing.
+	gone := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case c, ok := <-chirps:
+			if !ok {
+				if a.chirpBroker.isClosed() {
+					closeStream(conn, websocket.CloseGoingAway, "server shutting down")
+				} else {
+					closeStream(conn, websocket.CloseTryAgainLater, "client too slow")
+				}
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			err := conn.WriteJSON(chirpEvent{Event: eventChirpCreated, Data: c})
+			if err != nil {
+				return
+			}
+		case <-ping.C:
+			err := conn.WriteControl(
+				websocket.PingMessage,
+				nil,
+				time.Now().Add(streamWriteWait),
+			)
+			if err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+func closeStream(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(streamWriteWait),
+	)
+}
+
+// getEvents is getStream as Server-Sent Events, for clients that can't use
+// WebSockets. Each chirp.created event is a data line holding the same JSON
+// the WebSocket sends, and a comment line goes out every eventsHeartbeat.
+func (a *apiConfig) getEvents(rw http.ResponseWriter, rq *http.Request) {
+	chirps := a.chirpBroker.subscribe()
+	if chirps == nil {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	defer a.chirpBroker.unsubscribe(chirps)
+
+	// The stream outlives the server's write timeout.
+	rc := http.NewResponseController(rw)
+	rc.SetWriteDeadline(time.Time{})
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	err := rc.Flush()
+	if err != nil {
+		fmt.Printf("apiConfig.getEvents: %v\n", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case c, ok := <-chirps:
+			if !ok {
+				return
+			}
+			dat, err := json.Marshal(chirpEvent{Event: eventChirpCreated, Data: c})
+			if err != nil {
+				fmt.Printf("apiConfig.getEvents: %v\n", err)
+				return
+			}
+			_, err = fmt.Fprintf(rw, "id: %s\ndata: %s\n\n", c.Id, dat)
+			if err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(rw, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+		case <-rq.Context().Done():
+			return
+		}
+
+		err := rc.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientCount waits up to a second for b to have want clients, since the
+// handler subscribes after the handshake the client sees completes.
+func clientCount(t *testing.T, b *chirpBroker, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		got := len(b.clients)
+		b.mu.Unlock()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("chirpBroker clients = %d, want %d", got, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func dialStream(t *testing.T, a *apiConfig) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(a.getStream))
+	t.Cleanup(srv.Close)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestStreamReceivesChirps(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.chirpBroker = newChirpBroker()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	conn := dialStream(t, a)
+	clientCount(t, a.chirpBroker, 1)
+	_, c := postChirp(t, a, u.Token, `{"body":"hello live feed"}`)
+
+	var got chirpEvent
+	err := conn.ReadJSON(&got)
+	if err != nil {
+		t.Fatalf("ReadJSON() error = %v", err)
+	}
+	if got.Event != eventChirpCreated {
+		t.Errorf("stream event = %q, want %q", got.Event, eventChirpCreated)
+	}
+	if got.Data.Id != c.Id || got.Data.Body != "hello live feed" {
+		t.Errorf("stream data = %+v, want chirp %v", got.Data, c.Id)
+	}
+
+	conn.Close()
+	clientCount(t, a.chirpBroker, 0)
+}
+
+func TestStreamShutdown(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.chirpBroker = newChirpBroker()
+
+	conn := dialStream(t, a)
+	clientCount(t, a.chirpBroker, 1)
+	a.chirpBroker.close()
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("ReadMessage() error = %v, want going away", err)
+	}
+}
+
+func TestEventsReceivesChirps(t *testing.T) {
+	a, _ := newFakeConfig()
+	a.chirpBroker = newChirpBroker()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	srv := httptest.NewServer(http.HandlerFunc(a.getEvents))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rq, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("getEvents() Content-Type = %q, want text/event-stream", got)
+	}
+
+	clientCount(t, a.chirpBroker, 1)
+	_, c := postChirp(t, a, u.Token, `{"body":"hello events"}`)
+
+	var data string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if ok {
+			data = line
+			break
+		}
+	}
+	if data == "" {
+		t.Fatalf("getEvents() sent no data line: %v", sc.Err())
+	}
+
+	var got chirpEvent
+	err = json.Unmarshal([]byte(data), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Event != eventChirpCreated || got.Data.Id != c.Id {
+		t.Errorf("getEvents() event = %+v, want chirp.created for %v", got, c.Id)
+	}
+
+	cancel()
+	clientCount(t, a.chirpBroker, 0)
+}
+
+func TestChirpBrokerDropsSlowClients(t *testing.T) {
+	b := newChirpBroker()
+	slow := b.subscribe()
+	fast := b.subscribe()
+
+	for i := range streamBuffer + 1 {
+		b.publish(chirp{Body: "chirp"})
+		if i < streamBuffer {
+			<-fast
+		}
+	}
+	<-fast
+
+	for range streamBuffer {
+		<-slow
+	}
+	_, ok := <-slow
+	if ok {
+		t.Errorf("slow client still subscribed after overflowing its buffer")
+	}
+	clientCount(t, b, 1)
+
+	// The handler unsubscribes on the way out either way.
+	b.unsubscribe(slow)
+	b.unsubscribe(fast)
+	clientCount(t, b, 0)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davidw1457/chirpy/internal/database"
+)
+
+// verify posts token to the verify endpoint for userID.
+func verify(
+	t *testing.T,
+	a *apiConfig,
+	userID uuid.UUID,
+	token string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	rq := httptest.NewRequest(
+		http.MethodPost,
+		"/api/users/"+userID.String()+"/verify",
+		strings.NewReader(`{"token":"`+token+`"}`),
+	)
+	rq.SetPathValue("userID", userID.String())
+	a.postUsersUserIDVerify(rec, rq)
+	return rec
+}
+
+// verificationToken returns the token issued to userID at signup.
+func verificationToken(t *testing.T, f *fakeQuerier, userID uuid.UUID) string {
+	t.Helper()
+
+	for token, v := range f.state.verifications {
+		if v.UserID == userID {
+			return token
+		}
+	}
+	t.Fatalf("no verification token issued for %v", userID)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	other := signUpAndLogIn(t, a, "other@example.com")
+
+	if u.EmailVerified {
+		t.Fatalf("new user email_verified = true, want false")
+	}
+	token := verificationToken(t, f, u.Id)
+
+	rec := verify(t, a, other.Id, token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("verify with another user's token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = verify(t, a, u.Id, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	got := user{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !got.EmailVerified {
+		t.Errorf("verify email_verified = false, want true")
+	}
+
+	rec = verify(t, a, u.Id, token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("reused token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestVerifyEmailErrors(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	token := verificationToken(t, f, u.Id)
+
+	tests := []struct {
+		name       string
+		token      string
+		now        time.Time
+		wantStatus int
+	}{
+		{
+			name:       "Expired token",
+			token:      token,
+			now:        time.Now().Add(defaultVerificationExpiry + time.Minute),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown token",
+			token:      "not-a-real-token",
+			now:        time.Now(),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Empty token",
+			token:      "",
+			now:        time.Now(),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.now = func() time.Time { return tt.now }
+
+			rec := verify(t, a, u.Id, tt.token)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("verify status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if f.state.users[u.Id].EmailVerified {
+				t.Errorf("user was verified by a rejected token")
+			}
+		})
+	}
+
+	if _, ok := f.state.verifications[token]; !ok {
+		t.Errorf("expired token was consumed, want it left in place")
+	}
+}
+
+func TestEmailChangeRequiresReverification(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	rec := verify(t, a, u.Id, verificationToken(t, f, u.Id))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	putUsers := func(body string) user {
+		t.Helper()
+
+		rec := doJSON(t, a.middlewareAuth(a.putUsers), http.MethodPut, "/api/users", u.Token, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("putUsers(%s) status = %d, want %d", body, rec.Code, http.StatusOK)
+		}
+		got := user{}
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		return got
+	}
+
+	got := putUsers(`{"password":"a-brand-new-password-3"}`)
+	if !got.EmailVerified {
+		t.Errorf("password-only change email_verified = false, want true")
+	}
+	got = putUsers(`{"email":"USER@example.com"}`)
+	if !got.EmailVerified {
+		t.Errorf("unchanged email email_verified = false, want true")
+	}
+	if len(f.state.verifications) != 0 {
+		t.Errorf("verification tokens issued without an email change")
+	}
+
+	got = putUsers(`{"email":"new@example.com"}`)
+	if got.EmailVerified {
+		t.Errorf("email change email_verified = true, want false")
+	}
+
+	rec = verify(t, a, u.Id, verificationToken(t, f, u.Id))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify new email status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !f.state.users[u.Id].EmailVerified {
+		t.Errorf("new email not verified after redeeming its token")
+	}
+}
+
+func TestEmailChangeDropsOldTokens(t *testing.T) {
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+	oldToken := verificationToken(t, f, u.Id)
+
+	rec := doJSON(t, a.middlewareAuth(a.putUsers), http.MethodPut, "/api/users", u.Token, `{"email":"new@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("putUsers() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = verify(t, a, u.Id, oldToken)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("verify with the old address's token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if f.state.users[u.Id].EmailVerified {
+		t.Errorf("new email verified by a token sent to the old one")
+	}
+	if got := verificationToken(t, f, u.Id); got == oldToken {
+		t.Errorf("no new verification token issued for the new email")
+	}
+}
+
+// recordingMailer keeps the verification tokens it's asked to send.
+type recordingMailer struct {
+	sent map[uuid.UUID]string
+}
+
+func (m *recordingMailer) sendVerification(
+	_ context.Context,
+	u database.User,
+	token string,
+) error {
+	m.sent[u.ID] = token
+	return nil
+}
+
+func TestVerificationTokenMailed(t *testing.T) {
+	a, f := newFakeConfig()
+	m := &recordingMailer{sent: map[uuid.UUID]string{}}
+	a.mailer = m
+
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	if got, want := m.sent[u.Id], verificationToken(t, f, u.Id); got != want {
+		t.Errorf("mailed token = %q, want %q", got, want)
+	}
+}
+
+func TestVerificationTokenNotLoggedWithoutMailer(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	a, f := newFakeConfig()
+	u := signUpAndLogIn(t, a, "user@example.com")
+
+	token := verificationToken(t, f, u.Id)
+	if strings.Contains(buf.String(), token) {
+		t.Errorf("log %q contains the verification token", buf.String())
+	}
+	if strings.Contains(buf.String(), "user@example.com") {
+		t.Errorf("log %q contains the user's email", buf.String())
+	}
+}
+
+// failingCommitQuerier is a fakeQuerier whose transactions fail to commit and
+// roll back instead.
+type failingCommitQuerier struct {
+	*fakeQuerier
+}
+
+type failingCommitTx struct {
+	txn
+}
+
+func (failingCommitTx) Commit() error {
+	return errors.New("commit failed")
+}
+
+func (q failingCommitQuerier) BeginTx(ctx context.Context) (txn, Querier, error) {
+	tx, qtx, err := q.fakeQuerier.BeginTx(ctx)
+	return failingCommitTx{tx}, qtx, err
+}
+
+func TestVerificationTokenNotMailedOnRollback(t *testing.T) {
+	a, f := newFakeConfig()
+	m := &recordingMailer{sent: map[uuid.UUID]string{}}
+	a.mailer = m
+	u := signUpAndLogIn(t, a, "user@example.com")
+	delete(m.sent, u.Id)
+
+	a.qry = failingCommitQuerier{f}
+
+	rec := doJSON(
+		t,
+		a.postUsers,
+		http.MethodPost,
+		"/api/users",
+		"",
+		`{"email":"other@example.com","password":"correct-horse-battery-1"}`,
+	)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("postUsers() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	rec = doJSON(t, a.middlewareAuth(a.putUsers), http.MethodPut, "/api/users", u.Token, `{"email":"new@example.com"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("putUsers() status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	if len(m.sent) != 0 {
+		t.Errorf("mailed %v for rolled-back changes, want nothing", m.sent)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import "net/http"
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X main.version=v1.2.3 \
+//		-X main.commit=$(git rev-parse HEAD) \
+//		-X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// A plain go build leaves the defaults below.
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// getVersion reports which build is serving requests.
+func getVersion(rw http.ResponseWriter, rq *http.Request) {
+	type response struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		BuildTime string `json:"build_time"`
+	}
+
+	respondWithJSON(rw, http.StatusOK, response{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+	})
+}
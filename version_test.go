@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetVersion(t *testing.T) {
+	oldVersion, oldCommit, oldBuildTime := version, commit, buildTime
+	t.Cleanup(func() {
+		version, commit, buildTime = oldVersion, oldCommit, oldBuildTime
+	})
+
+	tests := []struct {
+		name string
+		set  func()
+		want map[string]string
+	}{
+		{
+			name: "Defaults",
+			set:  func() {},
+			want: map[string]string{
+				"version":    "dev",
+				"commit":     "unknown",
+				"build_time": "unknown",
+			},
+		},
+		{
+			name: "Injected",
+			set: func() {
+				version = "v1.2.3"
+				commit = "abc123"
+				buildTime = "2024-01-02T03:04:05Z"
+			},
+			want: map[string]string{
+				"version":    "v1.2.3",
+				"commit":     "abc123",
+				"build_time": "2024-01-02T03:04:05Z",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.set()
+			rec := httptest.NewRecorder()
+			getVersion(rec, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("getVersion() status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			got := map[string]string{}
+			err := json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("getVersion() %s = %q, want %q", k, got[k], v)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("getVersion() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+)
+
+const (
+	eventChirpCreated = "chirp.created"
+
+	webhookMaxAttempts = 3
+	webhookBackoff     = 500 * time.Millisecond
+	webhookTimeout     = 5 * time.Second
+)
+
+// chirpEvent is the envelope chirp events are sent in, both to the webhook
+// and to /api/stream clients.
+type chirpEvent struct {
+	Event string `json:"event"`
+	Data  chirp  `json:"data"`
+}
+
+// chirpWebhook delivers chirp events to a downstream URL, the outbound
+// counterpart of the Polka webhook. Bodies are signed like Polka signs theirs:
+// a hex HMAC-SHA256 of the body in X-Chirpy-Signature. A nil *chirpWebhook
+// delivers nothing.
+type chirpWebhook struct {
+	url         string
+	secret      string
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	pending     sync.WaitGroup
+}
+
+func newChirpWebhook(url, secret string) *chirpWebhook {
+	if url == "" {
+		return nil
+	}
+
+	return &chirpWebhook{
+		url:         url,
+		secret:      secret,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: webhookMaxAttempts,
+		backoff:     webhookBackoff,
+	}
+}
+
+// chirpCreated sends a chirp.created event for c in the background so the
+// request that created it isn't held up by the downstream system.
+func (w *chirpWebhook) chirpCreated(c chirp) {
+	if w == nil {
+		return
+	}
+
+	body, err := json.Marshal(chirpEvent{Event: eventChirpCreated, Data: c})
+	if err != nil {
+		slog.Error("chirp webhook", "chirp_id", c.Id, "error", err)
+		return
+	}
+
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+
+		err := w.deliver(body)
+		if err != nil {
+			slog.Error("chirp webhook", "chirp_id", c.Id, "error", err)
+		}
+	}()
+}
+
+// deliver POSTs body, retrying with exponential backoff when the request fails
+// or the receiver answers with a 5xx. Any other response is final.
+func (w *chirpWebhook) deliver(body []byte) error {
+	signature := auth.SignHMAC(body, w.secret)
+	backoff := w.backoff
+
+	var err error
+	for attempt := 1; attempt <= w.maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var rq *http.Request
+		rq, err = http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("chirpWebhook.deliver: %w", err)
+		}
+		rq.Header.Set("Content-Type", "application/json")
+		rq.Header.Set("X-Chirpy-Signature", signature)
+
+		var resp *http.Response
+		resp, err = w.client.Do(rq)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 500 {
+			err = fmt.Errorf("receiver returned %s", resp.Status)
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf(
+				"chirpWebhook.deliver: receiver returned %s",
+				resp.Status,
+			)
+		}
+		return nil
+	}
+
+	return fmt.Errorf(
+		"chirpWebhook.deliver: giving up after %d attempts: %w",
+		w.maxAttempts,
+		err,
+	)
+}
+
+// wait blocks until every event already handed to the webhook has been
+// delivered or given up on.
+func (w *chirpWebhook) wait() {
+	if w == nil {
+		return
+	}
+	w.pending.Wait()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidw1457/chirpy/internal/auth"
+)
+
+func TestChirpWebhookDelivers(t *testing.T) {
+	var mu sync.Mutex
+	var gotBody []byte
+	var gotSignature string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, rq *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			gotBody, _ = io.ReadAll(rq.Body)
+			gotSignature = rq.Header.Get("X-Chirpy-Signature")
+			rw.WriteHeader(http.StatusNoContent)
+		},
+	))
+	defer srv.Close()
+
+	a, _ := newFakeConfig()
+	a.chirpWebhook = newChirpWebhook(srv.URL, "hook-secret")
+	u := signUpAndLogIn(t, a, "user@example.com")
+	_, c := postChirp(t, a, u.Token, `{"body":"hello downstream"}`)
+	a.chirpWebhook.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := auth.VerifyHMAC(gotBody, gotSignature, "hook-secret"); err != nil {
+		t.Errorf("VerifyHMAC() error = %v", err)
+	}
+
+	var got struct {
+		Event string `json:"event"`
+		Data  chirp  `json:"data"`
+	}
+	err := json.Unmarshal(gotBody, &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Event != eventChirpCreated {
+		t.Errorf("webhook event = %q, want %q", got.Event, eventChirpCreated)
+	}
+	if got.Data.Id != c.Id || got.Data.Body != "hello downstream" {
+		t.Errorf("webhook data = %+v, want chirp %v", got.Data, c.Id)
+	}
+}
+
+func TestChirpWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "Succeeds first time",
+			statuses:     []int{http.StatusOK},
+			wantAttempts: 1,
+		},
+		{
+			name: "Retries server errors",
+			statuses: []int{
+				http.StatusInternalServerError,
+				http.StatusBadGateway,
+				http.StatusOK,
+			},
+			wantAttempts: 3,
+		},
+		{
+			name: "Gives up after max attempts",
+			statuses: []int{
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+				http.StatusOK,
+			},
+			wantAttempts: webhookMaxAttempts,
+			wantErr:      true,
+		},
+		{
+			name:         "Client errors aren't retried",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(rw http.ResponseWriter, rq *http.Request) {
+					rw.WriteHeader(tt.statuses[attempts])
+					attempts++
+				},
+			))
+			defer srv.Close()
+
+			w := newChirpWebhook(srv.URL, "hook-secret")
+			w.backoff = time.Millisecond
+			err := w.deliver([]byte(`{"event":"chirp.created"}`))
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("deliver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("deliver() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}